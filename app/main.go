@@ -1,16 +1,45 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"github.com/codecrafters-io/redis-starter-go/app/pkg"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/config"
 	"github.com/codecrafters-io/redis-starter-go/app/pkg/store"
 )
 
 func main() {
+	cfg, err := config.Parse(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error loading configuration:", err)
+		os.Exit(1)
+	}
+
 	inMemoryStore := &store.Store{KV: store.NewKVStore(),
 		Lists: store.NewListsStore(), StreamStore: store.NewStreamStore(), KeyTypeStore: store.NewKeyTypeStore()}
-	server := pkg.NewServer("0.0.0.0:6379", inMemoryStore)
-	err := server.ListenAndServe()
-	if err != nil {
-		return
+	server := pkg.NewServer("", inMemoryStore)
+	server.Config = cfg
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		for sig := range signals {
+			fmt.Printf("Received %s, shutting down\n", sig)
+			// Like Redis, keep running if the snapshot can't be saved.
+			if err := server.Shutdown(context.Background()); err != nil {
+				fmt.Fprintln(os.Stderr, "Error shutting down:", err)
+			}
+		}
+	}()
+
+	err = server.ListenAndServe()
+	if !errors.Is(err, pkg.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
 	}
 }
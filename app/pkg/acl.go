@@ -0,0 +1,267 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/acl"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+)
+
+// aclLogDefaultCount is how many entries ACL LOG returns without a count.
+const aclLogDefaultCount = 10
+
+// initACL gives the default user the requirepass password and then loads
+// the ACL file, whose users take precedence.
+func (s *Server) initACL() error {
+	s.applyRequirepass()
+	if path := s.Config.Get("aclfile"); path != "" {
+		return s.ACL.LoadFile(path)
+	}
+	return nil
+}
+
+// applyRequirepass makes requirepass the default user's only password.
+func (s *Server) applyRequirepass() {
+	rules := []string{"nopass"}
+	if password := s.Config.Get("requirepass"); password != "" {
+		rules = []string{"resetpass", ">" + password}
+	}
+	_ = s.ACL.SetUser("default", rules)
+}
+
+// checkACL verifies that c's user may run argv, recording denials in the
+// ACL log. context is "toplevel", or "multi" inside EXEC. Commands that may
+// run before authenticating are always allowed.
+func (s *Server) checkACL(c *Client, cmd *Command, argv [][]byte, context string) *protocol.Error {
+	if c.primary || cmd.Has(FlagNoAuth) {
+		return nil
+	}
+	req := acl.Request{Command: cmd.Name, Subcommand: cmd.subcommand(argv), Keys: cmd.Keys(argv), Write: cmd.Has(FlagWrite)}
+	req.Categories = cmd.aclCategories(req.Subcommand)
+	req.Channels, req.Patterns = commandChannels(cmd, argv)
+
+	user := c.User()
+	denial := s.ACL.Check(user, &req)
+	if denial == nil {
+		return nil
+	}
+	s.ACL.Log.Add(denial.Reason, context, denial.Object, user, c.info(false), int(s.Config.Int("acllog-max-len")))
+	switch denial.Reason {
+	case "key":
+		s.stats.deniedKeys.Add(1)
+		return &protocol.Error{Message: "NOPERM No permissions to access a key"}
+	case "channel":
+		s.stats.deniedChannels.Add(1)
+		return &protocol.Error{Message: "NOPERM No permissions to access a channel"}
+	default:
+		s.stats.deniedCommands.Add(1)
+		return &protocol.Error{Message: fmt.Sprintf("NOPERM User %s has no permissions to run the '%s' command", user, denial.Object)}
+	}
+}
+
+// disconnectRemovedUsers closes the connections authenticated as users
+// that no longer exist. self is closed once its reply is written.
+func (s *Server) disconnectRemovedUsers(self *Client) {
+	clients, _ := s.snapshotClients()
+	for _, other := range clients {
+		if other.primary || s.ACL.Exists(other.User()) {
+			continue
+		}
+		if other == self {
+			self.closeAfterReply = true
+		} else {
+			_ = other.Close()
+		}
+	}
+}
+
+// field is a map entry with a bulk string key.
+func field(name string, value protocol.RespValue) protocol.MapEntry {
+	return protocol.MapEntry{Key: &protocol.BulkString{Data: name}, Value: value}
+}
+
+func bulkStrings(values []string) *protocol.Array {
+	elements := make([]protocol.RespValue, len(values))
+	for i, v := range values {
+		elements[i] = &protocol.BulkString{Data: v}
+	}
+	return &protocol.Array{Elements: elements}
+}
+
+func aclCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	sub := strings.ToUpper(string(args[0]))
+	switch sub {
+	case "WHOAMI":
+		if len(args) != 1 {
+			return nil, subcommandArityError("acl", sub)
+		}
+		return &protocol.BulkString{Data: c.User()}, nil
+
+	case "CAT":
+		switch len(args) {
+		case 1:
+			return bulkStrings(acl.Categories), nil
+		case 2:
+			return aclCategoryCommands(s, strings.ToLower(string(args[1])))
+		default:
+			return nil, subcommandArityError("acl", sub)
+		}
+
+	case "SETUSER":
+		if len(args) < 2 {
+			return nil, subcommandArityError("acl", sub)
+		}
+		if err := s.ACL.SetUser(string(args[1]), stringArgs(args[2:])); err != nil {
+			return nil, &protocol.Error{Message: "ERR " + err.Error()}
+		}
+		return &protocol.SimpleString{Data: "OK"}, nil
+
+	case "GETUSER":
+		if len(args) != 2 {
+			return nil, subcommandArityError("acl", sub)
+		}
+		u := s.ACL.User(string(args[1]))
+		if u == nil {
+			return &protocol.NullBulkString{}, nil
+		}
+		return &protocol.Map{Entries: []protocol.MapEntry{
+			field("flags", &protocol.Set{Elements: bulkStrings(u.Flags()).Elements}),
+			field("passwords", bulkStrings(u.Passwords())),
+			field("commands", &protocol.BulkString{Data: u.CommandRules()}),
+			field("keys", &protocol.BulkString{Data: u.KeyRules()}),
+			field("channels", &protocol.BulkString{Data: u.ChannelRules()}),
+			field("selectors", &protocol.Array{Elements: []protocol.RespValue{}}),
+		}}, nil
+
+	case "DELUSER":
+		if len(args) < 2 {
+			return nil, subcommandArityError("acl", sub)
+		}
+		deleted, err := s.ACL.DelUser(stringArgs(args[1:])...)
+		if err != nil {
+			return nil, &protocol.Error{Message: "ERR " + err.Error()}
+		}
+		s.disconnectRemovedUsers(c)
+		return &protocol.IntegerBulkString{Data: int64(deleted)}, nil
+
+	case "USERS", "LIST":
+		if len(args) != 1 {
+			return nil, subcommandArityError("acl", sub)
+		}
+		users := s.ACL.Users()
+		lines := make([]string, len(users))
+		for i, u := range users {
+			if sub == "USERS" {
+				lines[i] = u.Name
+			} else {
+				lines[i] = u.String()
+			}
+		}
+		return bulkStrings(lines), nil
+
+	case "LOG":
+		return aclLog(s, args[1:])
+
+	case "LOAD", "SAVE":
+		if len(args) != 1 {
+			return nil, subcommandArityError("acl", sub)
+		}
+		path := s.Config.Get("aclfile")
+		if path == "" {
+			return nil, &protocol.Error{Message: "ERR This Redis instance is not configured to use an ACL file. You may want to specify users via the ACL SETUSER command and then issue a CONFIG REWRITE (assuming you have a Redis configuration file set) in order to store users in the Redis configuration."}
+		}
+		if sub == "SAVE" {
+			if err := s.ACL.SaveFile(path); err != nil {
+				fmt.Println("Error saving ACLs:", err)
+				return nil, &protocol.Error{Message: "ERR There was an error trying to save the ACLs. Please check the server logs for more information"}
+			}
+			return &protocol.SimpleString{Data: "OK"}, nil
+		}
+		if err := s.ACL.LoadFile(path); err != nil {
+			return nil, &protocol.Error{Message: "ERR " + err.Error()}
+		}
+		s.disconnectRemovedUsers(c)
+		return &protocol.SimpleString{Data: "OK"}, nil
+
+	default:
+		return nil, &protocol.Error{Message: fmt.Sprintf("ERR unknown subcommand '%s'. Try ACL HELP.", args[0])}
+	}
+}
+
+// aclCategoryCommands lists the commands, and subcommands, in a category.
+func aclCategoryCommands(s *Server, category string) (protocol.RespValue, *protocol.Error) {
+	known := false
+	for _, cat := range acl.Categories {
+		known = known || cat == category
+	}
+	if !known {
+		return nil, &protocol.Error{Message: fmt.Sprintf("ERR Unknown category '%s'", category)}
+	}
+
+	in := func(cats []string) bool {
+		for _, cat := range cats {
+			if cat == category {
+				return true
+			}
+		}
+		return false
+	}
+	var names []string
+	for _, cmd := range s.Commands.All() {
+		if in(cmd.aclCategories("")) {
+			names = append(names, cmd.Name)
+			continue
+		}
+		for sub := range cmd.Subcommands {
+			if in(cmd.aclCategories(sub)) {
+				names = append(names, cmd.Name+"|"+sub)
+			}
+		}
+	}
+	sort.Strings(names)
+	return bulkStrings(names), nil
+}
+
+// aclLog implements ACL LOG [count | RESET].
+func aclLog(s *Server, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	count := aclLogDefaultCount
+	switch {
+	case len(args) == 0:
+	case len(args) == 1 && bytes.EqualFold(args[0], []byte("RESET")):
+		s.ACL.Log.Reset()
+		return &protocol.SimpleString{Data: "OK"}, nil
+	case len(args) == 1:
+		n, err := strconv.Atoi(string(args[0]))
+		if err != nil || n < 0 {
+			return nil, &protocol.Error{Message: "ERR value is out of range, must be positive"}
+		}
+		count = n
+	default:
+		return nil, subcommandArityError("acl", "log")
+	}
+
+	now := time.Now()
+	entries := s.ACL.Log.Entries(count)
+	elements := make([]protocol.RespValue, len(entries))
+	for i, e := range entries {
+		age := now.Sub(e.Created).Seconds()
+		elements[i] = &protocol.Map{Entries: []protocol.MapEntry{
+			field("count", &protocol.IntegerBulkString{Data: int64(e.Count)}),
+			field("reason", &protocol.BulkString{Data: e.Reason}),
+			field("context", &protocol.BulkString{Data: e.Context}),
+			field("object", &protocol.BulkString{Data: e.Object}),
+			field("username", &protocol.BulkString{Data: e.Username}),
+			field("age-seconds", &protocol.Double{Data: age}),
+			field("client-info", &protocol.BulkString{Data: e.ClientInfo}),
+			field("entry-id", &protocol.IntegerBulkString{Data: e.ID}),
+			field("timestamp-created", &protocol.IntegerBulkString{Data: e.Created.UnixMilli()}),
+			field("timestamp-last-updated", &protocol.IntegerBulkString{Data: e.Updated.UnixMilli()}),
+		}}
+	}
+	return &protocol.Array{Elements: elements}, nil
+}
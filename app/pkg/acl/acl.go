@@ -0,0 +1,270 @@
+// Package acl implements Redis access control lists: users, their
+// passwords, and the commands, keys and channels each user may access.
+package acl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Request describes what a command is about to access.
+type Request struct {
+	Command string
+	// Subcommand is set for container commands such as CONFIG GET.
+	Subcommand string
+	Categories []string
+	// Keys and Channels are the command's arguments, which Check does not
+	// retain.
+	Keys [][]byte
+	// Write reports whether Keys are modified rather than only read.
+	Write    bool
+	Channels [][]byte
+	// Patterns reports whether Channels are subscription patterns.
+	Patterns bool
+}
+
+// Denial explains why Check refused a request, in the terms ACL LOG uses.
+type Denial struct {
+	// Reason is "command", "key" or "channel".
+	Reason string
+	Object string
+}
+
+var ErrDefaultUser = errors.New("The 'default' user cannot be removed")
+
+type ACL struct {
+	mu    sync.RWMutex
+	users map[string]*User
+	known func(command, sub string) bool
+
+	Log *Log
+}
+
+// New returns an ACL holding only the default user, which may run every
+// command without a password. known reports whether a command, or one of
+// its subcommands when sub is not empty, exists.
+func New(known func(command, sub string) bool) *ACL {
+	return &ACL{
+		users: map[string]*User{"default": defaultUser()},
+		known: known,
+		Log:   NewLog(),
+	}
+}
+
+func defaultUser() *User {
+	u := newUser("default")
+	u.enabled = true
+	u.nopass = true
+	u.keys = []keyPattern{{pattern: "*", read: true, write: true}}
+	u.channels = []string{"*"}
+	u.commands = []commandRule{{allow: true, all: true}}
+	return u
+}
+
+// SetUser creates the user if needed and applies rules to it. Either every
+// rule is applied or, if one of them is invalid, none is.
+func (a *ACL) SetUser(name string, rules []string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	u, err := a.buildUser(a.users[name], name, rules)
+	if err != nil {
+		return err
+	}
+	a.users[name] = u
+	return nil
+}
+
+func (a *ACL) buildUser(existing *User, name string, rules []string) (*User, error) {
+	if strings.ContainsAny(name, " \t\r\n") || name == "" {
+		return nil, errors.New("Usernames can't contain spaces or null characters")
+	}
+	u := newUser(name)
+	if existing != nil {
+		u = existing.clone()
+	}
+	for _, rule := range rules {
+		if err := u.apply(rule, a.known); err != nil {
+			return nil, &RuleError{Rule: rule, Err: err}
+		}
+	}
+	return u, nil
+}
+
+// DelUser removes users and returns how many existed.
+func (a *ACL) DelUser(names ...string) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, name := range names {
+		if name == "default" {
+			return 0, ErrDefaultUser
+		}
+	}
+	deleted := 0
+	for _, name := range names {
+		if _, ok := a.users[name]; ok {
+			delete(a.users, name)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// User returns a copy of the named user, or nil.
+func (a *ACL) User(name string) *User {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if u, ok := a.users[name]; ok {
+		return u.clone()
+	}
+	return nil
+}
+
+func (a *ACL) Exists(name string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	_, ok := a.users[name]
+	return ok
+}
+
+// Users returns copies of every user, sorted by name.
+func (a *ACL) Users() []*User {
+	a.mu.RLock()
+	users := make([]*User, 0, len(a.users))
+	for _, u := range a.users {
+		users = append(users, u.clone())
+	}
+	a.mu.RUnlock()
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	return users
+}
+
+// Authenticate reports whether name is an enabled user accepting password.
+func (a *ACL) Authenticate(name, password string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	u, ok := a.users[name]
+	return ok && u.enabled && u.checkPassword(password)
+}
+
+// AuthRequired reports whether new connections must authenticate, which
+// is the case unless the default user is enabled and has no password.
+func (a *ACL) AuthRequired() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	u := a.users["default"]
+	return !u.enabled || !u.nopass
+}
+
+// DefaultHasNoPassword reports whether the default user is set to nopass.
+func (a *ACL) DefaultHasNoPassword() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.users["default"].nopass
+}
+
+// Check reports whether the named user may run req, and if not, why.
+func (a *ACL) Check(username string, req *Request) *Denial {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	u, ok := a.users[username]
+	if !ok || !u.canRun(req) {
+		object := req.Command
+		if req.Subcommand != "" {
+			object += "|" + req.Subcommand
+		}
+		return &Denial{Reason: "command", Object: object}
+	}
+	for _, key := range req.Keys {
+		if !u.canAccessKey(key, req.Write) {
+			return &Denial{Reason: "key", Object: string(key)}
+		}
+	}
+	for _, channel := range req.Channels {
+		if !u.canAccessChannel(channel, req.Patterns) {
+			return &Denial{Reason: "channel", Object: string(channel)}
+		}
+	}
+	return nil
+}
+
+// Load replaces every user with those defined in r, one
+// "user <name> <rules...>" directive per line. Nothing changes if any line
+// is invalid. A default user is created if r does not define one.
+func (a *ACL) Load(r io.Reader, source string) error {
+	users := make(map[string]*User)
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if fields[0] != "user" || len(fields) < 2 {
+			return fmt.Errorf("%s:%d: should start with user keyword", source, lineNum)
+		}
+		if _, dup := users[fields[1]]; dup {
+			return fmt.Errorf("%s:%d: duplicate user '%s' found", source, lineNum, fields[1])
+		}
+		u, err := a.buildUser(nil, fields[1], fields[2:])
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", source, lineNum, err)
+		}
+		users[u.Name] = u
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if _, ok := users["default"]; !ok {
+		users["default"] = defaultUser()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.users = users
+	return nil
+}
+
+func (a *ACL) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return a.Load(f, path)
+}
+
+// Save writes every user in the format Load reads.
+func (a *ACL) Save(w io.Writer) error {
+	for _, u := range a.Users() {
+		if _, err := fmt.Fprintln(w, u.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveFile writes the users to a temporary file and renames it over path.
+func (a *ACL) SaveFile(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "temp-*.acl")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := a.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
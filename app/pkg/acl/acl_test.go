@@ -0,0 +1,347 @@
+package acl
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// known stands in for the server's command table.
+func known(command, sub string) bool {
+	switch command {
+	case "get", "set", "lpush", "publish", "subscribe", "psubscribe":
+		return sub == ""
+	case "config":
+		return sub == "" || sub == "get" || sub == "set"
+	}
+	return false
+}
+
+func TestSetUserRules(t *testing.T) {
+	pwHash := hashPassword("pw")
+	tests := []struct {
+		rules []string
+		want  string
+		err   string
+	}{
+		{nil, "user u off resetchannels -@all", ""},
+		{[]string{"on", ">pw", "%W~jobs:*", "+@write"}, "user u on #" + pwHash + " %W~jobs:* resetchannels -@all +@write", ""},
+		{[]string{"%R~*", "+@read"}, "user u off %R~* resetchannels -@all +@read", ""},
+		{[]string{"%rw~cache:*", "%W~logs:*"}, "user u off ~cache:* %W~logs:* resetchannels -@all", ""},
+		{[]string{"%rw~cache:*", "%WR~*"}, "user u off ~* resetchannels -@all", ""},
+		{[]string{"on", "nopass", "allkeys", "allchannels", "allcommands"}, "user u on nopass ~* &* +@all", ""},
+		{[]string{"~a", "~*"}, "user u off ~* resetchannels -@all", ""},
+		{[]string{"&news.*", "&alerts"}, "user u off &news.* &alerts -@all", ""},
+		{[]string{"+@all", "-config", "+config|get"}, "user u off resetchannels +@all -config +config|get", ""},
+		{[]string{"+GET", "+@List"}, "user u off resetchannels -@all +get +@list", ""},
+		{[]string{"+get", "+@all"}, "user u off resetchannels +@all", ""},
+		{[]string{"on", ">pw", "~*", "&*", "+@all", "reset"}, "user u off resetchannels -@all", ""},
+		{[]string{"#" + pwHash}, "user u off #" + pwHash + " resetchannels -@all", ""},
+		{[]string{">pw", "nopass"}, "user u off nopass resetchannels -@all", ""},
+		{[]string{">pw", "resetpass"}, "user u off resetchannels -@all", ""},
+
+		{[]string{"+nosuch"}, "", "Unknown command or category name in ACL"},
+		{[]string{"+config|nosuch"}, "", "Unknown command or category name in ACL"},
+		{[]string{"+config|"}, "", "Syntax error"},
+		{[]string{"+@nosuch"}, "", "Unknown command or category name in ACL"},
+		{[]string{"%X~a"}, "", "Syntax error"},
+		{[]string{"%~a"}, "", "Syntax error"},
+		{[]string{"%R"}, "", "Syntax error"},
+		{[]string{"~*", "~a"}, "", "Adding a pattern after the * pattern"},
+		{[]string{"&*", "&a"}, "", "Adding a pattern after the * pattern"},
+		{[]string{"<pw"}, "", "no such password"},
+		{[]string{"#abc"}, "", "The password hash must be exactly 64 characters"},
+		{[]string{"#" + strings.ToUpper(pwHash)}, "", "The password hash must be exactly 64 characters"},
+		{[]string{"!" + pwHash}, "", "no such password"},
+		{[]string{"sometimes"}, "", "Syntax error"},
+		{[]string{""}, "", "Syntax error"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.rules, " "), func(t *testing.T) {
+			a := New(known)
+			err := a.SetUser("u", tt.rules)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				var ruleErr *RuleError
+				if !errors.As(err, &ruleErr) {
+					t.Errorf("%v is not a RuleError", err)
+				}
+				if a.Exists("u") {
+					t.Error("a user was created by invalid rules")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := a.User("u").String(); got != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetUserIsAtomic(t *testing.T) {
+	a := New(known)
+	if err := a.SetUser("u", []string{"on", ">pw", "~a", "+get"}); err != nil {
+		t.Fatal(err)
+	}
+	before := a.User("u").String()
+	if err := a.SetUser("u", []string{"~b", "+set", "+nosuch"}); err == nil {
+		t.Fatal("invalid rule accepted")
+	}
+	if after := a.User("u").String(); after != before {
+		t.Errorf("user changed by a rejected SETUSER: %q, was %q", after, before)
+	}
+
+	for _, name := range []string{"", "two words", "new\nline"} {
+		if err := a.SetUser(name, nil); err == nil {
+			t.Errorf("username %q accepted", name)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	a := New(known)
+	steps := []struct {
+		rules   []string
+		accepts []string
+		rejects []string
+	}{
+		{[]string{"on", ">one", ">two"}, []string{"one", "two"}, []string{"", "three"}},
+		{[]string{"<one"}, []string{"two"}, []string{"one"}},
+		{[]string{"#" + hashPassword("three")}, []string{"two", "three"}, []string{"one"}},
+		{[]string{"!" + hashPassword("two")}, []string{"three"}, []string{"two"}},
+		{[]string{"off"}, nil, []string{"three"}},
+		{[]string{"on", "nopass"}, []string{"", "anything"}, nil},
+		{[]string{"resetpass"}, nil, []string{"", "three"}},
+	}
+	for _, step := range steps {
+		if err := a.SetUser("u", step.rules); err != nil {
+			t.Fatal(err)
+		}
+		for _, pw := range step.accepts {
+			if !a.Authenticate("u", pw) {
+				t.Errorf("after %q, password %q rejected", step.rules, pw)
+			}
+		}
+		for _, pw := range step.rejects {
+			if a.Authenticate("u", pw) {
+				t.Errorf("after %q, password %q accepted", step.rules, pw)
+			}
+		}
+	}
+	if a.Authenticate("nosuchuser", "") {
+		t.Error("unknown user authenticated")
+	}
+}
+
+func TestAuthRequired(t *testing.T) {
+	a := New(known)
+	if a.AuthRequired() {
+		t.Error("the initial default user requires a password")
+	}
+	if err := a.SetUser("default", []string{">secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if !a.AuthRequired() {
+		t.Error("no authentication required with a password on the default user")
+	}
+	if err := a.SetUser("default", []string{"nopass", "off"}); err != nil {
+		t.Fatal(err)
+	}
+	if !a.AuthRequired() {
+		t.Error("no authentication required with the default user disabled")
+	}
+	if _, err := a.DelUser("default"); err != ErrDefaultUser {
+		t.Errorf("deleting the default user: %v", err)
+	}
+}
+
+func keys(names ...string) [][]byte {
+	k := make([][]byte, len(names))
+	for i, name := range names {
+		k[i] = []byte(name)
+	}
+	return k
+}
+
+func getKey(key string) *Request {
+	return &Request{Command: "get", Categories: []string{"read", "string", "fast"}, Keys: keys(key)}
+}
+
+func setKey(key string) *Request {
+	return &Request{Command: "set", Categories: []string{"write", "string", "slow"}, Keys: keys(key), Write: true}
+}
+
+func lpushKey(key string) *Request {
+	return &Request{Command: "lpush", Categories: []string{"write", "list", "fast"}, Keys: keys(key), Write: true}
+}
+
+func configSub(sub string) *Request {
+	return &Request{Command: "config", Subcommand: sub, Categories: []string{"admin", "slow", "dangerous"}}
+}
+
+func publish(channel string) *Request {
+	return &Request{Command: "publish", Categories: []string{"pubsub", "fast"}, Channels: keys(channel)}
+}
+
+func psubscribe(pattern string) *Request {
+	return &Request{Command: "psubscribe", Categories: []string{"pubsub", "slow"}, Channels: keys(pattern), Patterns: true}
+}
+
+func TestCheck(t *testing.T) {
+	users := map[string][]string{
+		// Batch jobs may only write, and only to jobs:* keys.
+		"jobs": {"on", "nopass", "%W~jobs:*", "+@write"},
+		// Dashboards may read anything and write nothing.
+		"dashboard": {"on", "nopass", "%R~*", "+@read"},
+		"readkeys":  {"on", "nopass", "%R~*", "+@all"},
+		"subcmd":    {"on", "nopass", "~*", "+@all", "-config", "+config|get"},
+		"lastwins":  {"on", "nopass", "~*", "+@all", "-@write", "+set"},
+		"news":      {"on", "nopass", "~*", "resetchannels", "&news.*", "+@all"},
+		"multikey":  {"on", "nopass", "~a", "~b", "+@all"},
+	}
+
+	tests := []struct {
+		user   string
+		req    *Request
+		reason string
+		object string
+	}{
+		{"jobs", setKey("jobs:1"), "", ""},
+		{"jobs", lpushKey("jobs:queue"), "", ""},
+		{"jobs", setKey("other"), "key", "other"},
+		{"jobs", setKey("jobs"), "key", "jobs"},
+		{"jobs", getKey("jobs:1"), "command", "get"},
+		{"jobs", configSub("get"), "command", "config|get"},
+
+		{"dashboard", getKey("jobs:1"), "", ""},
+		{"dashboard", getKey("anything"), "", ""},
+		{"dashboard", setKey("jobs:1"), "command", "set"},
+		{"dashboard", lpushKey("list"), "command", "lpush"},
+		{"dashboard", configSub("set"), "command", "config|set"},
+
+		{"readkeys", getKey("k"), "", ""},
+		{"readkeys", setKey("k"), "key", "k"},
+
+		{"subcmd", configSub("get"), "", ""},
+		{"subcmd", configSub("set"), "command", "config|set"},
+
+		{"lastwins", setKey("k"), "", ""},
+		{"lastwins", lpushKey("k"), "command", "lpush"},
+		{"lastwins", getKey("k"), "", ""},
+
+		{"news", publish("news.sport"), "", ""},
+		{"news", publish("weather"), "channel", "weather"},
+		{"news", psubscribe("news.*"), "", ""},
+		// Patterns must be allowed literally, not merely match.
+		{"news", psubscribe("news.sport"), "channel", "news.sport"},
+		{"news", psubscribe("*"), "channel", "*"},
+		{"default", psubscribe("*"), "", ""},
+
+		{"multikey", &Request{Command: "set", Keys: keys("a", "b")}, "", ""},
+		{"multikey", &Request{Command: "set", Keys: keys("a", "c", "b")}, "key", "c"},
+
+		{"nosuchuser", getKey("k"), "command", "get"},
+	}
+
+	a := New(known)
+	for name, rules := range users {
+		if err := a.SetUser(name, rules); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+	for _, tt := range tests {
+		denial := a.Check(tt.user, tt.req)
+		var reason, object string
+		if denial != nil {
+			reason, object = denial.Reason, denial.Object
+		}
+		if reason != tt.reason || object != tt.object {
+			t.Errorf("%s running %s %s: denied for %q on %q, want %q on %q",
+				tt.user, tt.req.Command, tt.req.Keys, reason, object, tt.reason, tt.object)
+		}
+	}
+}
+
+func TestLoadSave(t *testing.T) {
+	a := New(known)
+	file := "# comment\n\nuser jobs on #" + hashPassword("pw") + " %W~jobs:* resetchannels -@all +@write\n" +
+		"user dashboard on nopass %R~* &* -@all +@read\n"
+	if err := a.Load(strings.NewReader(file), "users.acl"); err != nil {
+		t.Fatal(err)
+	}
+	if !a.Authenticate("jobs", "pw") || a.Check("jobs", setKey("jobs:1")) != nil {
+		t.Error("loaded user jobs lost its permissions")
+	}
+	if !a.Exists("default") || a.AuthRequired() {
+		t.Error("a file without a default user did not get the default one")
+	}
+
+	var saved bytes.Buffer
+	if err := a.Save(&saved); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := New(known)
+	if err := reloaded.Load(&saved, "saved.acl"); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range a.Users() {
+		if got := reloaded.User(u.Name); got == nil || got.String() != u.String() {
+			t.Errorf("%s after a round trip: %v, want %q", u.Name, got, u.String())
+		}
+	}
+
+	for _, bad := range []string{
+		"user jobs on\nuser jobs off\n",
+		"user ok on\nuser broken +nosuch\n",
+		"jobs on\n",
+		"user\n",
+	} {
+		if err := a.Load(strings.NewReader(bad), "bad.acl"); err == nil {
+			t.Errorf("loaded %q", bad)
+		}
+	}
+	if !a.Exists("jobs") || a.Exists("ok") {
+		t.Error("a file that failed to load changed the users")
+	}
+}
+
+func TestLog(t *testing.T) {
+	l := NewLog()
+	l.Add("command", "toplevel", "get", "jobs", "id=1", 3)
+	l.Add("key", "toplevel", "other", "jobs", "id=1", 3)
+	// Repeats of a recent denial update its entry and move it first.
+	l.Add("command", "toplevel", "get", "jobs", "id=2", 3)
+
+	entries := l.Entries(-1)
+	if len(entries) != 2 {
+		t.Fatalf("%d entries, want 2", len(entries))
+	}
+	if e := entries[0]; e.Object != "get" || e.Count != 2 || e.ClientInfo != "id=2" || e.ID != 0 {
+		t.Errorf("grouped entry: %+v", e)
+	}
+	if e := entries[1]; e.Object != "other" || e.Count != 1 || e.ID != 1 {
+		t.Errorf("second entry: %+v", e)
+	}
+	if got := l.Entries(1); len(got) != 1 || got[0].Object != "get" {
+		t.Errorf("Entries(1): %+v", got)
+	}
+
+	// The oldest entries are dropped beyond the maximum length.
+	l.Add("channel", "toplevel", "a", "jobs", "", 3)
+	l.Add("channel", "multi", "b", "jobs", "", 3)
+	entries = l.Entries(-1)
+	if len(entries) != 3 || entries[0].Object != "b" || entries[2].Object != "get" {
+		t.Errorf("after trimming: %+v", entries)
+	}
+
+	l.Reset()
+	if got := l.Entries(-1); len(got) != 0 {
+		t.Errorf("%d entries after Reset", len(got))
+	}
+}
@@ -0,0 +1,84 @@
+package acl
+
+import (
+	"sync"
+	"time"
+)
+
+// logGroupWindow is how long a repeated denial keeps updating the same
+// entry instead of adding a new one.
+const logGroupWindow = 60 * time.Second
+
+// LogEntry records a denied command or failed authentication.
+type LogEntry struct {
+	ID         int64
+	Count      int
+	Reason     string
+	Context    string
+	Object     string
+	Username   string
+	ClientInfo string
+	Created    time.Time
+	Updated    time.Time
+}
+
+// Log keeps the most recent security events, newest first.
+type Log struct {
+	mu      sync.Mutex
+	entries []*LogEntry
+	nextID  int64
+}
+
+func NewLog() *Log {
+	return &Log{}
+}
+
+// Add records an event, folding it into a matching recent entry, and
+// trims the log to maxLen entries.
+func (l *Log) Add(reason, context, object, username, clientInfo string, maxLen int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for i, e := range l.entries {
+		if e.Reason == reason && e.Context == context && e.Object == object &&
+			e.Username == username && now.Sub(e.Updated) < logGroupWindow {
+			e.Count++
+			e.Updated = now
+			e.ClientInfo = clientInfo
+			copy(l.entries[1:i+1], l.entries[:i])
+			l.entries[0] = e
+			return
+		}
+	}
+
+	e := &LogEntry{
+		ID: l.nextID, Count: 1,
+		Reason: reason, Context: context, Object: object, Username: username,
+		ClientInfo: clientInfo, Created: now, Updated: now,
+	}
+	l.nextID++
+	l.entries = append([]*LogEntry{e}, l.entries...)
+	if len(l.entries) > maxLen {
+		l.entries = l.entries[:maxLen]
+	}
+}
+
+// Entries returns copies of up to n of the newest entries; n < 0 means all.
+func (l *Log) Entries(n int) []LogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if n < 0 || n > len(l.entries) {
+		n = len(l.entries)
+	}
+	entries := make([]LogEntry, n)
+	for i := range entries {
+		entries[i] = *l.entries[i]
+	}
+	return entries
+}
+
+func (l *Log) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = nil
+}
@@ -0,0 +1,415 @@
+package acl
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/glob"
+)
+
+// Categories are the ACL command categories Redis defines.
+var Categories = []string{
+	"keyspace", "read", "write", "set", "sortedset", "list", "hash", "string",
+	"bitmap", "hyperloglog", "geo", "stream", "pubsub", "admin", "fast", "slow",
+	"blocking", "dangerous", "connection", "transaction", "scripting",
+}
+
+func isCategory(name string) bool {
+	for _, cat := range Categories {
+		if cat == name {
+			return true
+		}
+	}
+	return false
+}
+
+type keyPattern struct {
+	pattern     string
+	read, write bool
+}
+
+func (p keyPattern) String() string {
+	switch {
+	case p.read && p.write:
+		return "~" + p.pattern
+	case p.read:
+		return "%R~" + p.pattern
+	default:
+		return "%W~" + p.pattern
+	}
+}
+
+// commandRule is one +/- rule. Rules are applied in order, so the last
+// rule matching a command decides whether it is allowed.
+type commandRule struct {
+	allow      bool
+	all        bool
+	category   string
+	command    string
+	subcommand string
+}
+
+func (r commandRule) String() string {
+	sign := "-"
+	if r.allow {
+		sign = "+"
+	}
+	switch {
+	case r.all:
+		return sign + "@all"
+	case r.category != "":
+		return sign + "@" + r.category
+	case r.subcommand != "":
+		return sign + r.command + "|" + r.subcommand
+	default:
+		return sign + r.command
+	}
+}
+
+func (r commandRule) matches(req *Request) bool {
+	switch {
+	case r.all:
+		return true
+	case r.category != "":
+		for _, cat := range req.Categories {
+			if cat == r.category {
+				return true
+			}
+		}
+		return false
+	case r.subcommand != "":
+		return r.command == req.Command && r.subcommand == req.Subcommand
+	default:
+		return r.command == req.Command
+	}
+}
+
+// User is an ACL user. Users are only modified through ACL, which
+// serialises access to them.
+type User struct {
+	Name string
+
+	enabled   bool
+	nopass    bool
+	passwords map[string]struct{} // SHA-256 hex digests
+	commands  []commandRule
+	keys      []keyPattern
+	channels  []string
+}
+
+func newUser(name string) *User {
+	return &User{Name: name, passwords: make(map[string]struct{})}
+}
+
+func (u *User) clone() *User {
+	c := *u
+	c.passwords = make(map[string]struct{}, len(u.passwords))
+	for hash := range u.passwords {
+		c.passwords[hash] = struct{}{}
+	}
+	c.commands = append([]commandRule(nil), u.commands...)
+	c.keys = append([]keyPattern(nil), u.keys...)
+	c.channels = append([]string(nil), u.channels...)
+	return &c
+}
+
+func hashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+func validHash(hash string) bool {
+	if len(hash) != 64 {
+		return false
+	}
+	for i := 0; i < len(hash); i++ {
+		if !(hash[i] >= '0' && hash[i] <= '9' || hash[i] >= 'a' && hash[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// checkPassword compares the digest of password with every stored digest
+// in constant time.
+func (u *User) checkPassword(password string) bool {
+	if u.nopass {
+		return true
+	}
+	given := []byte(hashPassword(password))
+	ok := false
+	for hash := range u.passwords {
+		if subtle.ConstantTimeCompare(given, []byte(hash)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+var errSyntax = errors.New("Syntax error")
+
+// apply applies one ACL SETUSER rule. known reports whether a command, or
+// a command's subcommand when sub is not empty, exists.
+func (u *User) apply(rule string, known func(command, sub string) bool) error {
+	lower := strings.ToLower(rule)
+	switch lower {
+	case "on":
+		u.enabled = true
+	case "off":
+		u.enabled = false
+	case "nopass":
+		u.nopass = true
+		u.passwords = make(map[string]struct{})
+	case "resetpass":
+		u.nopass = false
+		u.passwords = make(map[string]struct{})
+	case "allkeys":
+		u.keys = []keyPattern{{pattern: "*", read: true, write: true}}
+	case "resetkeys":
+		u.keys = nil
+	case "allchannels":
+		u.channels = []string{"*"}
+	case "resetchannels":
+		u.channels = nil
+	case "allcommands":
+		u.commands = []commandRule{{allow: true, all: true}}
+	case "nocommands":
+		u.commands = []commandRule{{all: true}}
+	case "reset":
+		for _, r := range []string{"resetpass", "resetkeys", "resetchannels", "off", "nocommands"} {
+			_ = u.apply(r, known)
+		}
+	default:
+		return u.applyValue(rule, known)
+	}
+	return nil
+}
+
+func (u *User) applyValue(rule string, known func(command, sub string) bool) error {
+	switch {
+	case rule == "":
+		return errSyntax
+	case rule[0] == '>':
+		u.passwords[hashPassword(rule[1:])] = struct{}{}
+		u.nopass = false
+	case rule[0] == '<':
+		hash := hashPassword(rule[1:])
+		if _, ok := u.passwords[hash]; !ok {
+			return errors.New("no such password")
+		}
+		delete(u.passwords, hash)
+	case rule[0] == '#':
+		if !validHash(rule[1:]) {
+			return errors.New("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+		}
+		u.passwords[rule[1:]] = struct{}{}
+		u.nopass = false
+	case rule[0] == '!':
+		if _, ok := u.passwords[rule[1:]]; !ok {
+			return errors.New("no such password")
+		}
+		delete(u.passwords, rule[1:])
+	case rule[0] == '~':
+		return u.addKeyPattern(keyPattern{pattern: rule[1:], read: true, write: true})
+	case rule[0] == '%':
+		perms, pattern, ok := strings.Cut(rule[1:], "~")
+		if !ok || perms == "" {
+			return errSyntax
+		}
+		p := keyPattern{pattern: pattern}
+		for _, perm := range strings.ToUpper(perms) {
+			switch perm {
+			case 'R':
+				p.read = true
+			case 'W':
+				p.write = true
+			default:
+				return errSyntax
+			}
+		}
+		return u.addKeyPattern(p)
+	case rule[0] == '&':
+		if rule[1:] == "*" {
+			u.channels = []string{"*"}
+			return nil
+		}
+		if u.allChannels() {
+			return errors.New("Adding a pattern after the * pattern (or the 'allchannels' flag) is not valid and does not have any effect. Try 'resetchannels' to start with an empty list of channels")
+		}
+		u.channels = append(u.channels, rule[1:])
+	case rule[0] == '+' || rule[0] == '-':
+		return u.applyCommandRule(rule, known)
+	default:
+		return errSyntax
+	}
+	return nil
+}
+
+func (u *User) addKeyPattern(p keyPattern) error {
+	if p.pattern == "*" && p.read && p.write {
+		u.keys = []keyPattern{p}
+		return nil
+	}
+	if u.allKeys() {
+		return errors.New("Adding a pattern after the * pattern (or the 'allkeys' flag) is not valid and does not have any effect. Try 'resetkeys' to start with an empty list of patterns")
+	}
+	u.keys = append(u.keys, p)
+	return nil
+}
+
+func (u *User) allKeys() bool {
+	return len(u.keys) == 1 && u.keys[0].pattern == "*" && u.keys[0].read && u.keys[0].write
+}
+
+func (u *User) allChannels() bool {
+	return len(u.channels) == 1 && u.channels[0] == "*"
+}
+
+func (u *User) applyCommandRule(rule string, known func(command, sub string) bool) error {
+	r := commandRule{allow: rule[0] == '+'}
+	name := strings.ToLower(rule[1:])
+	switch {
+	case name == "@all":
+		r.all = true
+		u.commands = []commandRule{r}
+		return nil
+	case strings.HasPrefix(name, "@"):
+		if !isCategory(name[1:]) {
+			return errors.New("Unknown command or category name in ACL")
+		}
+		r.category = name[1:]
+	default:
+		command, sub, hasSub := strings.Cut(name, "|")
+		if hasSub && (sub == "" || strings.Contains(sub, "|")) {
+			return errSyntax
+		}
+		if !known(command, sub) {
+			return errors.New("Unknown command or category name in ACL")
+		}
+		r.command, r.subcommand = command, sub
+	}
+	u.commands = append(u.commands, r)
+	return nil
+}
+
+func (u *User) canRun(req *Request) bool {
+	allowed := false
+	for _, r := range u.commands {
+		if r.matches(req) {
+			allowed = r.allow
+		}
+	}
+	return allowed
+}
+
+func (u *User) canAccessKey(key []byte, write bool) bool {
+	for _, p := range u.keys {
+		if (write && !p.write) || (!write && !p.read) {
+			continue
+		}
+		if glob.Match(p.pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// canAccessChannel checks a channel, or a subscription pattern, which must
+// be covered literally by one of the user's patterns.
+func (u *User) canAccessChannel(channel []byte, isPattern bool) bool {
+	for _, p := range u.channels {
+		if p == "*" || (isPattern && p == string(channel)) || (!isPattern && glob.Match(p, channel)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Flags returns the user's flags as ACL GETUSER shows them.
+func (u *User) Flags() []string {
+	flags := []string{"off"}
+	if u.enabled {
+		flags[0] = "on"
+	}
+	if u.nopass {
+		flags = append(flags, "nopass")
+	}
+	return flags
+}
+
+// Passwords returns the SHA-256 digests of the user's passwords, sorted.
+func (u *User) Passwords() []string {
+	hashes := make([]string, 0, len(u.passwords))
+	for hash := range u.passwords {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	return hashes
+}
+
+// CommandRules describes the command permissions, always starting from
+// +@all or -@all.
+func (u *User) CommandRules() string {
+	parts := make([]string, 0, len(u.commands)+1)
+	if len(u.commands) == 0 || !u.commands[0].all {
+		parts = append(parts, "-@all")
+	}
+	for _, r := range u.commands {
+		parts = append(parts, r.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+func (u *User) KeyRules() string {
+	parts := make([]string, len(u.keys))
+	for i, p := range u.keys {
+		parts[i] = p.String()
+	}
+	return strings.Join(parts, " ")
+}
+
+func (u *User) ChannelRules() string {
+	parts := make([]string, len(u.channels))
+	for i, p := range u.channels {
+		parts[i] = "&" + p
+	}
+	return strings.Join(parts, " ")
+}
+
+// String returns the user the way ACL LIST and ACL files describe it.
+func (u *User) String() string {
+	parts := []string{"user", u.Name}
+	parts = append(parts, u.Flags()...)
+	for _, hash := range u.Passwords() {
+		parts = append(parts, "#"+hash)
+	}
+	if keys := u.KeyRules(); keys != "" {
+		parts = append(parts, keys)
+	}
+	if channels := u.ChannelRules(); channels != "" {
+		parts = append(parts, channels)
+	} else {
+		parts = append(parts, "resetchannels")
+	}
+	parts = append(parts, u.CommandRules())
+	return strings.Join(parts, " ")
+}
+
+// RuleError reports the rule ACL SETUSER rejected.
+type RuleError struct {
+	Rule string
+	Err  error
+}
+
+func (e *RuleError) Error() string {
+	return fmt.Sprintf("Error in ACL SETUSER modifier '%s': %s", e.Rule, e.Err)
+}
+
+func (e *RuleError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,210 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+)
+
+// replyError returns the message of the error reply err holds, or "".
+func replyError(err error) string {
+	var replyErr *protocol.Error
+	if errors.As(err, &replyErr) {
+		return replyErr.Message
+	}
+	return ""
+}
+
+func TestACLPermissions(t *testing.T) {
+	addr := startServer(t)
+	admin := dial(t, addr, nil)
+	for _, rules := range [][]string{
+		{"jobs", "on", ">jobs-pw", "%W~jobs:*", "+@write"},
+		{"dashboard", "on", ">dash-pw", "%R~*", "+@read", "+@connection"},
+	} {
+		if _, err := admin.Do(append([]string{"ACL", "SETUSER"}, rules...)...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := admin.Do("SET", "jobs:1", "queued"); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs := dial(t, addr, &client.Options{Username: "jobs", Password: "jobs-pw"})
+	dashboard := dial(t, addr, &client.Options{Username: "dashboard", Password: "dash-pw"})
+	tests := []struct {
+		conn *client.Conn
+		cmd  []string
+		err  string
+	}{
+		{jobs, []string{"SET", "jobs:1", "done"}, ""},
+		{jobs, []string{"RPUSH", "jobs:queue", "a"}, ""},
+		{jobs, []string{"XADD", "jobs:stream", "*", "f", "v"}, ""},
+		{jobs, []string{"SET", "other", "x"}, "NOPERM No permissions to access a key"},
+		{jobs, []string{"GET", "jobs:1"}, "NOPERM User jobs has no permissions to run the 'get' command"},
+		{jobs, []string{"CONFIG", "GET", "port"}, "NOPERM User jobs has no permissions to run the 'config|get' command"},
+		{dashboard, []string{"GET", "jobs:1"}, ""},
+		{dashboard, []string{"LRANGE", "jobs:queue", "0", "-1"}, ""},
+		{dashboard, []string{"XRANGE", "jobs:stream", "-", "+"}, ""},
+		{dashboard, []string{"ACL", "WHOAMI"}, "NOPERM User dashboard has no permissions to run the 'acl|whoami' command"},
+		{dashboard, []string{"PING"}, ""},
+		{dashboard, []string{"SET", "jobs:1", "x"}, "NOPERM User dashboard has no permissions to run the 'set' command"},
+		{dashboard, []string{"RPUSH", "jobs:queue", "b"}, "NOPERM User dashboard has no permissions to run the 'rpush' command"},
+	}
+	for _, tt := range tests {
+		_, err := tt.conn.Do(tt.cmd...)
+		if got := replyError(err); got != tt.err || (tt.err == "" && err != nil) {
+			t.Errorf("%q: %v, want %q", tt.cmd, err, tt.err)
+		}
+	}
+	if got, err := client.String(admin.Do("GET", "jobs:1")); err != nil || got != "done" {
+		t.Errorf("GET jobs:1: %q, %v", got, err)
+	}
+
+	// Denied commands abort a transaction when queued, and fail on their
+	// own if permissions change before EXEC.
+	if _, err := admin.Do("ACL", "SETUSER", "jobs", "+@transaction"); err != nil {
+		t.Fatal(err)
+	}
+	replies, err := jobs.Pipeline([]string{"MULTI"}, []string{"SET", "jobs:1", "x"}, []string{"GET", "jobs:1"}, []string{"EXEC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := errorPrefix(replies[3]); got != "EXECABORT" {
+		t.Errorf("EXEC after a denied command: %#v, want EXECABORT", replies[3])
+	}
+	if _, err := jobs.Do("MULTI"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jobs.Do("SET", "jobs:1", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := admin.Do("ACL", "SETUSER", "jobs", "-set"); err != nil {
+		t.Fatal(err)
+	}
+	exec, err := jobs.Do("EXEC")
+	if array, ok := exec.(*protocol.Array); err != nil || !ok || len(array.Elements) != 1 || errorPrefix(array.Elements[0]) != "NOPERM" {
+		t.Errorf("EXEC of a command denied since it was queued: %#v, %v", exec, err)
+	}
+}
+
+func TestACLLog(t *testing.T) {
+	addr := startServer(t)
+	admin := dial(t, addr, &client.Options{Protocol: 3})
+	if _, err := admin.Do("ACL", "SETUSER", "jobs", "on", ">pw", "%W~jobs:*", "+@write"); err != nil {
+		t.Fatal(err)
+	}
+	jobs := dial(t, addr, &client.Options{Username: "jobs", Password: "pw"})
+	for range 3 {
+		_, _ = jobs.Do("GET", "jobs:1")
+	}
+	_, _ = jobs.Do("SET", "other", "x")
+	if _, err := dial(t, addr, nil).Do("AUTH", "jobs", "wrong"); err == nil {
+		t.Error("AUTH with a wrong password succeeded")
+	}
+
+	reply, err := admin.Do("ACL", "LOG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, ok := reply.(*protocol.Array)
+	if !ok {
+		t.Fatalf("ACL LOG: %#v", reply)
+	}
+	want := []map[string]string{
+		{"reason": "auth", "context": "toplevel", "object": "AUTH", "username": "jobs", "count": "1"},
+		{"reason": "key", "context": "toplevel", "object": "other", "username": "jobs", "count": "1"},
+		{"reason": "command", "context": "toplevel", "object": "get", "username": "jobs", "count": "3"},
+	}
+	if len(entries.Elements) != len(want) {
+		t.Fatalf("%d entries, want %d", len(entries.Elements), len(want))
+	}
+	for i, w := range want {
+		got, err := client.StringMap(entries.Elements[i], nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for field, value := range w {
+			if got[field] != value {
+				t.Errorf("entry %d %s: %q, want %q", i, field, got[field], value)
+			}
+		}
+	}
+
+	if reply, err := admin.Do("ACL", "LOG", "1"); err != nil || len(reply.(*protocol.Array).Elements) != 1 {
+		t.Errorf("ACL LOG 1: %#v, %v", reply, err)
+	}
+	if _, err := admin.Do("ACL", "LOG", "RESET"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := client.Strings(admin.Do("ACL", "LOG")); err != nil || len(got) != 0 {
+		t.Errorf("ACL LOG after RESET: %q, %v", got, err)
+	}
+}
+
+func TestACLUsers(t *testing.T) {
+	sum := sha256.Sum256([]byte("pw"))
+	pwHash := hex.EncodeToString(sum[:])
+	addr := startServer(t)
+	admin := dial(t, addr, nil)
+
+	if _, err := admin.Do("ACL", "SETUSER", "jobs", "on", ">pw", "~jobs:*", "+@nosuch"); replyError(err) == "" {
+		t.Errorf("invalid rule: %v, want an error", err)
+	}
+	if got, err := client.Strings(admin.Do("ACL", "USERS")); err != nil || !slices.Equal(got, []string{"default"}) {
+		t.Errorf("ACL USERS after an invalid SETUSER: %q, %v", got, err)
+	}
+	if _, err := admin.Do("ACL", "SETUSER", "jobs", "on", ">pw", "~jobs:*", "+@list", "-lpush"); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := admin.Do("ACL", "GETUSER", "jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The reply is a map, which RESP2 flattens, of strings and arrays.
+	user := make(map[string]string)
+	for fields := reply.(*protocol.Array).Elements; len(fields) >= 2; fields = fields[2:] {
+		name, _ := client.String(fields[0], nil)
+		if values, err := client.Strings(fields[1], nil); err == nil {
+			user[name] = strings.Join(values, " ")
+		} else {
+			user[name], _ = client.String(fields[1], nil)
+		}
+	}
+	if user["flags"] != "on" || user["passwords"] != pwHash || user["commands"] != "-@all +@list -lpush" ||
+		user["keys"] != "~jobs:*" || user["channels"] != "" {
+		t.Errorf("ACL GETUSER: %q", user)
+	}
+	if got, err := client.Strings(admin.Do("ACL", "LIST")); err != nil || len(got) != 2 || got[1] != "user jobs on #"+pwHash+" ~jobs:* resetchannels -@all +@list -lpush" {
+		t.Errorf("ACL LIST: %q, %v", got, err)
+	}
+
+	jobs := dial(t, addr, &client.Options{Username: "jobs", Password: "pw"})
+	if got, err := client.String(jobs.Do("ACL", "WHOAMI")); replyError(err) == "" {
+		t.Errorf("ACL WHOAMI without @connection: %q, %v, want an error", got, err)
+	}
+	if got, err := client.String(admin.Do("ACL", "WHOAMI")); err != nil || got != "default" {
+		t.Errorf("ACL WHOAMI: %q, %v", got, err)
+	}
+	cat, err := client.Strings(admin.Do("ACL", "CAT", "list"))
+	if err != nil || !slices.Contains(cat, "rpush") || slices.Contains(cat, "get") {
+		t.Errorf("ACL CAT list: %q, %v", cat, err)
+	}
+
+	// Deleting a user disconnects its connections.
+	if n, err := client.Int64(admin.Do("ACL", "DELUSER", "jobs", "nosuchuser")); err != nil || n != 1 {
+		t.Errorf("ACL DELUSER: %d, %v", n, err)
+	}
+	if _, err := jobs.Do("PING"); err == nil || replyError(err) != "" {
+		t.Errorf("PING by a deleted user: %v, want the connection closed", err)
+	}
+	if _, err := admin.Do("ACL", "DELUSER", "default"); replyError(err) == "" {
+		t.Errorf("deleting the default user: %v, want an error", err)
+	}
+}
@@ -0,0 +1,131 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+)
+
+// authCommand implements AUTH [username] password.
+func authCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	if len(args) > 2 {
+		return nil, &protocol.Error{Message: "ERR syntax error"}
+	}
+	username, password := "default", string(args[len(args)-1])
+	if len(args) == 2 {
+		username = string(args[0])
+	}
+
+	if len(args) == 1 && s.ACL.DefaultHasNoPassword() {
+		return nil, &protocol.Error{Message: "ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?"}
+	}
+	if err := s.authenticate(c, username, password); err != nil {
+		return nil, err
+	}
+	return &protocol.SimpleString{Data: "OK"}, nil
+}
+
+// authenticate logs c in as username, recording failures.
+func (s *Server) authenticate(c *Client, username, password string) *protocol.Error {
+	if !s.ACL.Authenticate(username, password) {
+		s.stats.authFailures.Add(1)
+		s.ACL.Log.Add("auth", "toplevel", "AUTH", username, c.info(false), int(s.Config.Int("acllog-max-len")))
+		return &protocol.Error{Message: "WRONGPASS invalid username-password pair or user is disabled."}
+	}
+	c.mu.Lock()
+	c.user = username
+	c.mu.Unlock()
+	c.authenticated = true
+	return nil
+}
+
+// helloCommand implements HELLO [protover [AUTH username password]
+// [SETNAME clientname]], which switches protocol version and replies with
+// information about the server.
+func helloCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	version := c.rp.Version()
+	if len(args) > 0 {
+		v, err := strconv.Atoi(string(args[0]))
+		if err != nil {
+			return nil, &protocol.Error{Message: "ERR Protocol version is not an integer or out of range"}
+		}
+		if v < 2 || v > 3 {
+			return nil, &protocol.Error{Message: "NOPROTO unsupported protocol version"}
+		}
+		version = v
+	}
+
+	var username, password, name string
+	auth, setName := false, false
+	for i := 1; i < len(args); i++ {
+		switch opt := strings.ToUpper(string(args[i])); {
+		case opt == "AUTH" && i+2 < len(args):
+			auth, username, password = true, string(args[i+1]), string(args[i+2])
+			i += 2
+		case opt == "SETNAME" && i+1 < len(args):
+			setName, name = true, string(args[i+1])
+			i++
+		default:
+			return nil, &protocol.Error{Message: fmt.Sprintf("ERR Syntax error in HELLO option '%s'", args[i])}
+		}
+	}
+
+	if auth {
+		if err := s.authenticate(c, username, password); err != nil {
+			return nil, err
+		}
+	}
+	if !c.authenticated && s.ACL.AuthRequired() {
+		return nil, &protocol.Error{Message: "NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time"}
+	}
+	if setName {
+		if !validClientName(name) {
+			return nil, &protocol.Error{Message: "ERR Client names cannot contain spaces, newlines or special characters."}
+		}
+		c.mu.Lock()
+		c.name = name
+		c.mu.Unlock()
+	}
+
+	c.rp.SetVersion(version)
+	role := "master"
+	if s.isReplica() {
+		role = "replica"
+	}
+	return &protocol.Map{Entries: []protocol.MapEntry{
+		field("server", &protocol.BulkString{Data: "redis"}),
+		field("version", &protocol.BulkString{Data: redisVersion}),
+		field("proto", &protocol.IntegerBulkString{Data: int64(version)}),
+		field("id", &protocol.IntegerBulkString{Data: c.id}),
+		field("mode", &protocol.BulkString{Data: "standalone"}),
+		field("role", &protocol.BulkString{Data: role}),
+		field("modules", &protocol.Array{Elements: []protocol.RespValue{}}),
+	}}, nil
+}
+
+var redactedArg = []byte("(redacted)")
+
+// redactArgs hides the credentials in AUTH and HELLO, which would otherwise
+// show up in SLOWLOG and MONITOR.
+func redactArgs(cmd *Command, argv [][]byte) [][]byte {
+	if cmd.Name != "auth" && cmd.Name != "hello" {
+		return argv
+	}
+	redacted := append([][]byte(nil), argv...)
+	if cmd.Name == "auth" {
+		for i := 1; i < len(redacted); i++ {
+			redacted[i] = redactedArg
+		}
+		return redacted
+	}
+	for i := 2; i+2 < len(redacted); i++ {
+		if bytes.EqualFold(redacted[i], []byte("AUTH")) {
+			redacted[i+1], redacted[i+2] = redactedArg, redactedArg
+			break
+		}
+	}
+	return redacted
+}
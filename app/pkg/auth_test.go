@@ -0,0 +1,93 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+)
+
+func TestRequirepass(t *testing.T) {
+	_, addrs := startServerArgs(t, "--requirepass", "secret")
+	addr := addrs[0]
+	c := dial(t, addr, nil)
+
+	for _, cmd := range [][]string{{"GET", "k"}, {"PING"}, {"CLIENT", "ID"}, {"MULTI"}} {
+		if _, err := c.Do(cmd...); replyError(err) != "NOAUTH Authentication required." {
+			t.Errorf("%q before AUTH: %v, want NOAUTH", cmd, err)
+		}
+	}
+	if _, err := c.Do("HELLO", "3"); !strings.HasPrefix(replyError(err), "NOAUTH HELLO must be called") {
+		t.Errorf("HELLO 3 before AUTH: %v, want NOAUTH", err)
+	}
+	for _, args := range [][]string{{"wrong"}, {"default", "wrong"}, {"nosuchuser", "secret"}} {
+		if _, err := c.Do(append([]string{"AUTH"}, args...)...); replyError(err) != "WRONGPASS invalid username-password pair or user is disabled." {
+			t.Errorf("AUTH %q: %v, want WRONGPASS", args, err)
+		}
+	}
+	if _, err := c.Do("GET", "k"); replyError(err) != "NOAUTH Authentication required." {
+		t.Errorf("GET after a failed AUTH: %v, want NOAUTH", err)
+	}
+	if got, err := client.String(c.Do("AUTH", "secret")); err != nil || got != "OK" {
+		t.Fatalf("AUTH secret: %q, %v", got, err)
+	}
+	if got, err := client.String(c.Do("PING")); err != nil || got != "PONG" {
+		t.Errorf("PING after AUTH: %q, %v", got, err)
+	}
+
+	// HELLO authenticates and switches protocol at once, and the client
+	// package authenticates with AUTH or HELLO depending on the protocol.
+	hello := dial(t, addr, nil)
+	reply, err := hello.Do("HELLO", "3", "AUTH", "default", "secret", "SETNAME", "h")
+	if _, ok := reply.(*protocol.Map); err != nil || !ok {
+		t.Fatalf("HELLO 3 AUTH: %#v, %v", reply, err)
+	}
+	if got, err := client.String(hello.Do("CLIENT", "GETNAME")); err != nil || got != "h" {
+		t.Errorf("CLIENT GETNAME after HELLO: %q, %v", got, err)
+	}
+	for _, version := range []int{2, 3} {
+		conn := dial(t, addr, &client.Options{Password: "secret", Protocol: version})
+		if _, err := conn.Do("SET", "k", "v"); err != nil {
+			t.Errorf("SET over RESP%d: %v", version, err)
+		}
+	}
+
+	// Changing requirepass applies to new connections.
+	if _, err := c.Do("CONFIG", "SET", "requirepass", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := client.String(dial(t, addr, nil).Do("GET", "k")); err != nil || got != "v" {
+		t.Errorf("GET without requirepass: %q, %v", got, err)
+	}
+	if _, err := c.Do("CONFIG", "SET", "requirepass", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if conn, err := client.Dial(t.Context(), "tcp", addr, &client.Options{Password: "secret"}); replyError(err) == "" {
+		t.Errorf("dialing with the previous password: %v, want WRONGPASS", err)
+		if err == nil {
+			conn.Close()
+		}
+	}
+	if _, err := dial(t, addr, nil).Do("GET", "k"); replyError(err) != "NOAUTH Authentication required." {
+		t.Errorf("GET after setting requirepass: %v, want NOAUTH", err)
+	}
+	// Connections that already authenticated stay authenticated.
+	if _, err := c.Do("GET", "k"); err != nil {
+		t.Errorf("GET by a client authenticated earlier: %v", err)
+	}
+}
+
+func TestAuthWithoutPassword(t *testing.T) {
+	c := dial(t, startServer(t), nil)
+	if _, err := c.Do("GET", "k"); err != nil {
+		t.Errorf("GET without requirepass: %v", err)
+	}
+	if _, err := c.Do("AUTH", "pw"); !strings.HasPrefix(replyError(err), "ERR AUTH <password> called without any password configured") {
+		t.Errorf("AUTH pw: %v", err)
+	}
+	// The default user accepts any password when it has none.
+	if got, err := client.String(c.Do("AUTH", "default", "pw")); err != nil || got != "OK" {
+		t.Errorf("AUTH default pw: %q, %v", got, err)
+	}
+}
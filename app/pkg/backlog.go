@@ -0,0 +1,57 @@
+package pkg
+
+// backlog is a circular buffer holding the most recent bytes of the
+// replication stream, so a replica that briefly disconnects can continue
+// from its offset instead of resynchronising the whole dataset.
+type backlog struct {
+	buf     []byte
+	next    int
+	histLen int
+}
+
+func newBacklog(size int) *backlog {
+	return &backlog{buf: make([]byte, size)}
+}
+
+func (b *backlog) size() int {
+	return len(b.buf)
+}
+
+func (b *backlog) write(p []byte) {
+	if len(p) >= len(b.buf) {
+		copy(b.buf, p[len(p)-len(b.buf):])
+		b.next = 0
+		b.histLen = len(b.buf)
+		return
+	}
+	n := copy(b.buf[b.next:], p)
+	if n < len(p) {
+		copy(b.buf, p[n:])
+	}
+	b.next = (b.next + len(p)) % len(b.buf)
+	b.histLen = min(b.histLen+len(p), len(b.buf))
+}
+
+// last returns a copy of the last n bytes written. n must not exceed histLen.
+func (b *backlog) last(n int) []byte {
+	out := make([]byte, n)
+	start := (b.next - n + len(b.buf)) % len(b.buf)
+	copied := copy(out, b.buf[start:])
+	if copied < n {
+		copy(out[copied:], b.buf[:n-copied])
+	}
+	return out
+}
+
+// resize changes the capacity, keeping as much recent history as fits.
+func (b *backlog) resize(size int) {
+	if size == len(b.buf) {
+		return
+	}
+	keep := min(b.histLen, size)
+	history := b.last(keep)
+	b.buf = make([]byte, size)
+	b.next = 0
+	b.histLen = 0
+	b.write(history)
+}
@@ -0,0 +1,477 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+)
+
+// Client holds the state of a single connection.
+type Client struct {
+	rp *protocol.RespProtocol
+
+	// closed is closed with the connection, cancelling blocking commands.
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	// id is assigned when the client is registered with the server.
+	id        int64
+	createdAt time.Time
+	unix      bool
+
+	// mu guards the fields other connections read through CLIENT LIST.
+	mu              sync.Mutex
+	name            string
+	libName         string
+	libVer          string
+	user            string
+	db              int
+	lastCmd         string
+	lastInteraction time.Time
+	blocked         bool
+	monitor         bool
+	sub, psub       int
+	multiLen        int
+
+	// closeAfterReply makes the connection close once the current reply is written.
+	closeAfterReply bool
+
+	// authenticated is set once AUTH succeeds, or at connect time when no
+	// password is required.
+	authenticated bool
+
+	multi  *multiState
+	inExec bool
+
+	// watched and dirty are guarded by Server.watchMu.
+	watched map[string]struct{}
+	dirty   bool
+
+	channels map[string]struct{}
+	patterns map[string]struct{}
+
+	// primary is set on the link a replica uses to receive the primary's writes.
+	primary bool
+	// link is set, under the server's clientsMu, once c is counted as a
+	// primary or replica link rather than towards maxclients.
+	link              bool
+	replListeningPort string
+	// multiPropagated records that EXEC already sent MULTI to the replicas.
+	multiPropagated bool
+	// replOffset is the replication offset after this client's last
+	// propagated write, which WAIT waits for.
+	replOffset int64
+}
+
+func newClient(rp *protocol.RespProtocol) *Client {
+	now := time.Now()
+	_, unix := rp.Conn.(*net.UnixConn)
+	return &Client{
+		rp:              rp,
+		unix:            unix,
+		closed:          make(chan struct{}),
+		createdAt:       now,
+		user:            "default",
+		lastInteraction: now,
+		multiLen:        -1,
+		watched:         make(map[string]struct{}),
+		channels:        make(map[string]struct{}),
+		patterns:        make(map[string]struct{}),
+	}
+}
+
+// addr returns the peer address. Unix socket peers have none, so like
+// Redis it reports the socket path.
+func (c *Client) addr() string {
+	if c.unix {
+		return c.laddr()
+	}
+	return c.rp.Conn.RemoteAddr().String()
+}
+
+func (c *Client) laddr() string {
+	if c.unix {
+		return c.rp.Conn.LocalAddr().String() + ":0"
+	}
+	return c.rp.Conn.LocalAddr().String()
+}
+
+// pushOutputLimit is how many bytes of messages pushed by other
+// connections, such as published messages, may wait for a slow client
+// before it is disconnected.
+const pushOutputLimit = 32 << 20
+
+// Write sends a reply immediately.
+func (c *Client) Write(value protocol.RespValue) error {
+	return c.rp.Write(value)
+}
+
+// reply queues the reply to a command. Replies are flushed once no more
+// pipelined commands are waiting, or sooner when they add up.
+func (c *Client) reply(value protocol.RespValue) error {
+	return c.rp.Buffer(value)
+}
+
+// writeRaw sends bytes that are already RESP encoded.
+func (c *Client) writeRaw(data []byte) error {
+	return c.rp.WriteRaw(data)
+}
+
+// push sends value on behalf of another connection without waiting for
+// this one, and disconnects the client if too much is already waiting.
+func (c *Client) push(value protocol.RespValue) {
+	if !c.rp.Push(value, pushOutputLimit) {
+		fmt.Println("Disconnecting client that is too far behind:", c.addr())
+		_ = c.Close()
+	}
+}
+
+// Deliver implements pubsub.Subscriber.
+func (c *Client) Deliver(msg protocol.RespValue) {
+	c.push(msg)
+}
+
+func (c *Client) subscriptionCount() int {
+	return len(c.channels) + len(c.patterns)
+}
+
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.rp.Close()
+}
+
+func (c *Client) setLastCommand(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastCmd = name
+}
+
+func (c *Client) setBlocked(blocked bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.blocked = blocked
+}
+
+// commandDone publishes the state a command may have changed to CLIENT LIST.
+func (c *Client) commandDone() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastInteraction = time.Now()
+	c.sub, c.psub = len(c.channels), len(c.patterns)
+	c.multiLen = -1
+	if c.multi != nil {
+		c.multiLen = len(c.multi.commands)
+	}
+}
+
+func (c *Client) Name() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.name
+}
+
+func (c *Client) isBlocked() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.blocked
+}
+
+func (c *Client) User() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.user
+}
+
+// kind is the type CLIENT KILL TYPE and CLIENT LIST TYPE filter on.
+func (c *Client) kind(replica bool) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case c.primary:
+		return "master"
+	case replica:
+		return "replica"
+	case c.sub+c.psub > 0:
+		return "pubsub"
+	default:
+		return "normal"
+	}
+}
+
+// info formats c the way CLIENT LIST and CLIENT INFO show it.
+func (c *Client) info(replica bool) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	flags := ""
+	if c.primary {
+		flags += "M"
+	}
+	if replica {
+		flags += "S"
+	}
+	if c.sub+c.psub > 0 {
+		flags += "P"
+	}
+	if c.multiLen >= 0 {
+		flags += "x"
+	}
+	if c.blocked {
+		flags += "b"
+	}
+	if c.monitor {
+		flags += "O"
+	}
+	if c.unix {
+		flags += "U"
+	}
+	if flags == "" {
+		flags = "N"
+	}
+	cmd := c.lastCmd
+	if cmd == "" {
+		cmd = "NULL"
+	}
+	now := time.Now()
+	return fmt.Sprintf("id=%d addr=%s laddr=%s name=%s age=%d idle=%d flags=%s db=%d sub=%d psub=%d multi=%d cmd=%s user=%s resp=%d lib-name=%s lib-ver=%s",
+		c.id, c.addr(), c.laddr(), c.name,
+		int64(now.Sub(c.createdAt)/time.Second), int64(now.Sub(c.lastInteraction)/time.Second),
+		flags, c.db, c.sub, c.psub, c.multiLen, cmd, c.user, c.rp.Version(), c.libName, c.libVer)
+}
+
+// validClientName reports whether name may be used with CLIENT SETNAME
+// and CLIENT SETINFO: no spaces, newlines or other special characters.
+func validClientName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < '!' || name[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// snapshotClients returns the registered clients in id order, along with
+// the set of those that are replicas.
+func (s *Server) snapshotClients() ([]*Client, map[*Client]bool) {
+	s.repl.mu.Lock()
+	replicas := make(map[*Client]bool, len(s.repl.replicas))
+	for c := range s.repl.replicas {
+		replicas[c] = true
+	}
+	s.repl.mu.Unlock()
+
+	s.clientsMu.Lock()
+	clients := make([]*Client, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.clientsMu.Unlock()
+	sort.Slice(clients, func(i, j int) bool { return clients[i].id < clients[j].id })
+	return clients, replicas
+}
+
+func clientCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	sub := strings.ToUpper(string(args[0]))
+	switch sub {
+	case "ID":
+		if len(args) != 1 {
+			return nil, subcommandArityError("client", sub)
+		}
+		return &protocol.IntegerBulkString{Data: c.id}, nil
+
+	case "INFO":
+		if len(args) != 1 {
+			return nil, subcommandArityError("client", sub)
+		}
+		_, replicas := s.snapshotClients()
+		return &protocol.VerbatimString{Format: "txt", Data: c.info(replicas[c]) + "\n"}, nil
+
+	case "LIST":
+		return clientList(s, args[1:])
+
+	case "GETNAME":
+		if len(args) != 1 {
+			return nil, subcommandArityError("client", sub)
+		}
+		if name := c.Name(); name != "" {
+			return &protocol.BulkString{Data: name}, nil
+		}
+		return &protocol.NullBulkString{}, nil
+
+	case "SETNAME":
+		if len(args) != 2 {
+			return nil, subcommandArityError("client", sub)
+		}
+		if !validClientName(string(args[1])) {
+			return nil, &protocol.Error{Message: "ERR Client names cannot contain spaces, newlines or special characters."}
+		}
+		c.mu.Lock()
+		c.name = string(args[1])
+		c.mu.Unlock()
+		return &protocol.SimpleString{Data: "OK"}, nil
+
+	case "SETINFO":
+		if len(args) != 3 {
+			return nil, subcommandArityError("client", sub)
+		}
+		attr := strings.ToUpper(string(args[1]))
+		if attr != "LIB-NAME" && attr != "LIB-VER" {
+			return nil, &protocol.Error{Message: fmt.Sprintf("ERR Unrecognized option '%s'", args[1])}
+		}
+		if !validClientName(string(args[2])) {
+			return nil, &protocol.Error{Message: fmt.Sprintf("ERR %s cannot contain spaces, newlines or special characters.", strings.ToLower(attr))}
+		}
+		c.mu.Lock()
+		if attr == "LIB-NAME" {
+			c.libName = string(args[2])
+		} else {
+			c.libVer = string(args[2])
+		}
+		c.mu.Unlock()
+		return &protocol.SimpleString{Data: "OK"}, nil
+
+	case "KILL":
+		return clientKill(s, c, args[1:])
+
+	default:
+		return nil, &protocol.Error{Message: fmt.Sprintf("ERR unknown subcommand '%s'. Try CLIENT HELP.", args[0])}
+	}
+}
+
+func subcommandArityError(cmd, sub string) *protocol.Error {
+	return &protocol.Error{Message: fmt.Sprintf("ERR wrong number of arguments for '%s|%s' command", cmd, strings.ToLower(sub))}
+}
+
+// clientList implements CLIENT LIST [TYPE type] [ID id ...].
+func clientList(s *Server, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	var typ string
+	var ids map[int64]bool
+	switch {
+	case len(args) == 0:
+	case len(args) == 2 && bytes.EqualFold(args[0], []byte("TYPE")):
+		typ = strings.ToLower(string(args[1]))
+		if typ == "slave" {
+			typ = "replica"
+		}
+		if typ != "normal" && typ != "master" && typ != "replica" && typ != "pubsub" {
+			return nil, &protocol.Error{Message: fmt.Sprintf("ERR Unknown client type '%s'", args[1])}
+		}
+	case len(args) >= 2 && bytes.EqualFold(args[0], []byte("ID")):
+		ids = make(map[int64]bool, len(args)-1)
+		for _, arg := range args[1:] {
+			id, err := strconv.ParseInt(string(arg), 10, 64)
+			if err != nil || id <= 0 {
+				return nil, &protocol.Error{Message: "ERR Invalid client ID"}
+			}
+			ids[id] = true
+		}
+	default:
+		return nil, &protocol.Error{Message: "ERR syntax error"}
+	}
+
+	clients, replicas := s.snapshotClients()
+	var sb strings.Builder
+	for _, other := range clients {
+		if ids != nil && !ids[other.id] {
+			continue
+		}
+		if typ != "" && other.kind(replicas[other]) != typ {
+			continue
+		}
+		sb.WriteString(other.info(replicas[other]))
+		sb.WriteByte('\n')
+	}
+	return &protocol.VerbatimString{Format: "txt", Data: sb.String()}, nil
+}
+
+// clientKill implements both CLIENT KILL addr:port, which replies OK, and
+// CLIENT KILL <filter> <value> ..., which replies with the number of
+// clients killed.
+func clientKill(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	if len(args) == 0 {
+		return nil, subcommandArityError("client", "KILL")
+	}
+
+	var id int64
+	var addr, laddr, user, typ string
+	skipMe := true
+	legacy := len(args) == 1
+	if legacy {
+		addr, skipMe = string(args[0]), false
+	} else {
+		if len(args)%2 != 0 {
+			return nil, &protocol.Error{Message: "ERR syntax error"}
+		}
+		for i := 0; i < len(args); i += 2 {
+			value := string(args[i+1])
+			switch strings.ToUpper(string(args[i])) {
+			case "ID":
+				n, err := strconv.ParseInt(value, 10, 64)
+				if err != nil || n <= 0 {
+					return nil, &protocol.Error{Message: "ERR client-id should be greater than 0"}
+				}
+				id = n
+			case "ADDR":
+				addr = value
+			case "LADDR":
+				laddr = value
+			case "USER":
+				user = value
+			case "TYPE":
+				typ = strings.ToLower(value)
+				if typ == "slave" {
+					typ = "replica"
+				}
+				if typ != "normal" && typ != "master" && typ != "replica" && typ != "pubsub" {
+					return nil, &protocol.Error{Message: fmt.Sprintf("ERR Unknown client type '%s'", value)}
+				}
+			case "SKIPME":
+				switch strings.ToLower(value) {
+				case "yes":
+					skipMe = true
+				case "no":
+					skipMe = false
+				default:
+					return nil, &protocol.Error{Message: "ERR syntax error"}
+				}
+			default:
+				return nil, &protocol.Error{Message: "ERR syntax error"}
+			}
+		}
+	}
+
+	clients, replicas := s.snapshotClients()
+	killed := 0
+	for _, other := range clients {
+		switch {
+		case id != 0 && other.id != id,
+			addr != "" && other.addr() != addr,
+			laddr != "" && other.laddr() != laddr,
+			user != "" && other.User() != user,
+			typ != "" && other.kind(replicas[other]) != typ,
+			skipMe && other == c:
+			continue
+		}
+		if other == c {
+			c.closeAfterReply = true
+		} else {
+			_ = other.Close()
+		}
+		killed++
+	}
+
+	if legacy {
+		if killed == 0 {
+			return nil, &protocol.Error{Message: "ERR No such client"}
+		}
+		return &protocol.SimpleString{Data: "OK"}, nil
+	}
+	return &protocol.IntegerBulkString{Data: int64(killed)}, nil
+}
@@ -0,0 +1,297 @@
+// Package client is a client for this server, and for Redis, over TCP,
+// TLS or Unix sockets. It supports RESP2 and RESP3, pipelining, blocking
+// commands, pub/sub and connection pooling.
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+)
+
+// Default timeouts, used where Options leaves a timeout zero.
+const (
+	DefaultDialTimeout  = 5 * time.Second
+	DefaultReadTimeout  = 3 * time.Second
+	DefaultWriteTimeout = 3 * time.Second
+)
+
+// ErrClosed is returned by a connection that was closed, or broken by an
+// earlier error.
+var ErrClosed = errors.New("client: connection closed")
+
+// Options configures connections. Timeouts left zero use the defaults; a
+// negative timeout disables it.
+type Options struct {
+	// Username and Password authenticate the connection. Username defaults
+	// to "default".
+	Username string
+	Password string
+	// Protocol is the RESP version to use, 2 (the default) or 3.
+	Protocol int
+	// ClientName is set with CLIENT SETNAME, or HELLO for RESP3.
+	ClientName string
+
+	TLSConfig *tls.Config
+
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// OnPush receives RESP3 push messages that arrive between replies,
+	// outside of pub/sub. Without it they are dropped.
+	OnPush func(*protocol.Push)
+
+	// PoolSize is the most connections a Pool opens, 10 by default.
+	PoolSize int
+}
+
+func timeout(d, def time.Duration) time.Duration {
+	switch {
+	case d == 0:
+		return def
+	case d < 0:
+		return 0
+	default:
+		return d
+	}
+}
+
+// Conn is a connection to the server. It is not safe for concurrent use;
+// use a Pool to share connections between goroutines.
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+	enc  *protocol.Encoder
+	opts Options
+
+	// pending counts the commands sent whose replies are still to be read.
+	pending int
+	// err is set once the connection can no longer be used.
+	err error
+	// subscribed is set once the connection enters pub/sub mode.
+	subscribed bool
+}
+
+// Dial connects to addr over network, "tcp" or "unix", then authenticates
+// and selects the protocol as opts asks. opts may be nil.
+func Dial(ctx context.Context, network, addr string, opts *Options) (*Conn, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	dialer := net.Dialer{Timeout: timeout(o.DialTimeout, DefaultDialTimeout)}
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if o.TLSConfig != nil {
+		tlsConn := tls.Client(conn, o.TLSConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	c := &Conn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn), opts: o}
+	c.enc = protocol.NewEncoder(c.w, 2)
+	if err := c.handshake(ctx); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// handshake authenticates and selects the protocol version: with HELLO
+// for RESP3, and otherwise with AUTH and CLIENT SETNAME, which older
+// servers also understand.
+func (c *Conn) handshake(ctx context.Context) error {
+	user := c.opts.Username
+	if user == "" {
+		user = "default"
+	}
+	if c.opts.Protocol == 3 {
+		args := []string{"HELLO", "3"}
+		if c.opts.Password != "" {
+			args = append(args, "AUTH", user, c.opts.Password)
+		}
+		if c.opts.ClientName != "" {
+			args = append(args, "SETNAME", c.opts.ClientName)
+		}
+		_, err := c.DoContext(ctx, args...)
+		return err
+	}
+	if c.opts.Password != "" {
+		if _, err := c.DoContext(ctx, "AUTH", user, c.opts.Password); err != nil {
+			return err
+		}
+	}
+	if c.opts.ClientName != "" {
+		if _, err := c.DoContext(ctx, "CLIENT", "SETNAME", c.opts.ClientName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	if c.err == nil {
+		c.err = ErrClosed
+	}
+	return c.conn.Close()
+}
+
+// Err returns the error that made the connection unusable, if any.
+func (c *Conn) Err() error {
+	return c.err
+}
+
+// fail marks the connection unusable after a network or protocol error,
+// as the replies that follow can no longer be matched to their commands.
+func (c *Conn) fail(err error) error {
+	if c.err == nil {
+		c.err = err
+		_ = c.conn.Close()
+	}
+	return err
+}
+
+// Do sends a command and returns its reply. An error reply is returned as
+// a *protocol.Error.
+func (c *Conn) Do(args ...string) (protocol.RespValue, error) {
+	return c.DoContext(context.Background(), args...)
+}
+
+// DoContext is Do with a context. If ctx has a deadline it replaces the
+// read timeout, which makes it the way to run blocking commands such as
+// BLPOP: give ctx a deadline beyond the command's own timeout, or none to
+// wait as long as the command does. Canceling ctx breaks the connection.
+func (c *Conn) DoContext(ctx context.Context, args ...string) (protocol.RespValue, error) {
+	if err := c.Send(args...); err != nil {
+		return nil, err
+	}
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+	reply, err := c.ReceiveContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := reply.(*protocol.Error); ok {
+		return nil, e
+	}
+	return reply, nil
+}
+
+// Send buffers a command without waiting for its reply, to pipeline it
+// with others. Flush writes the buffered commands; Receive reads their
+// replies in order.
+func (c *Conn) Send(args ...string) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.enc.WriteArrayLen(len(args))
+	for _, arg := range args {
+		c.enc.WriteBulkString(arg)
+	}
+	c.pending++
+	return nil
+}
+
+// Flush writes the commands buffered by Send.
+func (c *Conn) Flush() error {
+	if c.err != nil {
+		return c.err
+	}
+	var deadline time.Time
+	if d := timeout(c.opts.WriteTimeout, DefaultWriteTimeout); d > 0 {
+		deadline = time.Now().Add(d)
+	}
+	if err := c.conn.SetWriteDeadline(deadline); err != nil {
+		return c.fail(err)
+	}
+	if err := c.w.Flush(); err != nil {
+		return c.fail(err)
+	}
+	return nil
+}
+
+// Receive reads the next reply, which may be an error reply.
+func (c *Conn) Receive() (protocol.RespValue, error) {
+	return c.ReceiveContext(context.Background())
+}
+
+// ReceiveContext is Receive with a context, whose deadline replaces the
+// read timeout as for DoContext.
+func (c *Conn) ReceiveContext(ctx context.Context) (protocol.RespValue, error) {
+	return c.receive(ctx, timeout(c.opts.ReadTimeout, DefaultReadTimeout))
+}
+
+// receive reads the next reply, waiting until ctx's deadline, or else for
+// readTimeout if it is not zero.
+func (c *Conn) receive(ctx context.Context, readTimeout time.Duration) (protocol.RespValue, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok && readTimeout > 0 {
+		deadline = time.Now().Add(readTimeout)
+	}
+	if err := c.conn.SetReadDeadline(deadline); err != nil {
+		return nil, c.fail(err)
+	}
+	// Interrupt the read when ctx is canceled.
+	stop := context.AfterFunc(ctx, func() { _ = c.conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	for {
+		reply, err := protocol.ReadReply(c.r)
+		if err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return nil, c.fail(err)
+		}
+		// Outside of pub/sub, push messages are not replies to commands.
+		if push, ok := reply.(*protocol.Push); ok && !c.subscribed {
+			if c.opts.OnPush != nil {
+				c.opts.OnPush(push)
+			}
+			continue
+		}
+		if c.pending > 0 {
+			c.pending--
+		}
+		return reply, nil
+	}
+}
+
+// Pipeline sends cmds in one write and returns their replies, including
+// error replies, in order.
+func (c *Conn) Pipeline(cmds ...[]string) ([]protocol.RespValue, error) {
+	for _, args := range cmds {
+		if err := c.Send(args...); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+	replies := make([]protocol.RespValue, len(cmds))
+	for i := range replies {
+		reply, err := c.Receive()
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
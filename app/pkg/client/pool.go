@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"sync"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+)
+
+// DefaultPoolSize is the most connections a Pool opens unless
+// Options.PoolSize says otherwise.
+const DefaultPoolSize = 10
+
+// Pool shares connections to one server between goroutines. It opens at
+// most PoolSize connections; Get waits for one to be returned when all are
+// in use.
+type Pool struct {
+	network, addr string
+	opts          Options
+
+	// slots holds a token for every connection that may still be opened
+	// or is idle.
+	slots chan struct{}
+
+	mu     sync.Mutex
+	idle   []*Conn
+	closed bool
+}
+
+// NewPool returns a pool of connections to addr, dialed as Dial does.
+func NewPool(network, addr string, opts *Options) *Pool {
+	p := &Pool{network: network, addr: addr}
+	if opts != nil {
+		p.opts = *opts
+	}
+	size := p.opts.PoolSize
+	if size <= 0 {
+		size = DefaultPoolSize
+	}
+	p.slots = make(chan struct{}, size)
+	for i := 0; i < size; i++ {
+		p.slots <- struct{}{}
+	}
+	return p
+}
+
+// Get returns an idle connection, or dials a new one. It must be given
+// back with Put.
+func (p *Pool) Get(ctx context.Context) (*Conn, error) {
+	select {
+	case <-p.slots:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		p.slots <- struct{}{}
+		return nil, ErrClosed
+	}
+	if n := len(p.idle); n > 0 {
+		c := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return c, nil
+	}
+	p.mu.Unlock()
+
+	c, err := Dial(ctx, p.network, p.addr, &p.opts)
+	if err != nil {
+		p.slots <- struct{}{}
+		return nil, err
+	}
+	return c, nil
+}
+
+// Put returns a connection taken with Get. Connections that are broken,
+// subscribed or have replies left to read are closed instead of reused.
+func (p *Pool) Put(c *Conn) {
+	defer func() { p.slots <- struct{}{} }()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || c.err != nil || c.subscribed || c.pending > 0 {
+		_ = c.Close()
+		return
+	}
+	p.idle = append(p.idle, c)
+}
+
+// Do runs a command on a pooled connection.
+func (p *Pool) Do(ctx context.Context, args ...string) (protocol.RespValue, error) {
+	c, err := p.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer p.Put(c)
+	return c.DoContext(ctx, args...)
+}
+
+// Close closes the idle connections and makes Get fail. Connections in use
+// are closed when they are put back.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, c := range p.idle {
+		_ = c.Close()
+	}
+	p.idle = nil
+	return nil
+}
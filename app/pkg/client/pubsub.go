@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+)
+
+// Message is a message published to a channel. Pattern is set for
+// messages received through PSubscribe.
+type Message struct {
+	Channel string
+	Pattern string
+	Payload string
+}
+
+// Subscription confirms a change to the subscriptions: Kind is
+// "subscribe", "unsubscribe", "psubscribe" or "punsubscribe", and Count is
+// how many subscriptions the connection has left.
+type Subscription struct {
+	Kind    string
+	Channel string
+	Count   int64
+}
+
+// Pong is the reply to Ping.
+type Pong struct {
+	Data string
+}
+
+// PubSub receives messages on a connection subscribed to channels or
+// patterns. Once subscribed, a connection is not returned to a Pool.
+type PubSub struct {
+	c *Conn
+	// pings counts the pings not yet answered. RESP3 replies to them like
+	// to any other command, so this is how Receive recognises them.
+	pings int
+}
+
+// NewPubSub takes over c for pub/sub.
+func NewPubSub(c *Conn) *PubSub {
+	return &PubSub{c: c}
+}
+
+func (ps *PubSub) send(args ...string) error {
+	ps.c.subscribed = true
+	if err := ps.c.Send(args...); err != nil {
+		return err
+	}
+	return ps.c.Flush()
+}
+
+// Subscribe subscribes to channels. The confirmations arrive through
+// Receive as *Subscription values.
+func (ps *PubSub) Subscribe(channels ...string) error {
+	return ps.send(append([]string{"SUBSCRIBE"}, channels...)...)
+}
+
+// PSubscribe subscribes to channels matching patterns.
+func (ps *PubSub) PSubscribe(patterns ...string) error {
+	return ps.send(append([]string{"PSUBSCRIBE"}, patterns...)...)
+}
+
+// Unsubscribe unsubscribes from channels, or from all of them if none are
+// given.
+func (ps *PubSub) Unsubscribe(channels ...string) error {
+	return ps.send(append([]string{"UNSUBSCRIBE"}, channels...)...)
+}
+
+// PUnsubscribe unsubscribes from patterns, or from all of them if none are
+// given.
+func (ps *PubSub) PUnsubscribe(patterns ...string) error {
+	return ps.send(append([]string{"PUNSUBSCRIBE"}, patterns...)...)
+}
+
+// Ping checks the connection; the *Pong arrives through Receive.
+func (ps *PubSub) Ping(data string) error {
+	if err := ps.send("PING", data); err != nil {
+		return err
+	}
+	ps.pings++
+	return nil
+}
+
+// Receive waits, without a timeout, for the next message, subscription
+// change or pong.
+func (ps *PubSub) Receive() (any, error) {
+	return ps.ReceiveContext(context.Background())
+}
+
+// ReceiveContext is Receive, giving up when ctx is done. That breaks the
+// connection.
+func (ps *PubSub) ReceiveContext(ctx context.Context) (any, error) {
+	// Messages may be far apart, so the read timeout does not apply.
+	reply, err := ps.c.receive(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var elements []protocol.RespValue
+	switch v := reply.(type) {
+	case *protocol.Error:
+		return nil, v
+	case *protocol.SimpleString, *protocol.BulkString:
+		if ps.pings > 0 {
+			ps.pings--
+			data, _ := String(v, nil)
+			if data == "PONG" {
+				data = ""
+			}
+			return &Pong{Data: data}, nil
+		}
+		return reply, nil
+	case *protocol.Push:
+		elements = v.Elements
+	case *protocol.Array:
+		elements = v.Elements
+	default:
+		return reply, nil
+	}
+	strs, err := Strings(&protocol.Array{Elements: elements}, nil)
+	if err != nil || len(strs) == 0 {
+		return reply, nil
+	}
+
+	switch kind := strings.ToLower(strs[0]); {
+	case kind == "message" && len(strs) == 3:
+		return &Message{Channel: strs[1], Payload: strs[2]}, nil
+	case kind == "pmessage" && len(strs) == 4:
+		return &Message{Pattern: strs[1], Channel: strs[2], Payload: strs[3]}, nil
+	case kind == "pong" && len(strs) == 2:
+		ps.pings = max(ps.pings-1, 0)
+		return &Pong{Data: strs[1]}, nil
+	case strings.HasSuffix(kind, "subscribe") && len(strs) == 3:
+		count, err := Int64(elements[2], nil)
+		if err != nil {
+			return nil, err
+		}
+		return &Subscription{Kind: kind, Channel: strs[1], Count: count}, nil
+	}
+	return reply, nil
+}
+
+// Close closes the connection.
+func (ps *PubSub) Close() error {
+	return ps.c.Close()
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+)
+
+// ErrNil is returned by the conversion functions for a null reply, such as
+// GET of a missing key.
+var ErrNil = errors.New("client: nil reply")
+
+// The conversion functions take the results of Do, so that calls can be
+// written as client.String(c.Do("GET", key)).
+
+func isNull(reply protocol.RespValue) bool {
+	switch v := reply.(type) {
+	case *protocol.Null, *protocol.NullBulkString:
+		return true
+	case *protocol.Array:
+		return v.Elements == nil
+	}
+	return false
+}
+
+// String converts a simple, bulk or verbatim string, integer or double
+// reply to a string.
+func String(reply protocol.RespValue, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	switch v := reply.(type) {
+	case *protocol.SimpleString:
+		return v.Data, nil
+	case *protocol.BulkString:
+		return v.Data, nil
+	case *protocol.VerbatimString:
+		return v.Data, nil
+	case *protocol.IntegerBulkString:
+		return strconv.FormatInt(v.Data, 10), nil
+	case *protocol.Double:
+		return strconv.FormatFloat(v.Data, 'g', -1, 64), nil
+	}
+	if isNull(reply) {
+		return "", ErrNil
+	}
+	return "", fmt.Errorf("client: unexpected reply type %T for String", reply)
+}
+
+// Int64 converts an integer reply, or a string holding an integer, to an
+// int64.
+func Int64(reply protocol.RespValue, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	switch v := reply.(type) {
+	case *protocol.IntegerBulkString:
+		return v.Data, nil
+	case *protocol.Boolean:
+		if v.Data {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	s, err := String(reply, nil)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// Strings converts an array, set or push reply to strings. Null elements
+// become empty strings.
+func Strings(reply protocol.RespValue, err error) ([]string, error) {
+	elements, err := elementsOf(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	strs := make([]string, len(elements))
+	for i, elem := range elements {
+		if isNull(elem) {
+			continue
+		}
+		if strs[i], err = String(elem, nil); err != nil {
+			return nil, err
+		}
+	}
+	return strs, nil
+}
+
+// StringMap converts a map reply, or a RESP2 array of alternating keys and
+// values such as the reply to CONFIG GET, to a map.
+func StringMap(reply protocol.RespValue, err error) (map[string]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	var pairs []protocol.RespValue
+	if m, ok := reply.(*protocol.Map); ok {
+		for _, entry := range m.Entries {
+			pairs = append(pairs, entry.Key, entry.Value)
+		}
+	} else if pairs, err = elementsOf(reply, nil); err != nil {
+		return nil, err
+	}
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("client: odd number of elements for StringMap")
+	}
+	m := make(map[string]string, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, err := String(pairs[i], nil)
+		if err != nil {
+			return nil, err
+		}
+		value, err := String(pairs[i+1], nil)
+		if err != nil && err != ErrNil {
+			return nil, err
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+func elementsOf(reply protocol.RespValue, err error) ([]protocol.RespValue, error) {
+	if err != nil {
+		return nil, err
+	}
+	switch v := reply.(type) {
+	case *protocol.Array:
+		if v.Elements == nil {
+			return nil, ErrNil
+		}
+		return v.Elements, nil
+	case *protocol.Set:
+		return v.Elements, nil
+	case *protocol.Push:
+		return v.Elements, nil
+	case *protocol.Null:
+		return nil, ErrNil
+	}
+	return nil, fmt.Errorf("client: unexpected reply type %T for an aggregate", reply)
+}
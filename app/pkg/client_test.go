@@ -0,0 +1,154 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+)
+
+// parseClients parses the lines of CLIENT LIST and CLIENT INFO into the
+// fields of each client, by id.
+func parseClients(reply string) map[string]map[string]string {
+	clients := make(map[string]map[string]string)
+	for _, line := range strings.Split(strings.TrimSuffix(reply, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := make(map[string]string)
+		for _, field := range strings.Fields(line) {
+			name, value, _ := strings.Cut(field, "=")
+			fields[name] = value
+		}
+		clients[fields["id"]] = fields
+	}
+	return clients
+}
+
+func listClients(t *testing.T, c *client.Conn, args ...string) map[string]map[string]string {
+	t.Helper()
+	reply, err := client.String(c.Do(append([]string{"CLIENT", "LIST"}, args...)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parseClients(reply)
+}
+
+// clientInfo returns the fields CLIENT INFO shows for c.
+func clientInfo(t *testing.T, c *client.Conn) map[string]string {
+	t.Helper()
+	reply, err := client.String(c.Do("CLIENT", "INFO"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fields := range parseClients(reply) {
+		return fields
+	}
+	t.Fatal("CLIENT INFO is empty")
+	return nil
+}
+
+func TestClientList(t *testing.T) {
+	addr := startServer(t)
+	c := dial(t, addr, &client.Options{ClientName: "worker", Protocol: 3})
+	subscriber := client.NewPubSub(dial(t, addr, nil))
+	if err := subscriber.Subscribe("news", "weather"); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if _, err := subscriber.Receive(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info := clientInfo(t, c)
+	id := info["id"]
+	clients := listClients(t, c)
+	if len(clients) != 2 {
+		t.Fatalf("CLIENT LIST: %d clients, want 2", len(clients))
+	}
+	for field, want := range map[string]string{
+		"addr": info["addr"], "laddr": addr, "name": "worker", "flags": "N",
+		"db": "0", "sub": "0", "multi": "-1", "cmd": "client|list", "user": "default", "resp": "3",
+	} {
+		if got := clients[id][field]; got != want {
+			t.Errorf("CLIENT LIST %s: %q, want %q", field, got, want)
+		}
+	}
+
+	pubsub := listClients(t, c, "TYPE", "pubsub")
+	if len(pubsub) != 1 || pubsub[id] != nil {
+		t.Fatalf("CLIENT LIST TYPE pubsub: %q", pubsub)
+	}
+	var subscriberID string
+	for other := range pubsub {
+		subscriberID = other
+	}
+	if fields := pubsub[subscriberID]; fields["sub"] != "2" || fields["flags"] != "P" || fields["cmd"] != "subscribe" {
+		t.Errorf("subscriber: %q", fields)
+	}
+	if got := listClients(t, c, "ID", subscriberID, "12345"); len(got) != 1 || got[subscriberID] == nil {
+		t.Errorf("CLIENT LIST ID %s 12345: %q", subscriberID, got)
+	}
+	if got := listClients(t, c, "TYPE", "normal"); len(got) != 1 || got[id] == nil {
+		t.Errorf("CLIENT LIST TYPE normal: %q", got)
+	}
+	for _, args := range [][]string{{"TYPE", "nosuchtype"}, {"ID", "x"}, {"NOSUCHFILTER", "1"}} {
+		if _, err := c.Do(append([]string{"CLIENT", "LIST"}, args...)...); replyError(err) == "" {
+			t.Errorf("CLIENT LIST %q: %v, want an error", args, err)
+		}
+	}
+}
+
+func TestClientKill(t *testing.T) {
+	addr := startServer(t)
+	admin := dial(t, addr, nil)
+	if _, err := admin.Do("ACL", "SETUSER", "worker", "on", ">pw", "+@all", "~*"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		filter func(self, victim map[string]string) []string
+		killed int64
+		// Whether the client running CLIENT KILL is the one killed.
+		self bool
+	}{
+		{"by id", func(_, victim map[string]string) []string { return []string{"ID", victim["id"]} }, 1, false},
+		{"by addr", func(_, victim map[string]string) []string { return []string{"ADDR", victim["addr"]} }, 1, false},
+		{"by user", func(_, _ map[string]string) []string { return []string{"USER", "worker"} }, 1, false},
+		{"by type and user", func(_, _ map[string]string) []string { return []string{"TYPE", "normal", "USER", "worker"} }, 1, false},
+		{"no match", func(_, _ map[string]string) []string { return []string{"TYPE", "pubsub", "USER", "worker"} }, 0, false},
+		{"skipping the caller", func(self, _ map[string]string) []string { return []string{"ID", self["id"]} }, 0, false},
+		{"including the caller", func(self, _ map[string]string) []string { return []string{"ID", self["id"], "SKIPME", "no"} }, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := dial(t, addr, nil)
+			victim := dial(t, addr, &client.Options{Username: "worker", Password: "pw"})
+			args := append([]string{"CLIENT", "KILL"}, tt.filter(clientInfo(t, c), clientInfo(t, victim))...)
+			killed, err := client.Int64(c.Do(args...))
+			if err != nil || killed != tt.killed {
+				t.Fatalf("%q: %d, %v, want %d", args, killed, err, tt.killed)
+			}
+			if _, err := victim.Do("PING"); (err != nil) != (tt.killed > 0 && !tt.self) {
+				t.Errorf("PING by the other client: %v", err)
+			}
+			if _, err := c.Do("PING"); (err != nil) != tt.self {
+				t.Errorf("PING by the caller: %v", err)
+			}
+		})
+	}
+
+	// The legacy form takes the address alone and replies OK.
+	victim := dial(t, addr, nil)
+	if got, err := client.String(admin.Do("CLIENT", "KILL", clientInfo(t, victim)["addr"])); err != nil || got != "OK" {
+		t.Errorf("CLIENT KILL addr: %q, %v", got, err)
+	}
+	if _, err := victim.Do("PING"); err == nil {
+		t.Error("PING by a killed client succeeded")
+	}
+	if _, err := admin.Do("CLIENT", "KILL", "127.0.0.1:1"); replyError(err) != "ERR No such client" {
+		t.Errorf("CLIENT KILL of an unknown address: %v", err)
+	}
+}
@@ -0,0 +1,293 @@
+package pkg
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+)
+
+// CommandFunc runs a command for a client. args does not include the command
+// name. They share the connection's read buffer, so a command that keeps an
+// argument once it returns must copy it.
+type CommandFunc func(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error)
+
+// stringArgs copies arguments that are kept once a command returns.
+func stringArgs(args [][]byte) []string {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		strs[i] = string(arg)
+	}
+	return strs
+}
+
+// byteArgs builds an argument list, such as a command to propagate.
+func byteArgs(args ...string) [][]byte {
+	argv := make([][]byte, len(args))
+	for i, arg := range args {
+		argv[i] = []byte(arg)
+	}
+	return argv
+}
+
+type CommandFlags uint32
+
+const (
+	FlagWrite CommandFlags = 1 << iota
+	FlagReadOnly
+	FlagBlocking
+	FlagAdmin
+	FlagFast
+	FlagNoScript
+	FlagLoading
+	FlagStale
+	FlagMovableKeys
+	// FlagNoMulti commands run immediately instead of being queued by MULTI.
+	FlagNoMulti
+	FlagPubSub
+	// FlagNoAuth commands may run before the client has authenticated.
+	FlagNoAuth
+)
+
+var commandFlagNames = []struct {
+	flag CommandFlags
+	name string
+}{
+	{FlagWrite, "write"},
+	{FlagReadOnly, "readonly"},
+	{FlagAdmin, "admin"},
+	{FlagNoScript, "noscript"},
+	{FlagBlocking, "blocking"},
+	{FlagLoading, "loading"},
+	{FlagStale, "stale"},
+	{FlagFast, "fast"},
+	{FlagMovableKeys, "movablekeys"},
+	{FlagPubSub, "pubsub"},
+	{FlagNoMulti, "no_multi"},
+	{FlagNoAuth, "no_auth"},
+}
+
+func (f CommandFlags) Names() []string {
+	names := make([]string, 0, len(commandFlagNames))
+	for _, fn := range commandFlagNames {
+		if f&fn.flag != 0 {
+			names = append(names, fn.name)
+		}
+	}
+	return names
+}
+
+// Command describes a command the server understands. Arity follows Redis:
+// it counts the command name, and a negative value means "at least -Arity".
+// FirstKey, LastKey and Step give the key positions in the full argument
+// list; LastKey -1 means the last argument and 0 means the command has no keys.
+type Command struct {
+	Name     string
+	Arity    int
+	Flags    CommandFlags
+	FirstKey int
+	LastKey  int
+	Step     int
+	// GetKeys finds the keys of commands whose keys move (FlagMovableKeys).
+	GetKeys func(argv [][]byte) [][]byte
+	// Subcommands lists the subcommands of a container command such as
+	// CONFIG, with the flags each adds to the command's own.
+	Subcommands map[string]CommandFlags
+	Group       string
+	Summary     string
+	Since       string
+	Handler     CommandFunc
+
+	categories    []string
+	subCategories map[string][]string
+}
+
+func (cmd *Command) Has(flag CommandFlags) bool {
+	return cmd.Flags&flag != 0
+}
+
+func (cmd *Command) CheckArity(argc int) bool {
+	if cmd.Arity >= 0 {
+		return argc == cmd.Arity
+	}
+	return argc >= -cmd.Arity
+}
+
+// Keys returns the keys of a full argument list (command name included).
+func (cmd *Command) Keys(argv [][]byte) [][]byte {
+	if cmd.GetKeys != nil {
+		return cmd.GetKeys(argv)
+	}
+	if cmd.FirstKey == 0 || cmd.FirstKey >= len(argv) {
+		return nil
+	}
+	last := cmd.LastKey
+	if last < 0 {
+		last = len(argv) + last
+	}
+	if last >= len(argv) {
+		last = len(argv) - 1
+	}
+	step := cmd.Step
+	if step <= 0 {
+		step = 1
+	}
+	keys := make([][]byte, 0, (last-cmd.FirstKey)/step+1)
+	for i := cmd.FirstKey; i <= last; i += step {
+		keys = append(keys, argv[i])
+	}
+	return keys
+}
+
+// subcommand returns the subcommand argv[1] names, in lower case, or "" if
+// cmd has no such subcommand.
+func (cmd *Command) subcommand(argv [][]byte) string {
+	if len(argv) < 2 || len(cmd.Subcommands) == 0 {
+		return ""
+	}
+	sub := strings.ToLower(string(argv[1]))
+	if _, ok := cmd.Subcommands[sub]; !ok {
+		return ""
+	}
+	return sub
+}
+
+// fullName names the command as INFO and CLIENT LIST report it, with the
+// subcommand if there is one, e.g. "config|get".
+func (cmd *Command) fullName(argv [][]byte) string {
+	if sub := cmd.subcommand(argv); sub != "" {
+		return cmd.Name + "|" + sub
+	}
+	return cmd.Name
+}
+
+// groupCategories maps command groups to ACL categories where the names
+// differ. Server commands belong to no category of their own.
+var groupCategories = map[string]string{
+	"generic":      "keyspace",
+	"transactions": "transaction",
+	"server":       "",
+}
+
+// Categories returns the ACL categories the command belongs to.
+func (cmd *Command) Categories() []string {
+	return categoriesOf(cmd.Flags, cmd.Group)
+}
+
+func categoriesOf(flags CommandFlags, group string) []string {
+	var cats []string
+	if flags&FlagWrite != 0 {
+		cats = append(cats, "@write")
+	}
+	if flags&FlagReadOnly != 0 {
+		cats = append(cats, "@read")
+	}
+	if flags&FlagAdmin != 0 {
+		cats = append(cats, "@admin", "@dangerous")
+	}
+	if flags&FlagBlocking != 0 {
+		cats = append(cats, "@blocking")
+	}
+	if flags&FlagFast != 0 {
+		cats = append(cats, "@fast")
+	} else {
+		cats = append(cats, "@slow")
+	}
+	if category, ok := groupCategories[group]; ok {
+		group = category
+	}
+	if group != "" {
+		cats = append(cats, "@"+group)
+	}
+	return cats
+}
+
+// aclCategories returns the categories without the '@' prefix, as the ACL
+// checks use them, including those a subcommand adds.
+func (cmd *Command) aclCategories(sub string) []string {
+	if cats, ok := cmd.subCategories[sub]; ok {
+		return cats
+	}
+	return cmd.categories
+}
+
+func trimCategories(cats []string) []string {
+	trimmed := make([]string, len(cats))
+	for i, cat := range cats {
+		trimmed[i] = strings.TrimPrefix(cat, "@")
+	}
+	return trimmed
+}
+
+func (cmd *Command) wrongArity() *protocol.Error {
+	return &protocol.Error{Message: "ERR wrong number of arguments for '" + cmd.Name + "' command"}
+}
+
+// CommandTable maps lower-case command names to their definitions.
+type CommandTable struct {
+	mu       sync.RWMutex
+	commands map[string]*Command
+}
+
+func NewCommandTable() *CommandTable {
+	return &CommandTable{commands: make(map[string]*Command)}
+}
+
+// Register adds a command, replacing any existing command with the same name.
+func (t *CommandTable) Register(cmd *Command) {
+	cmd.Name = strings.ToLower(cmd.Name)
+	cmd.categories = trimCategories(cmd.Categories())
+	cmd.subCategories = make(map[string][]string, len(cmd.Subcommands))
+	for sub, flags := range cmd.Subcommands {
+		cmd.subCategories[sub] = trimCategories(categoriesOf(cmd.Flags|flags, cmd.Group))
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.commands[cmd.Name] = cmd
+}
+
+func (t *CommandTable) Lookup(name string) (*Command, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	cmd, ok := t.commands[strings.ToLower(name)]
+	return cmd, ok
+}
+
+// lookupArg is Lookup for a command name as a request carries it. Short
+// names are lowered on the stack, so looking them up does not allocate.
+func (t *CommandTable) lookupArg(name []byte) (*Command, bool) {
+	var buf [32]byte
+	if len(name) > len(buf) {
+		return t.Lookup(string(name))
+	}
+	lower := buf[:len(name)]
+	for i, b := range name {
+		if 'A' <= b && b <= 'Z' {
+			b += 'a' - 'A'
+		}
+		lower[i] = b
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	cmd, ok := t.commands[string(lower)]
+	return cmd, ok
+}
+
+func (t *CommandTable) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.commands)
+}
+
+// All returns every registered command sorted by name.
+func (t *CommandTable) All() []*Command {
+	t.mu.RLock()
+	cmds := make([]*Command, 0, len(t.commands))
+	for _, cmd := range t.commands {
+		cmds = append(cmds, cmd)
+	}
+	t.mu.RUnlock()
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].Name < cmds[j].Name })
+	return cmds
+}
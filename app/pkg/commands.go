@@ -0,0 +1,485 @@
+package pkg
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/handler"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/store"
+)
+
+var builtinCommands = []*Command{
+	{
+		Name: "ping", Arity: -1, Flags: FlagFast | FlagStale | FlagLoading,
+		Group: "connection", Summary: "Returns the server's liveliness response.", Since: "1.0.0",
+		Handler: func(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+			if c.subscriptionCount() > 0 && c.rp.Version() == 2 {
+				var message []byte
+				if len(args) > 0 {
+					message = args[0]
+				}
+				return &protocol.Array{Elements: []protocol.RespValue{
+					&protocol.BulkString{Data: "pong"},
+					&protocol.BulkBytes{Data: message},
+				}}, nil
+			}
+			return handler.Ping(args)
+		},
+	},
+	{
+		Name: "echo", Arity: 2, Flags: FlagFast | FlagStale | FlagLoading,
+		Group: "connection", Summary: "Returns the given string.", Since: "1.0.0",
+		Handler: func(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+			return handler.Echo(args)
+		},
+	},
+	{
+		Name: "quit", Arity: -1, Flags: FlagNoScript | FlagLoading | FlagStale | FlagFast | FlagNoAuth,
+		Group: "connection", Summary: "Closes the connection.", Since: "1.0.0",
+		Handler: func(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+			c.closeAfterReply = true
+			return &protocol.SimpleString{Data: "OK"}, nil
+		},
+	},
+	{
+		Name: "auth", Arity: -2, Flags: FlagNoScript | FlagLoading | FlagStale | FlagFast | FlagNoAuth,
+		Group: "connection", Summary: "Authenticates the connection.", Since: "1.0.0",
+		Handler: authCommand,
+	},
+	{
+		Name: "hello", Arity: -1, Flags: FlagNoScript | FlagLoading | FlagStale | FlagFast | FlagNoAuth,
+		Group: "connection", Summary: "Handshakes with the Redis server.", Since: "6.0.0",
+		Handler: helloCommand,
+	},
+	{
+		Name: "acl", Arity: -2, Flags: FlagNoScript | FlagLoading | FlagStale,
+		Subcommands: map[string]CommandFlags{
+			"whoami": 0, "cat": 0,
+			"setuser": FlagAdmin, "getuser": FlagAdmin, "deluser": FlagAdmin, "users": FlagAdmin,
+			"list": FlagAdmin, "log": FlagAdmin, "load": FlagAdmin, "save": FlagAdmin,
+		},
+		Group: "server", Summary: "A container for Access List Control commands.", Since: "6.0.0",
+		Handler: aclCommand,
+	},
+	{
+		Name: "select", Arity: 2, Flags: FlagLoading | FlagStale | FlagFast,
+		Group: "connection", Summary: "Changes the selected database.", Since: "1.0.0",
+		Handler: func(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+			db, err := strconv.Atoi(string(args[0]))
+			if err != nil {
+				return nil, &protocol.Error{Message: "ERR value is not an integer or out of range"}
+			}
+			// Only database 0 exists.
+			if db != 0 {
+				return nil, &protocol.Error{Message: "ERR DB index is out of range"}
+			}
+			return &protocol.SimpleString{Data: "OK"}, nil
+		},
+	},
+	{
+		Name: "client", Arity: -2, Flags: FlagNoScript | FlagLoading | FlagStale,
+		Subcommands: map[string]CommandFlags{
+			"id": 0, "info": 0, "getname": 0, "setname": 0, "setinfo": 0,
+			"list": FlagAdmin, "kill": FlagAdmin,
+		},
+		Group: "connection", Summary: "A container for client connection commands.", Since: "2.4.0",
+		Handler: clientCommand,
+	},
+	{
+		Name: "command", Arity: -1, Flags: FlagStale | FlagLoading,
+		Subcommands: map[string]CommandFlags{"count": 0, "list": 0, "info": 0, "docs": 0},
+		Group:       "server", Summary: "Returns detailed information about all commands.", Since: "2.8.13",
+		Handler: commandCommand,
+	},
+	{
+		Name: "config", Arity: -2, Flags: FlagAdmin | FlagNoScript | FlagLoading | FlagStale,
+		Subcommands: map[string]CommandFlags{"get": 0, "set": 0, "resetstat": 0},
+		Group:       "server", Summary: "A container for server configuration commands.", Since: "2.0.0",
+		Handler: configCommand,
+	},
+	{
+		Name: "info", Arity: -1, Flags: FlagLoading | FlagStale,
+		Group: "server", Summary: "Returns information and statistics about the server.", Since: "1.0.0",
+		Handler: infoCommand,
+	},
+	{
+		Name: "monitor", Arity: 1, Flags: FlagAdmin | FlagNoScript | FlagLoading | FlagStale,
+		Group: "server", Summary: "Listens for all requests received by the server in real-time.", Since: "1.0.0",
+		Handler: monitorCommand,
+	},
+	{
+		Name: "slowlog", Arity: -2, Flags: FlagAdmin | FlagLoading | FlagStale,
+		Subcommands: map[string]CommandFlags{"get": 0, "len": 0, "reset": 0},
+		Group:       "server", Summary: "A container for slow log commands.", Since: "2.2.12",
+		Handler: slowlogCommand,
+	},
+	{
+		Name: "replconf", Arity: -1, Flags: FlagAdmin | FlagNoScript | FlagLoading | FlagStale,
+		Group: "server", Summary: "An internal command for configuring the replication stream.", Since: "3.0.0",
+		Handler: replconfCommand,
+	},
+	{
+		Name: "psync", Arity: -3, Flags: FlagAdmin | FlagNoScript,
+		Group: "server", Summary: "An internal command used in replication.", Since: "2.8.0",
+		Handler: psyncCommand,
+	},
+	{
+		Name: "replicaof", Arity: 3, Flags: FlagAdmin | FlagNoScript | FlagStale,
+		Group: "server", Summary: "Configures a server as replica of another, or promotes it to a primary.", Since: "5.0.0",
+		Handler: replicaofCommand,
+	},
+	{
+		Name: "slaveof", Arity: 3, Flags: FlagAdmin | FlagNoScript | FlagStale,
+		Group: "server", Summary: "Sets a Redis server as a replica of another, or promotes it to being a primary.", Since: "1.0.0",
+		Handler: replicaofCommand,
+	},
+	{
+		Name: "shutdown", Arity: -1, Flags: FlagAdmin | FlagNoScript | FlagLoading | FlagStale | FlagNoMulti,
+		Group: "server", Summary: "Synchronously saves the database(s) to disk and shuts down the Redis server.", Since: "1.0.0",
+		Handler: shutdownCommand,
+	},
+	{
+		Name: "wait", Arity: 3, Flags: FlagNoScript | FlagBlocking,
+		Group: "generic", Summary: "Blocks until the asynchronous replication of all preceding write commands sent by the connection is completed.", Since: "3.0.0",
+		Handler: waitCommand,
+	},
+	{
+		Name: "multi", Arity: 1, Flags: FlagNoScript | FlagLoading | FlagStale | FlagFast | FlagNoMulti,
+		Group: "transactions", Summary: "Starts a transaction.", Since: "1.2.0",
+		Handler: multiCommand,
+	},
+	{
+		Name: "exec", Arity: 1, Flags: FlagNoScript | FlagLoading | FlagStale | FlagNoMulti,
+		Group: "transactions", Summary: "Executes all commands in a transaction.", Since: "1.2.0",
+		Handler: execCommand,
+	},
+	{
+		Name: "discard", Arity: 1, Flags: FlagNoScript | FlagLoading | FlagStale | FlagFast | FlagNoMulti,
+		Group: "transactions", Summary: "Discards a transaction.", Since: "2.0.0",
+		Handler: discardCommand,
+	},
+	{
+		Name: "watch", Arity: -2, Flags: FlagNoScript | FlagLoading | FlagStale | FlagFast | FlagNoMulti,
+		FirstKey: 1, LastKey: -1, Step: 1,
+		Group: "transactions", Summary: "Monitors changes to keys to determine the execution of a transaction.", Since: "2.2.0",
+		Handler: watchCommand,
+	},
+	{
+		Name: "unwatch", Arity: 1, Flags: FlagNoScript | FlagLoading | FlagStale | FlagFast,
+		Group: "transactions", Summary: "Forgets about watched keys of a transaction.", Since: "2.2.0",
+		Handler: unwatchCommand,
+	},
+	{
+		Name: "subscribe", Arity: -2, Flags: FlagPubSub | FlagNoScript | FlagLoading | FlagStale,
+		Group: "pubsub", Summary: "Listens for messages published to channels.", Since: "2.0.0",
+		Handler: subscribeCommand,
+	},
+	{
+		Name: "unsubscribe", Arity: -1, Flags: FlagPubSub | FlagNoScript | FlagLoading | FlagStale,
+		Group: "pubsub", Summary: "Stops listening to messages posted to channels.", Since: "2.0.0",
+		Handler: unsubscribeCommand,
+	},
+	{
+		Name: "psubscribe", Arity: -2, Flags: FlagPubSub | FlagNoScript | FlagLoading | FlagStale,
+		Group: "pubsub", Summary: "Listens for messages published to channels that match one or more patterns.", Since: "2.0.0",
+		Handler: psubscribeCommand,
+	},
+	{
+		Name: "punsubscribe", Arity: -1, Flags: FlagPubSub | FlagNoScript | FlagLoading | FlagStale,
+		Group: "pubsub", Summary: "Stops listening to messages published to channels that match one or more patterns.", Since: "2.0.0",
+		Handler: punsubscribeCommand,
+	},
+	{
+		Name: "publish", Arity: 3, Flags: FlagPubSub | FlagLoading | FlagStale | FlagFast,
+		Group: "pubsub", Summary: "Posts a message to a channel.", Since: "2.0.0",
+		Handler: publishCommand,
+	},
+	{
+		Name: "pubsub", Arity: -2, Flags: FlagPubSub | FlagLoading | FlagStale,
+		Subcommands: map[string]CommandFlags{"channels": 0, "numsub": 0, "numpat": 0},
+		Group:       "pubsub", Summary: "A container for Pub/Sub commands.", Since: "2.8.0",
+		Handler: pubsubCommand,
+	},
+	{
+		Name: "set", Arity: -3, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1,
+		Group: "string", Summary: "Sets the string value of a key, ignoring its type.", Since: "1.0.0",
+		Handler: func(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+			resp, respErr := handler.Set(args, s.Store.KV)
+			if respErr == nil {
+				s.Store.KeyTypeStore.Register(string(args[0]), store.String)
+			}
+			return resp, respErr
+		},
+	},
+	{
+		Name: "get", Arity: 2, Flags: FlagReadOnly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1,
+		Group: "string", Summary: "Returns the string value of a key.", Since: "1.0.0",
+		Handler: func(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+			return handler.Get(args, s.Store.KV)
+		},
+	},
+	{
+		Name: "type", Arity: 2, Flags: FlagReadOnly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1,
+		Group: "generic", Summary: "Determines the type of value stored at a key.", Since: "1.0.0",
+		Handler: func(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+			return &protocol.SimpleString{Data: s.Store.KeyTypeStore.Get(string(args[0]))}, nil
+		},
+	},
+	{
+		Name: "lpush", Arity: -3, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1,
+		Group: "list", Summary: "Prepends one or more elements to a list.", Since: "1.0.0",
+		Handler: func(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+			return handler.LPush(args, s.Store.Lists)
+		},
+	},
+	{
+		Name: "rpush", Arity: -3, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1,
+		Group: "list", Summary: "Appends one or more elements to a list.", Since: "1.0.0",
+		Handler: func(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+			return handler.RPush(args, s.Store.Lists)
+		},
+	},
+	{
+		Name: "lpop", Arity: -2, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1,
+		Group: "list", Summary: "Returns the first elements in a list after removing it.", Since: "1.0.0",
+		Handler: func(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+			return handler.LPop(args, s.Store.Lists)
+		},
+	},
+	{
+		Name: "llen", Arity: 2, Flags: FlagReadOnly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1,
+		Group: "list", Summary: "Returns the length of a list.", Since: "1.0.0",
+		Handler: func(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+			return handler.LLen(args, s.Store.Lists)
+		},
+	},
+	{
+		Name: "lrange", Arity: 4, Flags: FlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1,
+		Group: "list", Summary: "Returns a range of elements from a list.", Since: "1.0.0",
+		Handler: func(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+			return handler.LRange(args, s.Store.Lists)
+		},
+	},
+	{
+		Name: "blpop", Arity: -3, Flags: FlagWrite | FlagBlocking, FirstKey: 1, LastKey: -2, Step: 1,
+		Group: "list", Summary: "Removes and returns the first element in a list. Blocks until an element is available otherwise.", Since: "2.0.0",
+		Handler: blpopCommand,
+	},
+	{
+		Name: "xadd", Arity: -5, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1,
+		Group: "stream", Summary: "Appends a new message to a stream.", Since: "5.0.0",
+		Handler: func(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+			resp, respErr := handler.XAdd(args, s.Store.StreamStore)
+			if respErr == nil {
+				s.Store.KeyTypeStore.Register(string(args[0]), store.Stream)
+			}
+			return resp, respErr
+		},
+	},
+	{
+		Name: "xrange", Arity: -4, Flags: FlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1,
+		Group: "stream", Summary: "Returns the messages from a stream within a range of IDs.", Since: "5.0.0",
+		Handler: func(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+			return handler.XRange(args, s.Store.StreamStore)
+		},
+	},
+	{
+		Name: "xread", Arity: -4, Flags: FlagReadOnly | FlagMovableKeys,
+		GetKeys: xreadKeys,
+		Group:   "stream", Summary: "Returns messages from multiple streams with IDs greater than the ones requested.", Since: "5.0.0",
+		Handler: func(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+			if !bytes.EqualFold(args[0], []byte("STREAMS")) {
+				return nil, &protocol.Error{Message: "ERR syntax error"}
+			}
+			return handler.XReadStreams(args[1:], s.Store.StreamStore, c.rp.Version())
+		},
+	},
+}
+
+// xreadKeys returns the stream keys of XREAD ... STREAMS key... id....
+func xreadKeys(argv [][]byte) [][]byte {
+	for i := 1; i < len(argv); i++ {
+		if bytes.EqualFold(argv[i], []byte("STREAMS")) {
+			rest := argv[i+1:]
+			return rest[:len(rest)/2]
+		}
+	}
+	return nil
+}
+
+// blpopCommand pops under s.mu, like any other write, so the LPOP it
+// propagates is ordered with the pushes around it. It waits without the
+// lock; a push wakes it to try again.
+func blpopCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	timeoutSec, err := strconv.ParseFloat(string(args[len(args)-1]), 64)
+	if err != nil || timeoutSec < 0 {
+		return nil, &protocol.Error{Message: "ERR timeout is not a float or out of range"}
+	}
+	keys := args[:len(args)-1]
+	if c.inExec {
+		// Blocking inside a transaction would stall every other client.
+		if resp := s.lpopFirst(c, keys); resp != nil {
+			return resp, nil
+		}
+		return &protocol.Array{}, nil
+	}
+
+	var expired <-chan time.Time
+	if timeoutSec > 0 {
+		timer := time.NewTimer(time.Duration(timeoutSec * float64(time.Second)))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	for {
+		s.mu.Lock()
+		var resp protocol.RespValue
+		var waiter *store.Waiter
+		if !s.isClosing() {
+			if resp = s.lpopFirst(c, keys); resp == nil {
+				waiter = s.Store.Lists.Wait(stringArgs(keys)...)
+			}
+		}
+		s.mu.Unlock()
+		if resp != nil {
+			return resp, nil
+		}
+		if waiter == nil {
+			return &protocol.Array{}, nil
+		}
+
+		select {
+		case pushed := <-waiter.C:
+			if !pushed {
+				return &protocol.Array{}, nil
+			}
+		case <-expired:
+			s.Store.Lists.StopWaiting(waiter)
+			return &protocol.Array{}, nil
+		case <-c.closed:
+			s.Store.Lists.StopWaiting(waiter)
+			return &protocol.Array{}, nil
+		}
+	}
+}
+
+// lpopFirst pops the first element of the first non-empty list of keys,
+// and touches and propagates it as an LPOP. It returns nil if every list
+// is empty. s.mu must be held.
+func (s *Server) lpopFirst(c *Client, keys [][]byte) protocol.RespValue {
+	for i, key := range keys {
+		popped := s.Store.Lists.LPop(string(key), 1)
+		if len(popped) == 0 {
+			continue
+		}
+		s.touchKeys(keys[i : i+1])
+		if !c.primary {
+			if c.inExec && !c.multiPropagated {
+				s.propagate(c, byteArgs("MULTI"))
+				c.multiPropagated = true
+			}
+			s.propagate(c, [][]byte{[]byte("LPOP"), key})
+		}
+		return &protocol.Array{Elements: []protocol.RespValue{
+			&protocol.BulkString{Data: string(key)},
+			&protocol.BulkBytes{Data: popped[0]},
+		}}
+	}
+	return nil
+}
+
+func commandInfo(cmd *Command) protocol.RespValue {
+	flags := cmd.Flags.Names()
+	flagValues := make([]protocol.RespValue, len(flags))
+	for i, f := range flags {
+		flagValues[i] = &protocol.SimpleString{Data: f}
+	}
+	cats := cmd.Categories()
+	catValues := make([]protocol.RespValue, len(cats))
+	for i, cat := range cats {
+		catValues[i] = &protocol.SimpleString{Data: cat}
+	}
+	return &protocol.Array{Elements: []protocol.RespValue{
+		&protocol.BulkString{Data: cmd.Name},
+		&protocol.IntegerBulkString{Data: int64(cmd.Arity)},
+		&protocol.Set{Elements: flagValues},
+		&protocol.IntegerBulkString{Data: int64(cmd.FirstKey)},
+		&protocol.IntegerBulkString{Data: int64(cmd.LastKey)},
+		&protocol.IntegerBulkString{Data: int64(cmd.Step)},
+		&protocol.Set{Elements: catValues},
+		&protocol.Array{Elements: []protocol.RespValue{}},
+		&protocol.Array{Elements: []protocol.RespValue{}},
+		&protocol.Array{Elements: []protocol.RespValue{}},
+	}}
+}
+
+func commandDocs(cmd *Command) protocol.RespValue {
+	return &protocol.Array{Elements: []protocol.RespValue{
+		&protocol.BulkString{Data: "summary"},
+		&protocol.BulkString{Data: cmd.Summary},
+		&protocol.BulkString{Data: "since"},
+		&protocol.BulkString{Data: cmd.Since},
+		&protocol.BulkString{Data: "group"},
+		&protocol.BulkString{Data: cmd.Group},
+	}}
+}
+
+func commandCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	if len(args) == 0 {
+		cmds := s.Commands.All()
+		elements := make([]protocol.RespValue, len(cmds))
+		for i, cmd := range cmds {
+			elements[i] = commandInfo(cmd)
+		}
+		return &protocol.Array{Elements: elements}, nil
+	}
+
+	switch strings.ToUpper(string(args[0])) {
+	case "COUNT":
+		return &protocol.IntegerBulkString{Data: int64(s.Commands.Len())}, nil
+
+	case "LIST":
+		cmds := s.Commands.All()
+		elements := make([]protocol.RespValue, len(cmds))
+		for i, cmd := range cmds {
+			elements[i] = &protocol.BulkString{Data: cmd.Name}
+		}
+		return &protocol.Array{Elements: elements}, nil
+
+	case "INFO":
+		if len(args) == 1 {
+			return commandCommand(s, c, nil)
+		}
+		elements := make([]protocol.RespValue, len(args)-1)
+		for i, name := range args[1:] {
+			if cmd, ok := s.Commands.lookupArg(name); ok {
+				elements[i] = commandInfo(cmd)
+			} else {
+				elements[i] = &protocol.Array{}
+			}
+		}
+		return &protocol.Array{Elements: elements}, nil
+
+	case "DOCS":
+		var cmds []*Command
+		if len(args) == 1 {
+			cmds = s.Commands.All()
+		} else {
+			for _, name := range args[1:] {
+				if cmd, ok := s.Commands.lookupArg(name); ok {
+					cmds = append(cmds, cmd)
+				}
+			}
+		}
+		entries := make([]protocol.MapEntry, len(cmds))
+		for i, cmd := range cmds {
+			entries[i] = field(cmd.Name, commandDocs(cmd))
+		}
+		return &protocol.Map{Entries: entries}, nil
+
+	default:
+		return nil, &protocol.Error{Message: "ERR unknown subcommand '" + string(args[0]) + "'. Try COMMAND HELP."}
+	}
+}
@@ -0,0 +1,56 @@
+package pkg
+
+import (
+	"net"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+)
+
+// benchClient returns a server and an authenticated client to dispatch
+// commands on directly, without a connection to read them from.
+func benchClient(b *testing.B) (*Server, *Client) {
+	b.Helper()
+	conn, peer := net.Pipe()
+	b.Cleanup(func() {
+		conn.Close()
+		peer.Close()
+	})
+	s := NewServer("", newStore())
+	c := newClient(protocol.NewRespProtocol(conn))
+	c.authenticated = true
+	return s, c
+}
+
+func benchDispatch(b *testing.B, s *Server, c *Client, argv [][]byte) {
+	b.Helper()
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := s.dispatch(c, argv); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSet(b *testing.B) {
+	s, c := benchClient(b)
+	benchDispatch(b, s, c, byteArgs("SET", "key", "value"))
+}
+
+func BenchmarkGet(b *testing.B) {
+	s, c := benchClient(b)
+	if _, err := s.dispatch(c, byteArgs("SET", "key", "value")); err != nil {
+		b.Fatal(err)
+	}
+	benchDispatch(b, s, c, byteArgs("GET", "key"))
+}
+
+func BenchmarkRPush(b *testing.B) {
+	s, c := benchClient(b)
+	benchDispatch(b, s, c, byteArgs("RPUSH", "list", "a", "b", "c"))
+}
+
+func BenchmarkPublish(b *testing.B) {
+	s, c := benchClient(b)
+	benchDispatch(b, s, c, byteArgs("PUBLISH", "channel", "message"))
+}
@@ -0,0 +1,93 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/config"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+)
+
+func configCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	switch strings.ToUpper(string(args[0])) {
+	case "GET":
+		if len(args) < 2 {
+			return nil, &protocol.Error{Message: "ERR wrong number of arguments for 'config|get' command"}
+		}
+		pairs := s.Config.Match(stringArgs(args[1:])...)
+		entries := make([]protocol.MapEntry, len(pairs))
+		for i, pair := range pairs {
+			entries[i] = field(pair[0], &protocol.BulkString{Data: pair[1]})
+		}
+		return &protocol.Map{Entries: entries}, nil
+
+	case "SET":
+		if len(args) < 3 || len(args)%2 == 0 {
+			return nil, &protocol.Error{Message: "ERR wrong number of arguments for 'config|set' command"}
+		}
+		pairs := make([][2]string, 0, len(args)/2)
+		for i := 1; i < len(args); i += 2 {
+			pairs = append(pairs, [2]string{string(args[i]), string(args[i+1])})
+		}
+		previous := make([][2]string, len(pairs))
+		for i, pair := range pairs {
+			previous[i] = [2]string{pair[0], s.Config.Get(strings.ToLower(pair[0]))}
+		}
+		if err := s.Config.Set(pairs); err != nil {
+			return nil, &protocol.Error{Message: "ERR " + err.Error()}
+		}
+		for _, pair := range pairs {
+			if err := s.applyConfig(strings.ToLower(pair[0])); err != nil {
+				s.restoreConfig(previous)
+				return nil, &protocol.Error{Message: "ERR " + err.Error()}
+			}
+		}
+		return &protocol.SimpleString{Data: "OK"}, nil
+
+	case "RESETSTAT":
+		if len(args) != 1 {
+			return nil, &protocol.Error{Message: "ERR wrong number of arguments for 'config|resetstat' command"}
+		}
+		s.stats.reset()
+		s.Store.ResetStats()
+		return &protocol.SimpleString{Data: "OK"}, nil
+
+	default:
+		return nil, &protocol.Error{Message: "ERR unknown subcommand '" + string(args[0]) + "'. Try CONFIG HELP."}
+	}
+}
+
+// restoreConfig puts back the settings a failed CONFIG SET changed, and
+// the state already applied from them.
+func (s *Server) restoreConfig(previous [][2]string) {
+	_ = s.Config.Set(previous)
+	for _, pair := range previous {
+		_ = s.applyConfig(strings.ToLower(pair[0]))
+	}
+}
+
+// applyConfig puts a setting changed by CONFIG SET into effect for state
+// that only reads it once.
+func (s *Server) applyConfig(name string) error {
+	switch name {
+	case "requirepass":
+		s.applyRequirepass()
+	case "proto-max-bulk-len", "client-query-buffer-limit":
+		s.applyLimits()
+	case "repl-backlog-size":
+		s.repl.mu.Lock()
+		if s.repl.backlog != nil {
+			s.repl.backlog.resize(int(s.Config.Int(name)))
+		}
+		s.repl.mu.Unlock()
+	case "tls-cert-file", "tls-key-file", "tls-ca-cert-file", "tls-auth-clients":
+		if !s.tlsEnabled() {
+			return nil
+		}
+		if err := s.loadTLS(); err != nil {
+			fmt.Println("Error loading TLS configuration:", err)
+			return &config.SetError{Name: name, Reason: "Unable to update TLS configuration. Check server logs."}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,407 @@
+// Package config holds the server settings that can come from a redis.conf
+// style file, the command line, and CONFIG SET at runtime.
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/glob"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+)
+
+// param describes one setting. validate normalises a value and rejects
+// invalid ones; immutable settings can only be set at startup.
+type param struct {
+	name      string
+	alias     string
+	def       string
+	immutable bool
+	validate  func(string) (string, error)
+}
+
+var params = []param{
+	{name: "bind", def: "* -::*", immutable: true},
+	{name: "port", def: "6379", immutable: true, validate: intRange(0, 65535)},
+	{name: "unixsocket", def: "", immutable: true},
+	{name: "unixsocketperm", def: "0", immutable: true, validate: fileMode},
+	{name: "tls-port", def: "0", immutable: true, validate: intRange(0, 65535)},
+	{name: "tls-cert-file", def: ""},
+	{name: "tls-key-file", def: ""},
+	{name: "tls-ca-cert-file", def: ""},
+	{name: "tls-auth-clients", def: "yes", validate: oneOf("yes", "no", "optional")},
+	{name: "dir", def: ".", validate: directory},
+	{name: "dbfilename", def: "dump.rdb", validate: filename},
+	{name: "save", def: "", validate: savePoints},
+	{name: "shutdown-timeout", def: "10", validate: intRange(0, 1<<31-1)},
+	{name: "requirepass", def: ""},
+	{name: "aclfile", def: "", immutable: true},
+	{name: "acllog-max-len", def: "128", validate: intRange(0, 1<<31-1)},
+	{name: "slowlog-log-slower-than", def: "10000", validate: intRange(-1<<63, 1<<63-1)},
+	{name: "slowlog-max-len", def: "128", validate: intRange(0, 1<<31-1)},
+	{name: "maxclients", def: "10000", validate: intRange(1, 1<<31-1)},
+	{name: "timeout", def: "0", validate: intRange(0, 1<<31-1)},
+	{name: "proto-max-bulk-len", def: "536870912", validate: memory(1024 * 1024)},
+	{name: "client-query-buffer-limit", def: "1073741824", validate: memory(1024 * 1024)},
+	{name: "tcp-keepalive", def: "300", validate: intRange(0, 1<<31-1)},
+	{name: "replicaof", alias: "slaveof", def: "", immutable: true, validate: hostPort},
+	{name: "masteruser", def: ""},
+	{name: "masterauth", def: ""},
+	{name: "repl-backlog-size", def: "1048576", validate: memory(16 * 1024)},
+}
+
+var paramsByName = func() map[string]*param {
+	m := make(map[string]*param, len(params))
+	for i := range params {
+		m[params[i].name] = &params[i]
+		if params[i].alias != "" {
+			m[params[i].alias] = &params[i]
+		}
+	}
+	return m
+}()
+
+type Config struct {
+	mu     sync.RWMutex
+	values map[string]string
+}
+
+// New returns a Config holding the default value of every setting.
+func New() *Config {
+	values := make(map[string]string, len(params))
+	for _, p := range params {
+		values[p.name] = p.def
+	}
+	return &Config{values: values}
+}
+
+// Parse builds a Config from command-line arguments in the form Redis
+// accepts: an optional configuration file path followed by
+// "--name value ..." options, which override the file.
+func Parse(args []string) (*Config, error) {
+	cfg := New()
+	if len(args) > 0 && !strings.HasPrefix(args[0], "--") {
+		if err := cfg.LoadFile(args[0]); err != nil {
+			return nil, err
+		}
+		args = args[1:]
+	}
+
+	for i := 0; i < len(args); {
+		if !strings.HasPrefix(args[i], "--") {
+			return nil, fmt.Errorf("invalid argument '%s'", args[i])
+		}
+		name := strings.TrimPrefix(args[i], "--")
+		var values []string
+		if before, after, ok := strings.Cut(name, "="); ok {
+			name = before
+			values = append(values, after)
+		}
+		i++
+		for ; i < len(args) && !strings.HasPrefix(args[i], "--"); i++ {
+			values = append(values, args[i])
+		}
+		if err := cfg.setStartup(name, strings.Join(values, " ")); err != nil {
+			return nil, fmt.Errorf("--%s: %w", name, err)
+		}
+	}
+	return cfg, nil
+}
+
+// LoadFile reads settings from a redis.conf style file.
+func (c *Config) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.Load(f, path)
+}
+
+// Load reads settings in redis.conf format: one "name value ..." directive
+// per line, with blank lines and lines starting with '#' ignored.
+func (c *Config) Load(r io.Reader, source string) error {
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		args, err := protocol.SplitArgs(line)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", source, lineNum, err)
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if err := c.setStartup(args[0], strings.Join(args[1:], " ")); err != nil {
+			return fmt.Errorf("%s:%d: %w", source, lineNum, err)
+		}
+	}
+	return scanner.Err()
+}
+
+func (c *Config) setStartup(name, value string) error {
+	p, ok := paramsByName[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("bad directive or wrong number of arguments '%s'", name)
+	}
+	value, err := p.check(value)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[p.name] = value
+	return nil
+}
+
+func (p *param) check(value string) (string, error) {
+	if p.validate == nil {
+		return value, nil
+	}
+	return p.validate(value)
+}
+
+// Get returns the value of a setting, or "" when it does not exist.
+func (c *Config) Get(name string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.values[name]
+}
+
+// Int returns a numeric setting. Values are validated when set, so a
+// parse failure only happens for non-numeric settings and yields 0.
+func (c *Config) Int(name string) int64 {
+	n, _ := strconv.ParseInt(c.Get(name), 10, 64)
+	return n
+}
+
+// BindAddr is an address to listen on. Optional addresses, which bind
+// marks with a leading "-", are skipped if they are unavailable.
+type BindAddr struct {
+	// Network is "tcp4" or "tcp6" for IP addresses, so that wildcards such
+	// as "0.0.0.0" and "::" each take only their own family, and "tcp"
+	// for host names.
+	Network  string
+	Addr     string
+	Optional bool
+}
+
+// BindAddrs returns every bind address with port. "*" stands for all IPv4
+// addresses and "::*" for all IPv6 ones.
+func (c *Config) BindAddrs(port string) []BindAddr {
+	hosts := strings.Fields(c.Get("bind"))
+	if len(hosts) == 0 {
+		hosts = []string{"*"}
+	}
+	addrs := make([]BindAddr, len(hosts))
+	for i, host := range hosts {
+		optional := strings.HasPrefix(host, "-")
+		host = strings.TrimPrefix(host, "-")
+		switch host {
+		case "*":
+			host = "0.0.0.0"
+		case "::*":
+			host = "::"
+		}
+		network := "tcp"
+		if ip := net.ParseIP(host); ip != nil {
+			network = "tcp6"
+			if ip.To4() != nil {
+				network = "tcp4"
+			}
+		}
+		addrs[i] = BindAddr{Network: network, Addr: net.JoinHostPort(host, port), Optional: optional}
+	}
+	return addrs
+}
+
+// Match returns the name/value pairs of every setting whose name matches
+// one of the glob patterns, sorted by name.
+func (c *Config) Match(patterns ...string) [][2]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var pairs [][2]string
+	for _, p := range params {
+		for _, pattern := range patterns {
+			if glob.MatchFold(pattern, p.name) {
+				pairs = append(pairs, [2]string{p.name, c.values[p.name]})
+				break
+			}
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i][0] < pairs[j][0] })
+	return pairs
+}
+
+// SetError is returned by Set when one of the settings cannot be changed.
+type SetError struct {
+	Name   string
+	Reason string
+}
+
+func (e *SetError) Error() string {
+	return fmt.Sprintf("CONFIG SET failed (possibly related to argument '%s') - %s", e.Name, e.Reason)
+}
+
+// UnknownError is returned by Set for a setting that does not exist.
+type UnknownError struct {
+	Name string
+}
+
+func (e *UnknownError) Error() string {
+	return fmt.Sprintf("Unknown option or number of arguments for CONFIG SET - '%s'", e.Name)
+}
+
+// Set changes several settings at runtime. Either every setting is
+// applied or, if one of them is invalid, none is.
+func (c *Config) Set(pairs [][2]string) error {
+	updates := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		p, ok := paramsByName[strings.ToLower(pair[0])]
+		if !ok {
+			return &UnknownError{Name: pair[0]}
+		}
+		if _, dup := updates[p.name]; dup {
+			return &SetError{Name: pair[0], Reason: "duplicate parameter"}
+		}
+		if p.immutable {
+			return &SetError{Name: pair[0], Reason: "can't set immutable config"}
+		}
+		value, err := p.check(pair[1])
+		if err != nil {
+			return &SetError{Name: pair[0], Reason: err.Error()}
+		}
+		updates[p.name] = value
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, value := range updates {
+		c.values[name] = value
+	}
+	return nil
+}
+
+func intRange(min, max int64) func(string) (string, error) {
+	return func(value string) (string, error) {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("argument couldn't be parsed into an integer")
+		}
+		if n < min || n > max {
+			return "", fmt.Errorf("argument must be between %d and %d inclusive", min, max)
+		}
+		return strconv.FormatInt(n, 10), nil
+	}
+}
+
+// oneOf accepts one of a fixed set of values, case-insensitively.
+func oneOf(allowed ...string) func(string) (string, error) {
+	return func(value string) (string, error) {
+		for _, a := range allowed {
+			if strings.EqualFold(value, a) {
+				return a, nil
+			}
+		}
+		return "", fmt.Errorf("argument(s) must be one of the following: %s", strings.Join(allowed, ", "))
+	}
+}
+
+// memory accepts a byte count with an optional unit (k, kb, m, mb, g, gb),
+// where the "b" forms are powers of 1024, and normalises it to bytes.
+func memory(min int64) func(string) (string, error) {
+	units := []struct {
+		suffix string
+		factor int64
+	}{
+		{"kb", 1024}, {"mb", 1024 * 1024}, {"gb", 1024 * 1024 * 1024},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+		{"b", 1},
+	}
+	return func(value string) (string, error) {
+		number, factor := strings.ToLower(value), int64(1)
+		for _, unit := range units {
+			if strings.HasSuffix(number, unit.suffix) {
+				number, factor = strings.TrimSuffix(number, unit.suffix), unit.factor
+				break
+			}
+		}
+		n, err := strconv.ParseInt(number, 10, 64)
+		if err != nil || n < 0 || n > math.MaxInt64/factor {
+			return "", fmt.Errorf("argument must be a memory value")
+		}
+		if n*factor < min {
+			return "", fmt.Errorf("argument must be at least %d bytes", min)
+		}
+		return strconv.FormatInt(n*factor, 10), nil
+	}
+}
+
+// hostPort accepts "<host> <port>", or "no one" for no primary.
+func hostPort(value string) (string, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 || strings.EqualFold(value, "no one") {
+		return "", nil
+	}
+	if len(fields) != 2 {
+		return "", fmt.Errorf("expected <host> <port>")
+	}
+	if _, err := intRange(1, 65535)(fields[1]); err != nil {
+		return "", fmt.Errorf("invalid master port")
+	}
+	return fields[0] + " " + fields[1], nil
+}
+
+// savePoints accepts "<seconds> <changes> ..." pairs, or "" to disable
+// snapshotting.
+func savePoints(value string) (string, error) {
+	fields := strings.Fields(value)
+	if len(fields)%2 != 0 {
+		return "", fmt.Errorf("invalid save parameters")
+	}
+	for _, field := range fields {
+		if n, err := strconv.ParseInt(field, 10, 64); err != nil || n < 0 {
+			return "", fmt.Errorf("invalid save parameters")
+		}
+	}
+	return strings.Join(fields, " "), nil
+}
+
+// fileMode accepts octal permission bits such as 700.
+func fileMode(value string) (string, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0o777 {
+		return "", fmt.Errorf("argument must be an octal file mode")
+	}
+	return strconv.FormatUint(mode, 8), nil
+}
+
+func directory(value string) (string, error) {
+	info, err := os.Stat(value)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", value)
+	}
+	return value, nil
+}
+
+func filename(value string) (string, error) {
+	if value == "" || strings.ContainsRune(value, os.PathSeparator) {
+		return "", fmt.Errorf("dbfilename can't be a path, just a filename")
+	}
+	return value, nil
+}
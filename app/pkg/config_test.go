@@ -0,0 +1,27 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/config"
+)
+
+func TestConfigSetRollsBackAppliedSettings(t *testing.T) {
+	s := NewServer("", newStore())
+	cfg, err := config.Parse([]string{"--tls-port", "6380"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Config = cfg
+
+	_, respErr := configCommand(s, nil, byteArgs("SET", "requirepass", "secret", "tls-cert-file", "/nonexistent.crt"))
+	if respErr == nil {
+		t.Fatal("CONFIG SET with an unreadable certificate succeeded")
+	}
+	if got := s.Config.Get("requirepass"); got != "" {
+		t.Errorf("requirepass = %q after a failed CONFIG SET, want it restored", got)
+	}
+	if s.ACL.AuthRequired() {
+		t.Error("the new password stayed in effect after a failed CONFIG SET")
+	}
+}
@@ -0,0 +1,124 @@
+// Package glob implements the glob-style pattern matching Redis uses for
+// KEYS, PSUBSCRIBE, CONFIG GET and ACL patterns.
+package glob
+
+// Match reports whether str matches pattern. It supports '*', '?',
+// character classes such as [abc], [^abc] and [a-z], and '\' to escape
+// the next character. str may be a string or a byte slice, so that
+// arguments read from a connection are matched without copying them.
+func Match[S string | []byte](pattern string, str S) bool {
+	return match(pattern, str, false)
+}
+
+// MatchFold is like Match but compares letters case-insensitively.
+func MatchFold[S string | []byte](pattern string, str S) bool {
+	return match(pattern, str, true)
+}
+
+// match walks pattern and str together. On a mismatch it backtracks to the
+// most recent '*' only, letting it absorb one more byte: every other token
+// matches exactly one byte, so earlier stars never need to be revisited.
+// That bounds the work by len(pattern)*len(str), where trying every split
+// for every star is exponential in the number of stars.
+func match[S string | []byte](pattern string, str S, fold bool) bool {
+	p, s := 0, 0
+	starP, starS := -1, 0
+	for s < len(str) {
+		if p < len(pattern) {
+			matched, next := true, p+1
+			switch pattern[p] {
+			case '*':
+				starP, starS = p+1, s
+				p++
+				continue
+			case '?':
+			case '[':
+				var rest string
+				matched, rest = matchClass(pattern[p+1:], str[s], fold)
+				next = len(pattern) - len(rest)
+			case '\\':
+				if p+1 < len(pattern) {
+					next = p + 2
+				}
+				matched = equal(pattern[next-1], str[s], fold)
+			default:
+				matched = equal(pattern[p], str[s], fold)
+			}
+			if matched {
+				p, s = next, s+1
+				continue
+			}
+		}
+		if starP < 0 {
+			return false
+		}
+		starS++
+		p, s = starP, starS
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchClass matches c against the class that starts right after '[' and
+// returns the pattern that follows the closing ']'.
+func matchClass(pattern string, c byte, fold bool) (bool, string) {
+	not := len(pattern) > 0 && pattern[0] == '^'
+	if not {
+		pattern = pattern[1:]
+	}
+	matched := false
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) >= 2:
+			pattern = pattern[1:]
+			if equal(pattern[0], c, fold) {
+				matched = true
+			}
+			pattern = pattern[1:]
+
+		case len(pattern) >= 3 && pattern[1] == '-':
+			start, end := pattern[0], pattern[2]
+			if start > end {
+				start, end = end, start
+			}
+			if fold {
+				start, end, c = lower(start), lower(end), lower(c)
+			}
+			if c >= start && c <= end {
+				matched = true
+			}
+			pattern = pattern[3:]
+
+		default:
+			if equal(pattern[0], c, fold) {
+				matched = true
+			}
+			pattern = pattern[1:]
+		}
+	}
+	if len(pattern) > 0 {
+		// Skip the closing ']'. An unterminated class matches like Redis,
+		// treating the end of the pattern as the end of the class.
+		pattern = pattern[1:]
+	}
+	if not {
+		matched = !matched
+	}
+	return matched, pattern
+}
+
+func equal(a, b byte, fold bool) bool {
+	if fold {
+		return lower(a) == lower(b)
+	}
+	return a == b
+}
+
+func lower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + ('a' - 'A')
+	}
+	return c
+}
@@ -0,0 +1,124 @@
+package glob
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, str string
+		want         bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"abc", "abc", true},
+		{"abc", "abd", false},
+		{"abc", "ab", false},
+		{"abc", "abcd", false},
+
+		{"*", "", true},
+		{"*", "anything", true},
+		{"h*o", "hello", true},
+		{"h*o", "ho", true},
+		{"h*o", "hellO", false},
+		{"*o", "hello", true},
+		{"h*", "hello", true},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxbyy", false},
+		{"a*b", "abab", true},
+		{"**", "x", true},
+		{"jobs:*", "jobs:1", true},
+		{"jobs:*", "job:1", false},
+
+		{"?", "a", true},
+		{"?", "", false},
+		{"?", "ab", false},
+		{"h?llo", "hallo", true},
+		{"h?llo", "hllo", false},
+		{"*?", "", false},
+		{"*?", "a", true},
+
+		{"h[ae]llo", "hello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[^ae]llo", "hillo", true},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{"h[c-a]llo", "hbllo", true},
+		{"h[^a-c]llo", "hdllo", true},
+		{"h[^a-c]llo", "hbllo", false},
+		{"[a-cx-z]", "y", true},
+		{"[a-cx-z]", "m", false},
+		{"[-a]", "-", true},
+		{"[]", "a", false},
+		{"[abc", "b", true},
+		{"[abc", "d", false},
+
+		{`\*`, "*", true},
+		{`\*`, "a", false},
+		{`\?`, "?", true},
+		{`\?`, "a", false},
+		{`a\[b`, "a[b", true},
+		{`\\`, `\`, true},
+		{`a\`, `a\`, true},
+		{`[\]]`, "]", true},
+		{`[\-]`, "-", true},
+		{`[\-]`, "a", false},
+		{`[^\]]`, "]", false},
+
+		{"\x00*\xff", "\x00abc\xff", true},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.str); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.str, got, tt.want)
+		}
+		if got := Match(tt.pattern, []byte(tt.str)); got != tt.want {
+			t.Errorf("Match(%q, []byte(%q)) = %v, want %v", tt.pattern, tt.str, got, tt.want)
+		}
+	}
+}
+
+func TestMatchFold(t *testing.T) {
+	tests := []struct {
+		pattern, str string
+		want         bool
+	}{
+		{"maxmemory*", "MaxMemory-Policy", true},
+		{"H?LLO", "hello", true},
+		{"h[A-C]llo", "hbllo", true},
+		{"h[a-c]llo", "HBLLO", true},
+		{"h[^E]llo", "hello", false},
+		{`\H`, "h", true},
+		{"[", "[", false},
+		{"save", "saves", false},
+	}
+	for _, tt := range tests {
+		if got := MatchFold(tt.pattern, tt.str); got != tt.want {
+			t.Errorf("MatchFold(%q, %q) = %v, want %v", tt.pattern, tt.str, got, tt.want)
+		}
+	}
+	if Match("HELLO", "hello") {
+		t.Error(`Match("HELLO", "hello") ignored case`)
+	}
+}
+
+// TestMatchPathological checks that patterns of many stars against a
+// string that almost matches finish in time polynomial in their lengths.
+func TestMatchPathological(t *testing.T) {
+	pattern := strings.Repeat("a*", 50) + "b"
+	str := strings.Repeat("a", 10000)
+	start := time.Now()
+	if Match(pattern, str) {
+		t.Errorf("%q matched a string without b", pattern)
+	}
+	if !Match(pattern, str+"b") {
+		t.Errorf("%q did not match", pattern)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("matching took %v", elapsed)
+	}
+}
@@ -2,10 +2,10 @@ package handler
 
 import "github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
 
-func Echo(args []string) (protocol.RespValue, *protocol.Error) {
+func Echo(args [][]byte) (protocol.RespValue, *protocol.Error) {
 	if len(args) == 0 {
 		return nil, &protocol.Error{Message: "ERR wrong number of arguments for 'ECHO'"}
 	}
 
-	return &protocol.BulkString{Data: args[0]}, nil
+	return &protocol.BulkBytes{Data: args[0]}, nil
 }
@@ -2,72 +2,67 @@ package handler
 
 import (
 	"strconv"
-	"time"
 
 	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
 	"github.com/codecrafters-io/redis-starter-go/app/pkg/store"
 )
 
-func RPush(args []string, store *store.ListsStore) (protocol.RespValue, *protocol.Error) {
+func RPush(args [][]byte, store *store.ListsStore) (protocol.RespValue, *protocol.Error) {
 	if len(args) < 2 {
 		return nil, &protocol.Error{Message: "ERR wrong number of arguments for 'RPUSH'"}
 	}
-	key := args[0]
-	length := store.RPush(key, args[1:]...)
+	length := store.RPush(string(args[0]), protocol.CloneArgs(args[1:])...)
 	return &protocol.IntegerBulkString{Data: int64(length)}, nil
 }
 
-func LRange(args []string, store *store.ListsStore) (protocol.RespValue, *protocol.Error) {
+func LRange(args [][]byte, store *store.ListsStore) (protocol.RespValue, *protocol.Error) {
 	if len(args) < 3 {
 		return nil, &protocol.Error{Message: "ERR wrong number of arguments for 'LRANGE'"}
 	}
-	key := args[0]
-	start, err := strconv.Atoi(args[1])
+	key := string(args[0])
+	start, err := strconv.Atoi(string(args[1]))
 	if err != nil {
 		return nil, &protocol.Error{Message: err.Error()}
 	}
-	end, err := strconv.Atoi(args[2])
+	end, err := strconv.Atoi(string(args[2]))
 	if err != nil {
 		return nil, &protocol.Error{Message: err.Error()}
 	}
 
 	res := store.LRange(key, start, end)
-	elements := make([]protocol.RespValue, len(res))
-	for i, v := range res {
-		elements[i] = &protocol.BulkString{Data: v}
-	}
-
-	return &protocol.Array{Elements: elements}, nil
+	return protocol.Stream(func(e *protocol.Encoder) {
+		e.WriteArrayLen(len(res))
+		for _, v := range res {
+			e.WriteBulk(v)
+		}
+	}), nil
 }
 
-func LPush(args []string, store *store.ListsStore) (protocol.RespValue, *protocol.Error) {
+func LPush(args [][]byte, store *store.ListsStore) (protocol.RespValue, *protocol.Error) {
 	if len(args) < 2 {
 		return nil, &protocol.Error{Message: "ERR wrong number of arguments for 'LPUSH'"}
 	}
-	key := args[0]
-
-	length := store.LPush(key, args[1:]...)
+	length := store.LPush(string(args[0]), protocol.CloneArgs(args[1:])...)
 
 	return &protocol.IntegerBulkString{Data: int64(length)}, nil
 }
 
-func LLen(args []string, store *store.ListsStore) (protocol.RespValue, *protocol.Error) {
+func LLen(args [][]byte, store *store.ListsStore) (protocol.RespValue, *protocol.Error) {
 	if len(args) < 1 {
 		return nil, &protocol.Error{Message: "ERR wrong number of arguments for 'LLEN'"}
 	}
-	key := args[0]
-	length := store.GetLength(key)
+	length := store.GetLength(string(args[0]))
 	return &protocol.IntegerBulkString{Data: int64(length)}, nil
 }
 
-func LPop(args []string, store *store.ListsStore) (protocol.RespValue, *protocol.Error) {
+func LPop(args [][]byte, store *store.ListsStore) (protocol.RespValue, *protocol.Error) {
 	if len(args) < 1 {
 		return nil, &protocol.Error{Message: "ERR wrong number of arguments for 'LPOP'"}
 	}
-	key := args[0]
+	key := string(args[0])
 	numberOfPos := 1
 	if len(args) > 1 {
-		n, err := strconv.Atoi(args[1])
+		n, err := strconv.Atoi(string(args[1]))
 		if err != nil {
 			return nil, &protocol.Error{Message: err.Error()}
 		}
@@ -75,37 +70,11 @@ func LPop(args []string, store *store.ListsStore) (protocol.RespValue, *protocol
 	}
 	res := store.LPop(key, numberOfPos)
 	if len(res) == 1 {
-		return &protocol.BulkString{Data: res[0]}, nil
+		return &protocol.BulkBytes{Data: res[0]}, nil
 	}
 	elements := make([]protocol.RespValue, len(res))
 	for i, v := range res {
-		elements[i] = &protocol.BulkString{Data: v}
+		elements[i] = &protocol.BulkBytes{Data: v}
 	}
 	return &protocol.Array{Elements: elements}, nil
 }
-
-func BLPop(args []string, store *store.ListsStore) (protocol.RespValue, *protocol.Error) {
-	if len(args) < 2 {
-		return nil, &protocol.Error{Message: "ERR wrong number of arguments for 'BLPOP'"}
-	}
-
-	key := args[0]
-	timeoutSec, err := strconv.ParseFloat(args[1], 64)
-	if err != nil {
-		return nil, &protocol.Error{Message: "ERR invalid timeout for 'BLPOP'"}
-	}
-
-	timeout := time.Duration(timeoutSec * float64(time.Second))
-
-	value := store.BLPop(key, timeout)
-	if value == "" {
-		return &protocol.Array{}, nil
-	}
-
-	return &protocol.Array{
-		Elements: []protocol.RespValue{
-			&protocol.BulkString{Data: key},
-			&protocol.BulkString{Data: value},
-		},
-	}, nil
-}
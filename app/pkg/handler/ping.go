@@ -2,6 +2,9 @@ package handler
 
 import "github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
 
-func Ping() (protocol.RespValue, *protocol.Error) {
+func Ping(args [][]byte) (protocol.RespValue, *protocol.Error) {
+	if len(args) > 0 {
+		return &protocol.BulkBytes{Data: args[0]}, nil
+	}
 	return &protocol.SimpleString{Data: "PONG"}, nil
 }
@@ -11,17 +11,18 @@ import (
 	"github.com/codecrafters-io/redis-starter-go/app/pkg/store"
 )
 
-func XAdd(args []string, streamStore *store.StreamStore) (protocol.RespValue, *protocol.Error) {
+func XAdd(args [][]byte, streamStore *store.StreamStore) (protocol.RespValue, *protocol.Error) {
 	if len(args) < 4 || len(args)%2 == 1 {
 		return nil, &protocol.Error{Message: "ERR wrong number of arguments for 'XADD'"}
 	}
-	streamKey := args[0]
-	Id := args[1]
-	keys := make([]string, len(args)/2-1)
-	values := make([]string, len(args)/2-1)
-	for i := 2; i < len(args); i += 2 {
-		keys[i-2] = args[i]
-		values[i-2] = args[i+1]
+	streamKey := string(args[0])
+	Id := string(args[1])
+	fields := protocol.CloneArgs(args[2:])
+	keys := make([][]byte, len(fields)/2)
+	values := make([][]byte, len(fields)/2)
+	for i := range keys {
+		keys[i] = fields[2*i]
+		values[i] = fields[2*i+1]
 	}
 
 	generatedId, err := generateNextId(streamKey, Id, streamStore)
@@ -132,13 +133,13 @@ func generateNextId(key, newId string, streamStore *store.StreamStore) (string,
 	return newId, nil
 }
 
-func XRange(args []string, streamStore *store.StreamStore) (protocol.RespValue, *protocol.Error) {
+func XRange(args [][]byte, streamStore *store.StreamStore) (protocol.RespValue, *protocol.Error) {
 	if len(args) < 3 {
 		return nil, &protocol.Error{Message: "ERR wrong number of arguments for 'XRANGE'"}
 	}
-	streamKey := args[0]
-	start := args[1]
-	end := args[2]
+	streamKey := string(args[0])
+	start := string(args[1])
+	end := string(args[2])
 
 	if !strings.Contains(start, "-") {
 		start += "-0"
@@ -152,32 +153,25 @@ func XRange(args []string, streamStore *store.StreamStore) (protocol.RespValue,
 		return nil, &protocol.Error{Message: "ERR XRange failed"}
 	}
 
-	outerArray := make([]protocol.RespValue, len(results))
-
-	for i, entry := range results {
-		kvArray := make([]protocol.RespValue, len(entry.Keys)+len(entry.Values))
-		idx := 0
-		for j := 0; j < len(entry.Keys); j++ {
-			kvArray[idx] = &protocol.BulkString{Data: entry.Keys[j]}
-			idx++
-			kvArray[idx] = &protocol.BulkString{Data: entry.Values[j]}
-			idx++
-		}
-
-		entryArray := &protocol.Array{
-			Elements: []protocol.RespValue{
-				&protocol.BulkString{Data: entry.Id},
-				&protocol.Array{Elements: kvArray},
-			},
+	// Stream the reply, as a range can be large. results are copies, so
+	// they may be encoded after the store is unlocked.
+	return protocol.Stream(func(e *protocol.Encoder) {
+		e.WriteArrayLen(len(results))
+		for _, entry := range results {
+			e.WriteArrayLen(2)
+			e.WriteBulkString(entry.Id)
+			e.WriteArrayLen(2 * len(entry.Keys))
+			for j := range entry.Keys {
+				e.WriteBulk(entry.Keys[j])
+				e.WriteBulk(entry.Values[j])
+			}
 		}
-
-		outerArray[i] = entryArray
-	}
-
-	return &protocol.Array{Elements: outerArray}, nil
+	}), nil
 }
 
-func XReadStreams(args []string, streamStore *store.StreamStore) (protocol.RespValue, *protocol.Error) {
+// XReadStreams replies with an array of [key, entries] pairs, or with a map
+// of key to entries to RESP3 clients.
+func XReadStreams(args [][]byte, streamStore *store.StreamStore, version int) (protocol.RespValue, *protocol.Error) {
 	if len(args) < 2 || len(args)%2 == 1 {
 		return nil, &protocol.Error{Message: "ERR wrong number of arguments for 'XREAD'"}
 	}
@@ -186,15 +180,23 @@ func XReadStreams(args []string, streamStore *store.StreamStore) (protocol.RespV
 	ids := make([]string, len(args)/2)
 
 	for i := 0; i < len(args)/2; i++ {
-		keys[i] = args[i]
-		ids[i] = args[(len(args)/2)+i]
+		keys[i] = string(args[i])
+		ids[i] = string(args[(len(args)/2)+i])
 	}
 
 	results := streamStore.XReadStreams(keys, ids)
+	if version == 3 {
+		entries := make([]protocol.MapEntry, len(results))
+		for i := 0; i < len(results); i++ {
+			stream := mapStreamToRespArray(keys[i], results[i])
+			entries[i] = protocol.MapEntry{Key: stream.Elements[0], Value: stream.Elements[1]}
+		}
+		return &protocol.Map{Entries: entries}, nil
+	}
 	respResponse := &protocol.Array{}
 	respResponse.Elements = make([]protocol.RespValue, len(results))
 	for i := 0; i < len(results); i++ {
-		respResponse.Elements[i] = mapStreamToRespArray(args[i], results[i])
+		respResponse.Elements[i] = mapStreamToRespArray(keys[i], results[i])
 	}
 
 	return respResponse, nil
@@ -207,8 +209,8 @@ func mapStreamToRespArray(streamKey string, stream []*store.StreamEntry) *protoc
 		// Build inner key-value array: ["temperature", "95"]
 		kvArray := make([]protocol.RespValue, len(entry.Keys)*2)
 		for j := 0; j < len(entry.Keys); j++ {
-			kvArray[j*2] = &protocol.BulkString{Data: entry.Keys[j]}
-			kvArray[j*2+1] = &protocol.BulkString{Data: entry.Values[j]}
+			kvArray[j*2] = &protocol.BulkBytes{Data: entry.Keys[j]}
+			kvArray[j*2+1] = &protocol.BulkBytes{Data: entry.Values[j]}
 		}
 
 		// Each entry = ["0-1", ["temperature", "95"]]
@@ -0,0 +1,139 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+)
+
+// redisVersion is the Redis version whose behaviour the server follows.
+const redisVersion = "7.2.0"
+
+// infoSection is one section of INFO. Sections that are not default are
+// only included when asked for by name, or with "all" or "everything".
+type infoSection struct {
+	name       string
+	render     func(s *Server) string
+	notDefault bool
+}
+
+var infoSections = []infoSection{
+	{name: "server", render: (*Server).serverInfo},
+	{name: "clients", render: (*Server).clientsInfo},
+	{name: "memory", render: (*Server).memoryInfo},
+	{name: "stats", render: (*Server).statsInfo},
+	{name: "replication", render: (*Server).replicationInfo},
+	{name: "commandstats", render: (*Server).commandStatsInfo, notDefault: true},
+	{name: "keyspace", render: (*Server).keyspaceInfo},
+}
+
+func infoCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	defaults, all := len(args) == 0, false
+	wanted := make(map[string]bool, len(args))
+	for _, arg := range args {
+		switch section := strings.ToLower(string(arg)); section {
+		case "default":
+			defaults = true
+		case "all", "everything":
+			all = true
+		default:
+			wanted[section] = true
+		}
+	}
+
+	var parts []string
+	for _, section := range infoSections {
+		if all || wanted[section.name] || (defaults && !section.notDefault) {
+			parts = append(parts, section.render(s))
+		}
+	}
+	return &protocol.VerbatimString{Format: "txt", Data: strings.Join(parts, "\r\n")}, nil
+}
+
+func (s *Server) serverInfo() string {
+	uptime := time.Since(s.startTime)
+	var sb strings.Builder
+	sb.WriteString("# Server\r\n")
+	fmt.Fprintf(&sb, "redis_version:%s\r\n", redisVersion)
+	sb.WriteString("redis_mode:standalone\r\n")
+	fmt.Fprintf(&sb, "os:%s %s\r\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&sb, "arch_bits:%d\r\n", strconv.IntSize)
+	fmt.Fprintf(&sb, "go_version:%s\r\n", runtime.Version())
+	fmt.Fprintf(&sb, "process_id:%d\r\n", os.Getpid())
+	fmt.Fprintf(&sb, "run_id:%s\r\n", s.runID)
+	fmt.Fprintf(&sb, "tcp_port:%s\r\n", s.Config.Get("port"))
+	fmt.Fprintf(&sb, "server_time_usec:%d\r\n", time.Now().UnixMicro())
+	fmt.Fprintf(&sb, "uptime_in_seconds:%d\r\n", int64(uptime/time.Second))
+	fmt.Fprintf(&sb, "uptime_in_days:%d\r\n", int64(uptime/(24*time.Hour)))
+	return sb.String()
+}
+
+func (s *Server) clientsInfo() string {
+	clients, replicas := s.snapshotClients()
+	connected, blocked := 0, 0
+	for _, c := range clients {
+		if replicas[c] {
+			continue
+		}
+		connected++
+		if c.isBlocked() {
+			blocked++
+		}
+	}
+	var sb strings.Builder
+	sb.WriteString("# Clients\r\n")
+	fmt.Fprintf(&sb, "connected_clients:%d\r\n", connected)
+	fmt.Fprintf(&sb, "maxclients:%s\r\n", s.Config.Get("maxclients"))
+	fmt.Fprintf(&sb, "blocked_clients:%d\r\n", blocked)
+	return sb.String()
+}
+
+// memoryInfo reports the Go heap as used memory, which is the closest
+// estimate of what the dataset and client buffers take. It reads
+// runtime/metrics, as runtime.ReadMemStats would stop the world on every
+// INFO.
+func (s *Server) memoryInfo() string {
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/heap/objects:bytes"},
+		{Name: "/memory/classes/total:bytes"},
+	}
+	metrics.Read(samples)
+	used, rss := samples[0].Value.Uint64(), samples[1].Value.Uint64()
+	var sb strings.Builder
+	sb.WriteString("# Memory\r\n")
+	fmt.Fprintf(&sb, "used_memory:%d\r\n", used)
+	fmt.Fprintf(&sb, "used_memory_human:%s\r\n", humanBytes(used))
+	fmt.Fprintf(&sb, "used_memory_rss:%d\r\n", rss)
+	fmt.Fprintf(&sb, "used_memory_rss_human:%s\r\n", humanBytes(rss))
+	sb.WriteString("mem_allocator:go\r\n")
+	return sb.String()
+}
+
+func (s *Server) keyspaceInfo() string {
+	var sb strings.Builder
+	sb.WriteString("# Keyspace\r\n")
+	if keys, expires := s.Store.Counts(); keys > 0 {
+		fmt.Fprintf(&sb, "db0:keys=%d,expires=%d\r\n", keys, expires)
+	}
+	return sb.String()
+}
+
+// humanBytes formats n the way Redis does, e.g. "1.50M".
+func humanBytes(n uint64) string {
+	if n < 1024 {
+		return strconv.FormatUint(n, 10) + "B"
+	}
+	units := []string{"B", "K", "M", "G", "T"}
+	value, unit := float64(n), 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return strconv.FormatFloat(value, 'f', 2, 64) + units[unit]
+}
@@ -0,0 +1,71 @@
+package pkg
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestKeyspaceHitsMisses(t *testing.T) {
+	c := dial(t, startServer(t), nil)
+	for _, cmd := range [][]string{
+		{"SET", "string", "v"},
+		{"RPUSH", "list", "a", "b", "c", "d"},
+		{"XADD", "stream", "1-1", "f", "v"},
+		{"XADD", "stream", "1-2", "f", "v"},
+		{"CONFIG", "RESETSTAT"},
+	} {
+		if _, err := c.Do(cmd...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		cmd          []string
+		hits, misses int
+	}{
+		{[]string{"GET", "string"}, 1, 0},
+		{[]string{"GET", "missing"}, 0, 1},
+		{[]string{"LRANGE", "list", "0", "-1"}, 1, 0},
+		{[]string{"LRANGE", "missing", "0", "-1"}, 0, 1},
+		{[]string{"LLEN", "list"}, 1, 0},
+		{[]string{"LLEN", "missing"}, 0, 1},
+		{[]string{"LPOP", "list"}, 1, 0},
+		{[]string{"LPOP", "missing"}, 0, 1},
+		{[]string{"BLPOP", "missing", "list", "1"}, 1, 1},
+		{[]string{"XRANGE", "stream", "-", "+"}, 1, 0},
+		{[]string{"XRANGE", "missing", "-", "+"}, 0, 1},
+		{[]string{"XREAD", "STREAMS", "stream", "missing", "0-0", "0-0"}, 1, 1},
+		// Writes are not lookups.
+		{[]string{"SET", "missing", "v"}, 0, 0},
+		{[]string{"RPUSH", "list", "e"}, 0, 0},
+	}
+	hits, misses := "0", "0"
+	for _, tt := range tests {
+		// XRANGE of a missing key replies with an error, after the lookup.
+		if _, err := c.Do(tt.cmd...); err != nil && replyError(err) == "" {
+			t.Fatalf("%q: %v", tt.cmd, err)
+		}
+		wantHits, wantMisses := add(t, hits, tt.hits), add(t, misses, tt.misses)
+		hits, misses = infoField(t, c, "stats", "keyspace_hits"), infoField(t, c, "stats", "keyspace_misses")
+		if hits != wantHits || misses != wantMisses {
+			t.Errorf("after %q: %s hits and %s misses, want %s and %s", tt.cmd, hits, misses, wantHits, wantMisses)
+		}
+	}
+
+	if _, err := c.Do("CONFIG", "RESETSTAT"); err != nil {
+		t.Fatal(err)
+	}
+	if hits, misses := infoField(t, c, "stats", "keyspace_hits"), infoField(t, c, "stats", "keyspace_misses"); hits != "0" || misses != "0" {
+		t.Errorf("after CONFIG RESETSTAT: %s hits and %s misses", hits, misses)
+	}
+}
+
+// add returns the decimal counter n plus delta.
+func add(t *testing.T, n string, delta int) string {
+	t.Helper()
+	var v int
+	if _, err := fmt.Sscan(n, &v); err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprint(v + delta)
+}
@@ -0,0 +1,76 @@
+package pkg
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+var errMaxClients = errors.New("ERR max number of clients reached")
+
+// applyLimits updates the request limits of client connections from the
+// configuration. The link to a primary is not limited, as in Redis.
+func (s *Server) applyLimits() {
+	s.limits.MaxBulkLen.Store(s.Config.Int("proto-max-bulk-len"))
+	s.limits.MaxQueryLen.Store(s.Config.Int("client-query-buffer-limit"))
+}
+
+// idleCheckInterval is how often connections are checked against timeout.
+const idleCheckInterval = time.Second
+
+// closeIdleClients closes connections that have been idle for longer than
+// the timeout setting until the server shuts down. As in Redis, blocked
+// and subscribed clients, monitors and replication links are never timed out.
+func (s *Server) closeIdleClients() {
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closing:
+			return
+		case <-ticker.C:
+		}
+		timeout := time.Duration(s.Config.Int("timeout")) * time.Second
+		if timeout == 0 {
+			continue
+		}
+		clients, replicas := s.snapshotClients()
+		for _, c := range clients {
+			if c.primary || replicas[c] {
+				continue
+			}
+			c.mu.Lock()
+			idle := !c.blocked && !c.monitor && c.sub+c.psub == 0 && time.Since(c.lastInteraction) > timeout
+			c.mu.Unlock()
+			if idle {
+				fmt.Println("Closing idle client:", c.addr())
+				_ = c.Close()
+			}
+		}
+	}
+}
+
+// setKeepAlive applies tcp-keepalive to an accepted connection: probes
+// start after that many idle seconds and, like Redis, are sent every third
+// of it. 0 disables keepalive.
+func (s *Server) setKeepAlive(conn net.Conn) {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+	idle := time.Duration(s.Config.Int("tcp-keepalive")) * time.Second
+	if idle == 0 {
+		_ = tcp.SetKeepAlive(false)
+		return
+	}
+	interval := idle / 3
+	if interval < time.Second {
+		interval = time.Second
+	}
+	_ = tcp.SetKeepAliveConfig(net.KeepAliveConfig{Enable: true, Idle: idle, Interval: interval, Count: 3})
+}
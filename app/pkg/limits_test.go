@@ -0,0 +1,116 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+)
+
+// infoField returns the value of field in INFO section.
+func infoField(t *testing.T, c *client.Conn, section, field string) string {
+	t.Helper()
+	info, err := client.String(c.Do("INFO", section))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(info, "\r\n") {
+		if name, value, ok := strings.Cut(line, ":"); ok && name == field {
+			return value
+		}
+	}
+	t.Fatalf("INFO %s has no %s", section, field)
+	return ""
+}
+
+func TestMaxclients(t *testing.T) {
+	addr := startServer(t)
+	admin := dial(t, addr, nil)
+	if _, err := admin.Do("CONFIG", "SET", "maxclients", "2"); err != nil {
+		t.Fatal(err)
+	}
+	second := dial(t, addr, nil)
+	if _, err := second.Do("PING"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The server accepts the connection, replies with the error and
+	// closes it.
+	third := dial(t, addr, nil)
+	if _, err := third.Do("PING"); replyError(err) != "ERR max number of clients reached" {
+		t.Errorf("PING over a connection past maxclients: %v", err)
+	}
+	if _, err := third.Do("PING"); err == nil {
+		t.Error("the connection past maxclients was left open")
+	}
+	if got := infoField(t, admin, "stats", "rejected_connections"); got != "1" {
+		t.Errorf("rejected_connections: %s, want 1", got)
+	}
+	if got := infoField(t, admin, "clients", "connected_clients"); got != "2" {
+		t.Errorf("connected_clients: %s, want 2", got)
+	}
+
+	// Closing a connection frees its slot, once the server notices.
+	second.Close()
+	var err error
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if _, err = dial(t, addr, nil).Do("PING"); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Errorf("PING after a client disconnected: %v", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	addr := startServer(t)
+	admin := dial(t, addr, nil)
+	idle := dial(t, addr, nil)
+	active := dial(t, addr, nil)
+	subscriber := client.NewPubSub(dial(t, addr, nil))
+	if err := subscriber.Subscribe("news"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := subscriber.Receive(); err != nil {
+		t.Fatal(err)
+	}
+	blocked := dial(t, addr, &client.Options{ReadTimeout: 10 * time.Second})
+	if err := blocked.Send("BLPOP", "queue", "0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := blocked.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := admin.Do("CONFIG", "SET", "timeout", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Idle clients are checked every second, so after 2.5 seconds one idle
+	// for more than a second has been closed.
+	for range 5 {
+		time.Sleep(500 * time.Millisecond)
+		if _, err := active.Do("PING"); err != nil {
+			t.Fatalf("PING by an active client: %v", err)
+		}
+	}
+	if _, err := idle.Do("PING"); err == nil {
+		t.Error("PING by an idle client succeeded")
+	}
+
+	// Blocked and subscribed clients are not timed out.
+	if _, err := active.Do("RPUSH", "queue", "job"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := client.Strings(blocked.Receive()); err != nil || len(got) != 2 || got[1] != "job" {
+		t.Errorf("BLPOP: %q, %v", got, err)
+	}
+	if err := subscriber.Ping("still here"); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := subscriber.Receive()
+	if pong, ok := msg.(*client.Pong); err != nil || !ok || pong.Data != "still here" {
+		t.Errorf("PING by a subscriber: %#v, %v", msg, err)
+	}
+}
@@ -0,0 +1,69 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+)
+
+func monitorCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	if c.inExec {
+		return nil, &protocol.Error{Message: "ERR MONITOR isn't allowed for DENY BLOCKING client"}
+	}
+	s.monitorMu.Lock()
+	defer s.monitorMu.Unlock()
+	if _, ok := s.monitors[c]; ok {
+		return nil, nil
+	}
+	s.monitors[c] = struct{}{}
+	s.monitorCount.Add(1)
+	c.mu.Lock()
+	c.monitor = true
+	c.mu.Unlock()
+	return &protocol.SimpleString{Data: "OK"}, nil
+}
+
+func (s *Server) removeMonitor(c *Client) {
+	s.monitorMu.Lock()
+	defer s.monitorMu.Unlock()
+	if _, ok := s.monitors[c]; ok {
+		delete(s.monitors, c)
+		s.monitorCount.Add(-1)
+	}
+}
+
+// feedMonitors sends argv to every monitor other than c, formatted like
+// Redis: +<unix time> [<db> <addr>] "arg" ... Admin commands are not shown,
+// and neither are passwords. Lines are queued, so a monitor that stops
+// reading is disconnected rather than stalling the commands it watches.
+func (s *Server) feedMonitors(c *Client, cmd *Command, argv [][]byte) {
+	if cmd.Has(FlagAdmin) {
+		return
+	}
+	now := time.Now()
+	c.mu.Lock()
+	db := c.db
+	c.mu.Unlock()
+	addr := c.addr()
+	if c.unix {
+		addr = "unix:" + c.rp.Conn.LocalAddr().String()
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d.%06d [%d %s]", now.Unix(), now.Nanosecond()/1000, db, addr)
+	for _, arg := range redactArgs(cmd, argv) {
+		sb.WriteByte(' ')
+		sb.WriteString(protocol.QuoteArg(string(arg)))
+	}
+	line := &protocol.SimpleString{Data: sb.String()}
+
+	s.monitorMu.Lock()
+	defer s.monitorMu.Unlock()
+	for m := range s.monitors {
+		if m != c {
+			m.push(line)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package pkg
+
+import (
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+)
+
+// monitorLine matches the lines MONITOR sends: the time, the database and
+// address of the client, then the arguments.
+var monitorLine = regexp.MustCompile(`^(\d+)\.\d{6} \[0 (\S+)\] (.*)$`)
+
+func TestMonitor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redis.sock")
+	_, addrs := startServerArgs(t, "--unixsocket", path)
+	c := dial(t, addrs[0], nil)
+	addr := clientInfo(t, c)["addr"]
+	unix, err := client.Dial(t.Context(), "unix", path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close()
+	monitor := dial(t, addrs[0], nil)
+	if got, err := client.String(monitor.Do("MONITOR")); err != nil || got != "OK" {
+		t.Fatalf("MONITOR: %q, %v", got, err)
+	}
+	start := time.Now().Unix()
+
+	cmds := []struct {
+		conn *client.Conn
+		args []string
+		// The line MONITOR shows after the address, or "" if none.
+		want string
+	}{
+		{c, []string{"SET", "k", "a \"b\"\n\\\x01\xff"}, `"SET" "k" "a \"b\"\n\\\x01\xff"`},
+		{c, []string{"get", "k"}, `"get" "k"`},
+		{c, []string{"AUTH", "default", "secret"}, `"AUTH" "(redacted)" "(redacted)"`},
+		{c, []string{"HELLO", "2", "AUTH", "default", "secret"}, `"HELLO" "2" "AUTH" "(redacted)" "(redacted)"`},
+		{c, []string{"CONFIG", "GET", "port"}, ""},
+		{unix, []string{"ECHO", ""}, `"ECHO" ""`},
+		{c, []string{"PING"}, `"PING"`},
+	}
+	var want []string
+	for _, cmd := range cmds {
+		if _, err := cmd.conn.Do(cmd.args...); err != nil {
+			t.Fatalf("%q: %v", cmd.args, err)
+		}
+		if cmd.want == "" {
+			continue
+		}
+		from := addr
+		if cmd.conn == unix {
+			from = "unix:" + path
+		}
+		want = append(want, from+" "+cmd.want)
+	}
+
+	for i, w := range want {
+		line, err := client.String(monitor.Receive())
+		if err != nil {
+			t.Fatalf("line %d: %v", i, err)
+		}
+		m := monitorLine.FindStringSubmatch(line)
+		if m == nil {
+			t.Fatalf("line %d: %q is not a MONITOR line", i, line)
+		}
+		if got := m[2] + " " + m[3]; got != w {
+			t.Errorf("line %d: %q, want %q", i, got, w)
+		}
+		if sec, _ := strconv.ParseInt(m[1], 10, 64); sec < start || sec > time.Now().Unix() {
+			t.Errorf("line %d: time %s, want between %d and now", i, m[1], start)
+		}
+	}
+
+	// The monitor's own commands are not shown to it. Its replies and the
+	// lines it is sent are written independently, so either may come first.
+	if err := monitor.Send("ECHO", "mine"); err != nil {
+		t.Fatal(err)
+	}
+	if err := monitor.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Do("ECHO", "other"); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for range 2 {
+		line, err := client.String(monitor.Receive())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := monitorLine.FindStringSubmatch(line); m != nil {
+			line = m[3]
+		}
+		got = append(got, line)
+	}
+	if !slices.Contains(got, "mine") || !slices.Contains(got, `"ECHO" "other"`) {
+		t.Errorf("got %q, want the reply to ECHO mine and the line for ECHO other", got)
+	}
+}
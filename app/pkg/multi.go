@@ -0,0 +1,143 @@
+package pkg
+
+import (
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+)
+
+type queuedCommand struct {
+	cmd  *Command
+	argv [][]byte
+}
+
+// multiState is the transaction a client opened with MULTI.
+type multiState struct {
+	commands []queuedCommand
+	aborted  bool
+}
+
+func multiCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	if c.multi != nil {
+		return nil, &protocol.Error{Message: "ERR MULTI calls can not be nested"}
+	}
+	c.multi = &multiState{}
+	return &protocol.SimpleString{Data: "OK"}, nil
+}
+
+func discardCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	if c.multi == nil {
+		return nil, &protocol.Error{Message: "ERR DISCARD without MULTI"}
+	}
+	c.multi = nil
+	s.unwatchAll(c)
+	return &protocol.SimpleString{Data: "OK"}, nil
+}
+
+func execCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	if c.multi == nil {
+		return nil, &protocol.Error{Message: "ERR EXEC without MULTI"}
+	}
+	multi := c.multi
+	c.multi = nil
+
+	if multi.aborted {
+		s.unwatchAll(c)
+		return nil, &protocol.Error{Message: "EXECABORT Transaction discarded because of previous errors."}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dirty := s.unwatchAll(c)
+	if dirty {
+		return &protocol.Array{}, nil
+	}
+
+	c.inExec = true
+	defer func() {
+		c.inExec = false
+		if c.multiPropagated {
+			s.propagate(c, byteArgs("EXEC"))
+			c.multiPropagated = false
+		}
+	}()
+
+	replies := make([]protocol.RespValue, len(multi.commands))
+	for i, queued := range multi.commands {
+		// Permissions may have changed since the command was queued.
+		if err := s.checkACL(c, queued.cmd, queued.argv, "multi"); err != nil {
+			s.stats.rejected(queued.cmd.fullName(queued.argv))
+			replies[i] = err
+			continue
+		}
+		resp, respErr := s.call(c, queued.cmd, queued.argv)
+		switch {
+		case respErr != nil:
+			replies[i] = respErr
+		case resp != nil:
+			replies[i] = resp
+		default:
+			replies[i] = &protocol.NullBulkString{}
+		}
+	}
+	return &protocol.Array{Elements: replies}, nil
+}
+
+func watchCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	if c.multi != nil {
+		return nil, &protocol.Error{Message: "ERR WATCH inside MULTI is not allowed"}
+	}
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	for _, arg := range args {
+		if _, ok := c.watched[string(arg)]; ok {
+			continue
+		}
+		key := string(arg)
+		clients := s.watched[key]
+		if clients == nil {
+			clients = make(map[*Client]struct{})
+			s.watched[key] = clients
+		}
+		clients[c] = struct{}{}
+		c.watched[key] = struct{}{}
+	}
+	return &protocol.SimpleString{Data: "OK"}, nil
+}
+
+func unwatchCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	s.unwatchAll(c)
+	return &protocol.SimpleString{Data: "OK"}, nil
+}
+
+// unwatchAll forgets every key c watches and reports whether any of them
+// was modified since it was watched.
+func (s *Server) unwatchAll(c *Client) bool {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	for key := range c.watched {
+		clients := s.watched[key]
+		delete(clients, c)
+		if len(clients) == 0 {
+			delete(s.watched, key)
+		}
+		delete(c.watched, key)
+	}
+	dirty := c.dirty
+	c.dirty = false
+	return dirty
+}
+
+// touchKeys marks every client watching one of keys as dirty so that its
+// next EXEC fails.
+func (s *Server) touchKeys(keys [][]byte) {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	if len(s.watched) == 0 {
+		return
+	}
+	for _, key := range keys {
+		for c := range s.watched[string(key)] {
+			c.dirty = true
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package pkg
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+)
+
+// execReply runs cmds as a transaction and returns the replies to the
+// queued commands and to EXEC.
+func execReply(t *testing.T, c *client.Conn, cmds ...[]string) ([]protocol.RespValue, protocol.RespValue) {
+	t.Helper()
+	pipeline := append([][]string{{"MULTI"}}, cmds...)
+	pipeline = append(pipeline, []string{"EXEC"})
+	replies, err := c.Pipeline(pipeline...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := client.String(replies[0], nil); err != nil || got != "OK" {
+		t.Fatalf("MULTI: %q, %v", got, err)
+	}
+	return replies[1 : len(replies)-1], replies[len(replies)-1]
+}
+
+// errorPrefix returns the error code of an error reply, or "" if reply is
+// not an error.
+func errorPrefix(reply protocol.RespValue) string {
+	err, ok := reply.(*protocol.Error)
+	if !ok {
+		return ""
+	}
+	code, _, _ := strings.Cut(err.Message, " ")
+	return code
+}
+
+func TestWatch(t *testing.T) {
+	addr := startServer(t)
+	c := dial(t, addr, nil)
+	other := dial(t, addr, nil)
+
+	tests := []struct {
+		name    string
+		watch   []string
+		between [][]string
+		aborted bool
+	}{
+		{"unchanged", []string{"k"}, nil, false},
+		{"written by another client", []string{"k"}, [][]string{{"SET", "k", "other"}}, true},
+		{"one of several keys written", []string{"a", "k", "b"}, [][]string{{"RPUSH", "b", "x"}}, true},
+		{"other key written", []string{"k"}, [][]string{{"SET", "unwatched", "x"}}, false},
+		{"read by another client", []string{"k"}, [][]string{{"GET", "k"}}, false},
+		{"unwatched before the write", []string{"k"}, [][]string{{"UNWATCH"}, {"SET", "k", "other"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := c.Do(append([]string{"WATCH"}, tt.watch...)...); err != nil {
+				t.Fatal(err)
+			}
+			for _, cmd := range tt.between {
+				conn := other
+				if cmd[0] == "UNWATCH" {
+					conn = c
+				}
+				if _, err := conn.Do(cmd...); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, exec := execReply(t, c, []string{"SET", "k", "mine"})
+			array, ok := exec.(*protocol.Array)
+			if !ok {
+				t.Fatalf("EXEC: %#v", exec)
+			}
+			if aborted := array.Elements == nil; aborted != tt.aborted {
+				t.Fatalf("EXEC aborted: %v, want %v", aborted, tt.aborted)
+			}
+			want := "mine"
+			if tt.aborted {
+				want = "other"
+			}
+			if got, err := client.String(c.Do("GET", "k")); err != nil || got != want {
+				t.Errorf("GET after EXEC: %q, %v, want %q", got, err, want)
+			}
+
+			// EXEC forgets the watched keys, so the next transaction runs
+			// whatever is written in between.
+			if _, err := other.Do("SET", "k", "other"); err != nil {
+				t.Fatal(err)
+			}
+			if _, exec := execReply(t, c, []string{"PING"}); exec.(*protocol.Array).Elements == nil {
+				t.Error("EXEC aborted by a key watched before the previous EXEC")
+			}
+		})
+	}
+}
+
+func TestExecAbort(t *testing.T) {
+	c := dial(t, startServer(t), nil)
+
+	tests := []struct {
+		name    string
+		invalid []string
+		code    string
+	}{
+		{"unknown command", []string{"NOSUCHCOMMAND"}, "ERR"},
+		{"wrong arity", []string{"SET", "k"}, "ERR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queued, exec := execReply(t, c, []string{"SET", "k", "1"}, tt.invalid, []string{"SET", "k", "2"})
+			if got, err := client.String(queued[0], nil); err != nil || got != "QUEUED" {
+				t.Errorf("SET before the error: %q, %v", got, err)
+			}
+			if code := errorPrefix(queued[1]); code != tt.code {
+				t.Errorf("queuing %q: %#v, want a %s error", tt.invalid, queued[1], tt.code)
+			}
+			if code := errorPrefix(exec); code != "EXECABORT" {
+				t.Errorf("EXEC: %#v, want EXECABORT", exec)
+			}
+			if _, err := client.String(c.Do("GET", "k")); err != client.ErrNil {
+				t.Errorf("GET after EXECABORT: %v, want ErrNil", err)
+			}
+		})
+	}
+
+	// Errors while running a queued command are reported in its reply and
+	// do not stop the rest.
+	_, exec := execReply(t, c, []string{"SET", "k", "v"}, []string{"XADD", "s", "0-0", "f", "v"}, []string{"SET", "k", "w"})
+	array, ok := exec.(*protocol.Array)
+	if !ok || len(array.Elements) != 3 {
+		t.Fatalf("EXEC: %#v", exec)
+	}
+	if code := errorPrefix(array.Elements[1]); code != "ERR" {
+		t.Errorf("XADD with ID 0-0: %#v, want an error", array.Elements[1])
+	}
+	if got, err := client.String(c.Do("GET", "k")); err != nil || got != "w" {
+		t.Errorf("GET: %q, %v", got, err)
+	}
+}
+
+func TestDiscard(t *testing.T) {
+	addr := startServer(t)
+	c := dial(t, addr, nil)
+
+	replies, err := c.Pipeline([]string{"WATCH", "k"}, []string{"MULTI"}, []string{"SET", "k", "1"}, []string{"DISCARD"}, []string{"GET", "k"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := client.String(replies[3], nil); err != nil || got != "OK" {
+		t.Errorf("DISCARD: %q, %v", got, err)
+	}
+	if _, err := client.String(replies[4], nil); err != client.ErrNil {
+		t.Errorf("GET after DISCARD: %v, want ErrNil", err)
+	}
+
+	// DISCARD also forgets the watched keys.
+	if _, err := dial(t, addr, nil).Do("SET", "k", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if _, exec := execReply(t, c, []string{"SET", "k", "2"}); exec.(*protocol.Array).Elements == nil {
+		t.Error("EXEC aborted by a key watched before DISCARD")
+	}
+
+	for _, cmd := range []string{"DISCARD", "EXEC"} {
+		var replyErr *protocol.Error
+		if _, err := c.Do(cmd); !errors.As(err, &replyErr) || replyErr.Message != "ERR "+cmd+" without MULTI" {
+			t.Errorf("%s without MULTI: %v", cmd, err)
+		}
+	}
+}
+
+func TestNotAllowedInMulti(t *testing.T) {
+	c := dial(t, startServer(t), nil)
+
+	tests := []struct {
+		cmd  []string
+		want string
+	}{
+		{[]string{"MULTI"}, "ERR MULTI calls can not be nested"},
+		{[]string{"WATCH", "k"}, "ERR WATCH inside MULTI is not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cmd[0], func(t *testing.T) {
+			queued, exec := execReply(t, c, []string{"SET", "k", tt.cmd[0]}, tt.cmd)
+			if err, ok := queued[1].(*protocol.Error); !ok || err.Message != tt.want {
+				t.Errorf("%s inside MULTI: %#v, want %q", tt.cmd[0], queued[1], tt.want)
+			}
+			// The refused command is not part of the transaction, which
+			// still runs.
+			array, ok := exec.(*protocol.Array)
+			if !ok || len(array.Elements) != 1 {
+				t.Fatalf("EXEC: %#v, want the reply to SET alone", exec)
+			}
+			if got, err := client.String(c.Do("GET", "k")); err != nil || got != tt.cmd[0] {
+				t.Errorf("GET: %q, %v", got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package pkg
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/rdb"
+)
+
+// persistenceEnabled reports whether snapshotting is configured, which it
+// is not by default. Save points are not scheduled; the snapshot is only
+// written on shutdown.
+func (s *Server) persistenceEnabled() bool {
+	return s.Config.Get("save") != ""
+}
+
+func (s *Server) rdbPath() string {
+	return filepath.Join(s.Config.Get("dir"), s.Config.Get("dbfilename"))
+}
+
+// loadRDB replaces the dataset with the snapshot on disk, if there is one.
+func (s *Server) loadRDB() error {
+	f, err := os.Open(s.rdbPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return rdb.Load(bufio.NewReader(f), s.Store)
+}
+
+// saveRDB writes a snapshot to a temporary file and renames it over the
+// previous one, so a failed save never leaves a truncated file behind.
+// The caller must hold s.mu.
+func (s *Server) saveRDB() error {
+	path := s.rdbPath()
+	f, err := os.CreateTemp(filepath.Dir(path), "temp-*.rdb")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	w := bufio.NewWriter(f)
+	if err := rdb.Save(w, s.Store); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,151 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrUnbalancedQuotes = errors.New("unbalanced quotes")
+
+// SplitArgs splits a line into arguments the way Redis does for inline
+// commands and configuration files. Arguments are separated by spaces and
+// may be wrapped in double quotes, which support escapes such as \n and
+// \x41, or in single quotes, which only support \'.
+func SplitArgs(line string) ([]string, error) {
+	var args []string
+	i := 0
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i >= len(line) {
+			return args, nil
+		}
+
+		var sb strings.Builder
+		inDouble, inSingle, done := false, false, false
+		for !done {
+			if inDouble {
+				if i >= len(line) {
+					return nil, ErrUnbalancedQuotes
+				}
+				switch {
+				case line[i] == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHex(line[i+2]) && isHex(line[i+3]):
+					sb.WriteByte(hexValue(line[i+2])<<4 | hexValue(line[i+3]))
+					i += 3
+				case line[i] == '\\' && i+1 < len(line):
+					i++
+					switch line[i] {
+					case 'n':
+						sb.WriteByte('\n')
+					case 'r':
+						sb.WriteByte('\r')
+					case 't':
+						sb.WriteByte('\t')
+					case 'b':
+						sb.WriteByte('\b')
+					case 'a':
+						sb.WriteByte('\a')
+					default:
+						sb.WriteByte(line[i])
+					}
+				case line[i] == '"':
+					// The closing quote must be followed by a space or the end.
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, ErrUnbalancedQuotes
+					}
+					done = true
+				default:
+					sb.WriteByte(line[i])
+				}
+			} else if inSingle {
+				if i >= len(line) {
+					return nil, ErrUnbalancedQuotes
+				}
+				switch {
+				case line[i] == '\\' && i+1 < len(line) && line[i+1] == '\'':
+					i++
+					sb.WriteByte('\'')
+				case line[i] == '\'':
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, ErrUnbalancedQuotes
+					}
+					done = true
+				default:
+					sb.WriteByte(line[i])
+				}
+			} else {
+				if i >= len(line) {
+					break
+				}
+				switch line[i] {
+				case ' ', '\n', '\r', '\t', 0:
+					done = true
+				case '"':
+					inDouble = true
+				case '\'':
+					inSingle = true
+				default:
+					sb.WriteByte(line[i])
+				}
+			}
+			if i < len(line) {
+				i++
+			}
+		}
+		args = append(args, sb.String())
+	}
+}
+
+// QuoteArg wraps s in double quotes, escaping it so that SplitArgs reads
+// it back unchanged, the way Redis prints arguments in MONITOR output.
+func QuoteArg(s string) string {
+	var sb strings.Builder
+	sb.Grow(len(s) + 2)
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '"':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\a':
+			sb.WriteString(`\a`)
+		case '\b':
+			sb.WriteString(`\b`)
+		default:
+			if c < ' ' || c > '~' {
+				fmt.Fprintf(&sb, "\\x%02x", c)
+			} else {
+				sb.WriteByte(c)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\v' || c == '\f'
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func hexValue(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
@@ -0,0 +1,264 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"math"
+	"strconv"
+)
+
+// writer is implemented by both *bufio.Writer and *bytes.Buffer.
+type writer interface {
+	io.Writer
+	io.ByteWriter
+	io.StringWriter
+}
+
+// Encoder writes replies in RESP2 or RESP3 straight to a writer, without
+// building them in memory first. Write errors are not reported by each
+// call; a bufio.Writer keeps the first one and returns it from Flush.
+type Encoder struct {
+	out     writer
+	w       writer // out, or the innermost deferred aggregate
+	version int
+
+	deferred []*bytes.Buffer
+	scratch  []byte
+}
+
+// NewEncoder returns an Encoder writing the given protocol version, 2 or
+// 3, to w. Unless w is a *bufio.Writer or *bytes.Buffer, it is buffered,
+// and Flush must be called once done.
+func NewEncoder(w io.Writer, version int) *Encoder {
+	out, ok := w.(writer)
+	if !ok {
+		out = bufio.NewWriter(w)
+	}
+	return &Encoder{out: out, w: out, version: version}
+}
+
+// Encode returns value in the given protocol version, 2 or 3.
+func Encode(value RespValue, version int) []byte {
+	var buf bytes.Buffer
+	NewEncoder(&buf, version).WriteValue(value)
+	return buf.Bytes()
+}
+
+func (e *Encoder) Version() int {
+	return e.version
+}
+
+// Flush writes out data buffered by an Encoder that NewEncoder wrapped in
+// a bufio.Writer, or by the *bufio.Writer it was given.
+func (e *Encoder) Flush() error {
+	if f, ok := e.out.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// encoder is implemented by every RespValue in this package.
+type encoder interface {
+	encode(e *Encoder)
+}
+
+// WriteValue writes a complete reply.
+func (e *Encoder) WriteValue(value RespValue) {
+	if v, ok := value.(encoder); ok {
+		v.encode(e)
+		return
+	}
+	_, _ = e.w.Write(value.ToBytes())
+}
+
+func (e *Encoder) writeLine(prefix byte, s string) {
+	_ = e.w.WriteByte(prefix)
+	_, _ = e.w.WriteString(s)
+	_, _ = e.w.WriteString("\r\n")
+}
+
+func (e *Encoder) writeInt(prefix byte, n int64) {
+	_ = e.w.WriteByte(prefix)
+	e.scratch = strconv.AppendInt(e.scratch[:0], n, 10)
+	e.scratch = append(e.scratch, '\r', '\n')
+	_, _ = e.w.Write(e.scratch)
+}
+
+func (e *Encoder) WriteSimpleString(s string) {
+	e.writeLine('+', s)
+}
+
+func (e *Encoder) WriteError(message string) {
+	e.writeLine('-', message)
+}
+
+func (e *Encoder) WriteInteger(n int64) {
+	e.writeInt(':', n)
+}
+
+func (e *Encoder) WriteBulkString(s string) {
+	e.writeInt('$', int64(len(s)))
+	_, _ = e.w.WriteString(s)
+	_, _ = e.w.WriteString("\r\n")
+}
+
+func (e *Encoder) WriteBulk(b []byte) {
+	e.writeInt('$', int64(len(b)))
+	_, _ = e.w.Write(b)
+	_, _ = e.w.WriteString("\r\n")
+}
+
+// WriteNull writes a null, which RESP2 clients receive as a null bulk
+// string.
+func (e *Encoder) WriteNull() {
+	if e.version == 3 {
+		_, _ = e.w.WriteString("_\r\n")
+		return
+	}
+	_, _ = e.w.WriteString("$-1\r\n")
+}
+
+// WriteNullArray writes a null, which RESP2 clients receive as a null
+// array.
+func (e *Encoder) WriteNullArray() {
+	if e.version == 3 {
+		_, _ = e.w.WriteString("_\r\n")
+		return
+	}
+	_, _ = e.w.WriteString("*-1\r\n")
+}
+
+// WriteArrayLen starts an array of n elements, which must follow.
+func (e *Encoder) WriteArrayLen(n int) {
+	e.writeInt('*', int64(n))
+}
+
+// WriteMapLen starts a map of n key-value pairs, which must follow as 2n
+// values. RESP2 clients receive a flat array.
+func (e *Encoder) WriteMapLen(n int) {
+	if e.version == 3 {
+		e.writeInt('%', int64(n))
+		return
+	}
+	e.writeInt('*', 2*int64(n))
+}
+
+// WriteSetLen starts a set of n elements, which RESP2 clients receive as
+// an array.
+func (e *Encoder) WriteSetLen(n int) {
+	e.writeAggregateLen('~', n)
+}
+
+// WritePushLen starts a push message of n elements, which RESP2 clients
+// receive as an array.
+func (e *Encoder) WritePushLen(n int) {
+	e.writeAggregateLen('>', n)
+}
+
+func (e *Encoder) writeAggregateLen(resp3Prefix byte, n int) {
+	if e.version == 3 {
+		e.writeInt(resp3Prefix, int64(n))
+		return
+	}
+	e.writeInt('*', int64(n))
+}
+
+// WriteDouble writes a double, which RESP2 clients receive as a bulk
+// string.
+func (e *Encoder) WriteDouble(f float64) {
+	var s string
+	switch {
+	case math.IsInf(f, 1):
+		s = "inf"
+	case math.IsInf(f, -1):
+		s = "-inf"
+	case math.IsNaN(f):
+		s = "nan"
+	default:
+		s = strconv.FormatFloat(f, 'g', 17, 64)
+	}
+	if e.version == 3 {
+		e.writeLine(',', s)
+		return
+	}
+	e.WriteBulkString(s)
+}
+
+// WriteBoolean writes a boolean, which RESP2 clients receive as the
+// integer 1 or 0.
+func (e *Encoder) WriteBoolean(b bool) {
+	switch {
+	case e.version == 3 && b:
+		_, _ = e.w.WriteString("#t\r\n")
+	case e.version == 3:
+		_, _ = e.w.WriteString("#f\r\n")
+	case b:
+		_, _ = e.w.WriteString(":1\r\n")
+	default:
+		_, _ = e.w.WriteString(":0\r\n")
+	}
+}
+
+// WriteVerbatimString writes text with a three-letter format such as
+// "txt", which RESP2 clients receive as a bulk string.
+func (e *Encoder) WriteVerbatimString(format, s string) {
+	if e.version != 3 {
+		e.WriteBulkString(s)
+		return
+	}
+	e.writeInt('=', int64(len(format)+1+len(s)))
+	_, _ = e.w.WriteString(format)
+	_ = e.w.WriteByte(':')
+	_, _ = e.w.WriteString(s)
+	_, _ = e.w.WriteString("\r\n")
+}
+
+// DeferLen starts an aggregate whose length is not known until its
+// elements have been written. The elements are held back until the
+// matching SetDeferredArrayLen or SetDeferredMapLen, which writes the
+// header followed by them. Deferred aggregates may be nested.
+func (e *Encoder) DeferLen() {
+	buf := new(bytes.Buffer)
+	e.deferred = append(e.deferred, buf)
+	e.w = buf
+}
+
+// SetDeferredArrayLen completes the innermost DeferLen as an array of n
+// elements.
+func (e *Encoder) SetDeferredArrayLen(n int) {
+	e.endDeferred(func() { e.WriteArrayLen(n) })
+}
+
+// SetDeferredMapLen completes the innermost DeferLen as a map of n
+// key-value pairs.
+func (e *Encoder) SetDeferredMapLen(n int) {
+	e.endDeferred(func() { e.WriteMapLen(n) })
+}
+
+func (e *Encoder) endDeferred(writeHeader func()) {
+	last := len(e.deferred) - 1
+	buf := e.deferred[last]
+	e.deferred = e.deferred[:last]
+	if last == 0 {
+		e.w = e.out
+	} else {
+		e.w = e.deferred[last-1]
+	}
+	writeHeader()
+	_, _ = e.w.Write(buf.Bytes())
+}
+
+// Stream is a reply that writes itself with an Encoder, so that a handler
+// can send a large reply without building a tree of RespValues. It runs
+// after the handler has returned and its locks are released, so it must
+// only use data the handler has already copied.
+type Stream func(e *Encoder)
+
+func (s Stream) ToBytes() []byte {
+	return Encode(s, 2)
+}
+
+func (s Stream) encode(e *Encoder) {
+	s(e)
+}
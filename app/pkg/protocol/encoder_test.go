@@ -0,0 +1,122 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// rangeReplies are the shapes of large LRANGE and XRANGE replies, built
+// as values, the way ToBytes encodes them, and streamed to an Encoder,
+// the way the handlers write them.
+var rangeReplies = []struct {
+	name   string
+	value  func() RespValue
+	stream func(e *Encoder)
+}{
+	{"lrange", lrangeValue, lrangeStream},
+	{"xrange", xrangeValue, xrangeStream},
+}
+
+const (
+	rangeLen   = 10000
+	rangeField = "field"
+)
+
+var rangeElement = bytes.Repeat([]byte("x"), 100)
+
+var streamIDs = func() []string {
+	ids := make([]string, rangeLen)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("1700000000000-%d", i)
+	}
+	return ids
+}()
+
+func lrangeValue() RespValue {
+	elements := make([]RespValue, rangeLen)
+	for i := range elements {
+		elements[i] = &BulkBytes{Data: rangeElement}
+	}
+	return &Array{Elements: elements}
+}
+
+func lrangeStream(e *Encoder) {
+	e.WriteArrayLen(rangeLen)
+	for range rangeLen {
+		e.WriteBulk(rangeElement)
+	}
+}
+
+func xrangeValue() RespValue {
+	entries := make([]RespValue, rangeLen)
+	for i := range entries {
+		entries[i] = &Array{Elements: []RespValue{
+			&BulkString{Data: streamIDs[i]},
+			&Array{Elements: []RespValue{&BulkString{Data: rangeField}, &BulkBytes{Data: rangeElement}}},
+		}}
+	}
+	return &Array{Elements: entries}
+}
+
+func xrangeStream(e *Encoder) {
+	e.WriteArrayLen(rangeLen)
+	for _, id := range streamIDs {
+		e.WriteArrayLen(2)
+		e.WriteBulkString(id)
+		e.WriteArrayLen(2)
+		e.WriteBulkString(rangeField)
+		e.WriteBulk(rangeElement)
+	}
+}
+
+func TestEncoderMatchesToBytes(t *testing.T) {
+	for _, r := range rangeReplies {
+		t.Run(r.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			e := NewEncoder(&buf, 2)
+			r.stream(e)
+			if err := e.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), r.value().ToBytes()) {
+				t.Error("streamed reply differs from ToBytes")
+			}
+		})
+	}
+}
+
+// BenchmarkEncoder streams large replies through a buffer the size of a
+// connection's, without building them first.
+func BenchmarkEncoder(b *testing.B) {
+	for _, r := range rangeReplies {
+		b.Run(r.name, func(b *testing.B) {
+			w := bufio.NewWriterSize(io.Discard, ReplyBufferSize)
+			e := NewEncoder(w, 2)
+			b.ReportAllocs()
+			for b.Loop() {
+				r.stream(e)
+				if err := e.Flush(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkToBytes builds the same replies as values and encodes them
+// whole with ToBytes.
+func BenchmarkToBytes(b *testing.B) {
+	for _, r := range rangeReplies {
+		b.Run(r.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := io.Discard.Write(r.value().ToBytes()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"sync/atomic"
+)
+
+// InlineMaxSize is the longest inline command accepted, as in Redis.
+const InlineMaxSize = 64 * 1024
+
+// MaxMultibulkLen is the most arguments a request may have.
+const MaxMultibulkLen = 1024 * 1024
+
+// Buffers for requests start at most this large and grow as data arrives,
+// so a length header alone cannot make the server allocate much memory.
+const initialAlloc = 64 * 1024
+
+// Limits bounds the requests a connection accepts. One Limits is shared
+// by the server's connections, so it is updated atomically.
+type Limits struct {
+	// MaxBulkLen is the largest argument accepted (proto-max-bulk-len).
+	MaxBulkLen atomic.Int64
+	// MaxQueryLen is the largest request accepted
+	// (client-query-buffer-limit).
+	MaxQueryLen atomic.Int64
+}
+
+// ProtocolError reports a malformed request. The rest of the stream can
+// no longer be framed, so servers reply with it and close the connection.
+type ProtocolError struct {
+	Reason string
+}
+
+func (e *ProtocolError) Error() string {
+	return "Protocol error: " + e.Reason
+}
+
+// Read returns the next request, either a RESP array of bulk strings or an
+// inline command: a line of space-separated arguments, as typed into telnet.
+// Blank inline lines and empty arrays yield no arguments.
+//
+// The arguments share a buffer that the next Read reuses, so a caller that
+// keeps one beyond that must copy it.
+//
+// Bulk strings are read by length, so they may contain any bytes,
+// including CRLF. Every length and line ending is checked, and a
+// connection closed in the middle of a request fails with
+// io.ErrUnexpectedEOF. Requests exceeding rp.Limits fail with a
+// ProtocolError; without Limits only the framing is checked.
+func (rp *RespProtocol) Read() ([][]byte, error) {
+	first, err := rp.Reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	rp.resetBuffers()
+	if first[0] != '*' {
+		return rp.readInline()
+	}
+
+	line, err := rp.readLine()
+	if err != nil {
+		return nil, err
+	}
+	rp.keepRaw(line)
+	consumed := int64(len(line))
+	numElements, ok := parseLength(line)
+	if !ok || (rp.Limits != nil && numElements > MaxMultibulkLen) {
+		return nil, &ProtocolError{Reason: "invalid multibulk length"}
+	}
+
+	for i := 0; i < numElements; i++ {
+		n, err := rp.readBulkString(consumed)
+		if err != nil {
+			return nil, err
+		}
+		consumed += n
+	}
+
+	rp.Consumed += consumed
+	return rp.splitArgs(), nil
+}
+
+// resetBuffers empties the buffers of the previous request, dropping any
+// that an unusually large request grew.
+func (rp *RespProtocol) resetBuffers() {
+	if cap(rp.buf) > initialAlloc {
+		rp.buf = nil
+	}
+	if cap(rp.ends) > initialAlloc/16 {
+		rp.args, rp.ends = nil, nil
+	}
+	if cap(rp.Raw) > initialAlloc {
+		rp.Raw = nil
+	}
+	rp.buf, rp.args, rp.ends, rp.Raw = rp.buf[:0], rp.args[:0], rp.ends[:0], rp.Raw[:0]
+}
+
+// keepRaw records bytes of the request being read, if rp.KeepRaw is set.
+func (rp *RespProtocol) keepRaw(b []byte) {
+	if rp.KeepRaw {
+		rp.Raw = append(rp.Raw, b...)
+	}
+}
+
+// splitArgs slices rp.buf into the arguments that rp.ends delimits. Each
+// is capped at its own length, so appending to one copies it rather than
+// overwriting the next.
+func (rp *RespProtocol) splitArgs() [][]byte {
+	start := 0
+	for _, end := range rp.ends {
+		rp.args = append(rp.args, rp.buf[start:end:end])
+		start = end
+	}
+	return rp.args
+}
+
+// CloneArgs copies args, such as those Read returned, into a single new
+// allocation, for callers that keep them.
+func CloneArgs(args [][]byte) [][]byte {
+	size := 0
+	for _, arg := range args {
+		size += len(arg)
+	}
+	buf := make([]byte, 0, size)
+	clone := make([][]byte, len(args))
+	for i, arg := range args {
+		start := len(buf)
+		buf = append(buf, arg...)
+		clone[i] = buf[start:len(buf):len(buf)]
+	}
+	return clone
+}
+
+// readInline reads an inline command, which may end with a bare LF.
+func (rp *RespProtocol) readInline() ([][]byte, error) {
+	var line []byte
+	for {
+		chunk, err := rp.Reader.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > InlineMaxSize {
+			return nil, &ProtocolError{Reason: "too big inline request"}
+		}
+		if err == nil {
+			break
+		}
+		if err != bufio.ErrBufferFull {
+			return nil, unexpectedEOF(err)
+		}
+	}
+	args, err := SplitArgs(string(bytes.TrimSuffix(line[:len(line)-1], []byte{'\r'})))
+	if err != nil {
+		return nil, &ProtocolError{Reason: "unbalanced quotes in request"}
+	}
+	for _, arg := range args {
+		rp.buf = append(rp.buf, arg...)
+		rp.ends = append(rp.ends, len(rp.buf))
+	}
+	rp.keepRaw(line)
+	rp.Consumed += int64(len(line))
+	return rp.splitArgs(), nil
+}
+
+// readBulkString reads one "$<length>\r\n<data>\r\n" element of a request
+// of which consumed bytes have been read, appending the data to rp.buf.
+// It returns the number of bytes read.
+func (rp *RespProtocol) readBulkString(consumed int64) (int64, error) {
+	line, err := rp.readLine()
+	if err != nil {
+		return 0, err
+	}
+	if line[0] != '$' {
+		return 0, &ProtocolError{Reason: fmt.Sprintf("expected '$', got '%c'", line[0])}
+	}
+	length, ok := parseLength(line)
+	if !ok || length < 0 || (rp.Limits != nil && int64(length) > rp.Limits.MaxBulkLen.Load()) {
+		return 0, &ProtocolError{Reason: "invalid bulk length"}
+	}
+	n := int64(len(line)) + int64(length) + 2
+	if rp.Limits != nil && consumed+n > rp.Limits.MaxQueryLen.Load() {
+		return 0, &ProtocolError{Reason: "query buffer limit exceeded"}
+	}
+	// The line is only valid until the next read.
+	rp.keepRaw(line)
+
+	rp.buf, err = readAppend(rp.Reader, rp.buf, length+2)
+	if err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	end := len(rp.buf) - 2
+	if rp.buf[end] != '\r' || rp.buf[end+1] != '\n' {
+		return 0, &ProtocolError{Reason: "expected CRLF after bulk string"}
+	}
+	rp.keepRaw(rp.buf[end-length:])
+	rp.buf = rp.buf[:end]
+	rp.ends = append(rp.ends, end)
+	return n, nil
+}
+
+// readAppend reads exactly n bytes and appends them to buf. A large value
+// usually spans several reads from the connection, and buf grows as they
+// arrive rather than being allocated up front.
+func readAppend(r *bufio.Reader, buf []byte, n int) ([]byte, error) {
+	for n > 0 {
+		chunk := min(n, initialAlloc)
+		buf = slices.Grow(buf, chunk)
+		read, err := io.ReadFull(r, buf[len(buf):len(buf)+chunk])
+		buf = buf[:len(buf)+read]
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return buf, err
+		}
+		n -= chunk
+	}
+	return buf, nil
+}
+
+// readLine reads a length line of a request, which must end with CRLF.
+func (rp *RespProtocol) readLine() ([]byte, error) {
+	line, err := rp.Reader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, &ProtocolError{Reason: "too big length line"}
+	}
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, &ProtocolError{Reason: "expected CRLF-terminated length"}
+	}
+	return line, nil
+}
+
+// parseLength parses the decimal integer between the type byte and the CRLF
+// of a "*<n>\r\n" or "$<n>\r\n" line. Signs other than a leading '-',
+// spaces and empty lengths are rejected.
+func parseLength(line []byte) (int, bool) {
+	digits := bytes.TrimSuffix(bytes.TrimSuffix(line[1:], []byte{'\n'}), []byte{'\r'})
+	if len(digits) == 0 || digits[0] == '+' {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(string(digits), 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return int(n), true
+}
+
+// unexpectedEOF reports a request cut short by the connection closing.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,256 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func newReader(r io.Reader) *RespProtocol {
+	return &RespProtocol{Reader: bufio.NewReader(r)}
+}
+
+// readAll reads requests until the input ends, copying each one.
+func readAll(t *testing.T, rp *RespProtocol) [][]string {
+	t.Helper()
+	var requests [][]string
+	for {
+		args, err := rp.Read()
+		if err == io.EOF {
+			return requests
+		}
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		requests = append(requests, stringArgs(args))
+	}
+}
+
+func stringArgs(args [][]byte) []string {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		strs[i] = string(arg)
+	}
+	return strs
+}
+
+func equalRequests(a, b [][]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !slices.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+var binaryValue = "\x00\xff\r\n$3\r\n*1\r\n\r\x80"
+
+var readTests = []struct {
+	name  string
+	input string
+	want  [][]string
+}{
+	{"array", "*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n", [][]string{{"GET", "key"}}},
+	{"pipeline", "*1\r\n$4\r\nPING\r\n*2\r\n$4\r\nECHO\r\n$2\r\nhi\r\n", [][]string{{"PING"}, {"ECHO", "hi"}}},
+	{"empty bulk", "*2\r\n$4\r\nECHO\r\n$0\r\n\r\n", [][]string{{"ECHO", ""}}},
+	{"empty array", "*0\r\n", [][]string{{}}},
+	{"crlf in bulk", "*2\r\n$4\r\nECHO\r\n$4\r\na\r\nb\r\n", [][]string{{"ECHO", "a\r\nb"}}},
+	{"binary bulk", "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$14\r\n" + binaryValue + "\r\n", [][]string{{"SET", "k", binaryValue}}},
+	{"inline", "SET k v\r\n", [][]string{{"SET", "k", "v"}}},
+	{"inline bare lf", "PING\n", [][]string{{"PING"}}},
+	{"inline quoted", "SET k \"a b\\r\\n\"\r\n", [][]string{{"SET", "k", "a b\r\n"}}},
+	{"inline blank", "\r\nPING\r\n", [][]string{{}, {"PING"}}},
+	{"inline then array", "PING\r\n*1\r\n$4\r\nPING\r\n", [][]string{{"PING"}, {"PING"}}},
+}
+
+func TestRead(t *testing.T) {
+	for _, tt := range readTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := readAll(t, newReader(strings.NewReader(tt.input)))
+			if !equalRequests(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestReadOneByteAtATime checks that requests split across many reads from
+// the connection, at every possible point, frame the same.
+func TestReadOneByteAtATime(t *testing.T) {
+	for _, tt := range readTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := readAll(t, newReader(iotest.OneByteReader(strings.NewReader(tt.input))))
+			if !equalRequests(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadLargeBulk(t *testing.T) {
+	value := bytes.Repeat([]byte("ab\r\n\x00"), 100000)
+	input := EncodeCommand([][]byte{[]byte("SET"), []byte("k"), value})
+	rp := newReader(iotest.HalfReader(bytes.NewReader(input)))
+	args, err := rp.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 3 || !bytes.Equal(args[2], value) {
+		t.Fatalf("large value did not round-trip")
+	}
+	if rp.Consumed != int64(len(input)) {
+		t.Errorf("Consumed = %d, want %d", rp.Consumed, len(input))
+	}
+}
+
+// TestReadKeepRaw checks that the raw bytes of each request, which
+// replicas forward and count in their offset, are exactly those received.
+func TestReadKeepRaw(t *testing.T) {
+	for _, tt := range readTests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := newReader(iotest.OneByteReader(strings.NewReader(tt.input)))
+			rp.KeepRaw = true
+			var raw []byte
+			for {
+				if _, err := rp.Read(); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("Read: %v", err)
+				}
+				raw = append(raw, rp.Raw...)
+			}
+			if string(raw) != tt.input {
+				t.Errorf("raw bytes %q, want %q", raw, tt.input)
+			}
+			if rp.Consumed != int64(len(tt.input)) {
+				t.Errorf("Consumed = %d, want %d", rp.Consumed, len(tt.input))
+			}
+		})
+	}
+}
+
+func TestReadReusesBuffer(t *testing.T) {
+	rp := newReader(strings.NewReader("*2\r\n$3\r\nGET\r\n$1\r\na\r\n*2\r\n$3\r\nGET\r\n$1\r\nb\r\n"))
+	first, err := rp.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := CloneArgs(first)
+	// Appending to an argument must not overwrite the next one.
+	_ = append(first[0], 'X')
+	if string(first[1]) != "a" {
+		t.Errorf("append to first argument overwrote the second: %q", first[1])
+	}
+	if _, err := rp.Read(); err != nil {
+		t.Fatal(err)
+	}
+	if got := stringArgs(kept); got[0] != "GET" || got[1] != "a" {
+		t.Errorf("CloneArgs result changed by the next Read: %q", got)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	limits := &Limits{}
+	limits.MaxBulkLen.Store(16)
+	limits.MaxQueryLen.Store(64)
+
+	tests := []struct {
+		name   string
+		input  string
+		limits *Limits
+		reason string
+	}{
+		{"bad array length", "*x\r\n", nil, "invalid multibulk length"},
+		{"array length sign", "*+1\r\n", nil, "invalid multibulk length"},
+		{"empty array length", "*\r\n", nil, "invalid multibulk length"},
+		{"array length without cr", "*1\n$4\r\nPING\r\n", nil, "expected CRLF-terminated length"},
+		{"too many elements", "*2000000\r\n", limits, "invalid multibulk length"},
+		{"not a bulk", "*1\r\n:1\r\n", nil, "expected '$', got ':'"},
+		{"bad bulk length", "*1\r\n$x\r\nPING\r\n", nil, "invalid bulk length"},
+		{"negative bulk length", "*1\r\n$-1\r\n", nil, "invalid bulk length"},
+		{"bulk over limit", "*1\r\n$17\r\n", limits, "invalid bulk length"},
+		{"query over limit", "*5\r\n$16\r\n0123456789abcdef\r\n$16\r\n0123456789abcdef\r\n$16\r\n0123456789abcdef\r\n", limits, "query buffer limit exceeded"},
+		{"missing crlf after bulk", "*1\r\n$4\r\nPINGxx", nil, "expected CRLF after bulk string"},
+		{"bulk longer than length", "*1\r\n$3\r\nPING\r\n", nil, "expected CRLF after bulk string"},
+		{"unbalanced quotes", "SET k \"v\r\n", nil, "unbalanced quotes in request"},
+		{"inline too big", strings.Repeat("a", InlineMaxSize+1) + "\r\n", nil, "too big inline request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := newReader(strings.NewReader(tt.input))
+			rp.Limits = tt.limits
+			_, err := rp.Read()
+			var protoErr *ProtocolError
+			if !errors.As(err, &protoErr) {
+				t.Fatalf("got %v, want a ProtocolError", err)
+			}
+			if protoErr.Reason != tt.reason {
+				t.Errorf("reason %q, want %q", protoErr.Reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestReadTruncated(t *testing.T) {
+	input := "*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n"
+	for n := 1; n < len(input); n++ {
+		_, err := newReader(strings.NewReader(input[:n])).Read()
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("input cut after %d bytes: got %v, want io.ErrUnexpectedEOF", n, err)
+		}
+	}
+}
+
+func FuzzRead(f *testing.F) {
+	for _, tt := range readTests {
+		f.Add([]byte(tt.input))
+	}
+	f.Add([]byte("*1\r\n$-1\r\n"))
+	f.Add([]byte("*-1\r\n"))
+	f.Add([]byte("*1\r\n$4\r\nPINGxx"))
+	f.Add([]byte("SET a \"b"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		limits := &Limits{}
+		limits.MaxBulkLen.Store(1 << 20)
+		limits.MaxQueryLen.Store(1 << 20)
+
+		// Arbitrary input never panics, and whatever is accepted encodes
+		// back to a request that reads the same.
+		rp := newReader(bytes.NewReader(data))
+		rp.Limits = limits
+		for {
+			args, err := rp.Read()
+			if err != nil {
+				break
+			}
+			again, err := newReader(bytes.NewReader(EncodeCommand(args))).Read()
+			if err != nil {
+				t.Fatalf("re-reading %q: %v", args, err)
+			}
+			if !equalRequests([][]string{stringArgs(args)}, [][]string{stringArgs(again)}) {
+				t.Fatalf("round trip changed %q to %q", args, again)
+			}
+		}
+
+		// Any arguments, split here on NUL, survive EncodeCommand and Read,
+		// however the input is split into reads.
+		args := bytes.Split(data, []byte{0})
+		encoded := EncodeCommand(args)
+		got, err := newReader(iotest.OneByteReader(bytes.NewReader(encoded))).Read()
+		if err != nil {
+			t.Fatalf("reading %q: %v", encoded, err)
+		}
+		if !equalRequests([][]string{stringArgs(args)}, [][]string{stringArgs(got)}) {
+			t.Fatalf("round trip changed %q to %q", args, got)
+		}
+	})
+}
@@ -0,0 +1,171 @@
+package protocol
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ReadReply reads one reply of any RESP2 or RESP3 type, as a client does.
+// Null bulk strings and null arrays are returned as *NullBulkString and
+// an *Array with nil Elements, the RESP3 null as *Null, and blob errors as
+// *Error. Malformed replies fail with a *ProtocolError.
+func ReadReply(r *bufio.Reader) (RespValue, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, &ProtocolError{Reason: "expected CRLF-terminated reply"}
+	}
+	kind, text := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return &SimpleString{Data: text}, nil
+	case '-':
+		return &Error{Message: text}, nil
+	case ':':
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, &ProtocolError{Reason: "invalid integer reply"}
+		}
+		return &IntegerBulkString{Data: n}, nil
+	case '_':
+		return &Null{}, nil
+	case '#':
+		if text != "t" && text != "f" {
+			return nil, &ProtocolError{Reason: "invalid boolean reply"}
+		}
+		return &Boolean{Data: text == "t"}, nil
+	case ',':
+		f, err := parseDouble(text)
+		if err != nil {
+			return nil, &ProtocolError{Reason: "invalid double reply"}
+		}
+		return &Double{Data: f}, nil
+	case '(':
+		n, ok := new(big.Int).SetString(text, 10)
+		if !ok {
+			return nil, &ProtocolError{Reason: "invalid big number reply"}
+		}
+		return &BigNumber{Data: n}, nil
+	case '$', '!', '=':
+		return readBlob(r, kind, text)
+	case '*', '~', '>':
+		return readAggregate(r, kind, text)
+	case '%', '|':
+		n, err := replyLength(text, false)
+		if err != nil {
+			return nil, err
+		}
+		entries := make([]MapEntry, 0, min(n, initialAlloc/16))
+		for i := 0; i < n; i++ {
+			key, err := ReadReply(r)
+			if err != nil {
+				return nil, err
+			}
+			value, err := ReadReply(r)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, MapEntry{Key: key, Value: value})
+		}
+		if kind == '%' {
+			return &Map{Entries: entries}, nil
+		}
+		value, err := ReadReply(r)
+		if err != nil {
+			return nil, err
+		}
+		return &Attribute{Entries: entries, Value: value}, nil
+	default:
+		return nil, &ProtocolError{Reason: fmt.Sprintf("unknown reply type '%c'", kind)}
+	}
+}
+
+// readBlob reads the body of a bulk string, blob error or verbatim string.
+func readBlob(r *bufio.Reader, kind byte, text string) (RespValue, error) {
+	n, err := replyLength(text, kind == '$')
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return &NullBulkString{}, nil
+	}
+	data, err := readAppend(r, nil, n+2)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if data[n] != '\r' || data[n+1] != '\n' {
+		return nil, &ProtocolError{Reason: "expected CRLF after bulk reply"}
+	}
+	body := string(data[:n])
+
+	switch kind {
+	case '!':
+		return &Error{Message: body}, nil
+	case '=':
+		format, text, ok := strings.Cut(body, ":")
+		if !ok || len(format) != 3 {
+			return nil, &ProtocolError{Reason: "invalid verbatim string reply"}
+		}
+		return &VerbatimString{Format: format, Data: text}, nil
+	default:
+		return &BulkString{Data: body}, nil
+	}
+}
+
+// readAggregate reads the elements of an array, set or push message.
+func readAggregate(r *bufio.Reader, kind byte, text string) (RespValue, error) {
+	n, err := replyLength(text, kind == '*')
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return &Array{}, nil
+	}
+	// The slice grows as elements arrive, whatever length was announced.
+	elements := make([]RespValue, 0, min(n, initialAlloc/16))
+	for i := 0; i < n; i++ {
+		elem, err := ReadReply(r)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, elem)
+	}
+
+	switch kind {
+	case '~':
+		return &Set{Elements: elements}, nil
+	case '>':
+		return &Push{Elements: elements}, nil
+	default:
+		return &Array{Elements: elements}, nil
+	}
+}
+
+// replyLength parses the length of a reply; -1, meaning null, is only
+// accepted for RESP2 bulk strings and arrays.
+func replyLength(text string, nullable bool) (int, error) {
+	n, err := strconv.ParseInt(text, 10, 32)
+	if err != nil || n < -1 || (n == -1 && !nullable) {
+		return 0, &ProtocolError{Reason: "invalid reply length"}
+	}
+	return int(n), nil
+}
+
+func parseDouble(text string) (float64, error) {
+	switch text {
+	case "inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	case "nan":
+		return math.NaN(), nil
+	}
+	return strconv.ParseFloat(text, 64)
+}
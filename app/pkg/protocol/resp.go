@@ -2,9 +2,10 @@ package protocol
 
 import (
 	"bufio"
-	"fmt"
 	"net"
-	"strings"
+	"strconv"
+	"sync"
+	"sync/atomic"
 )
 
 type RespValue interface {
@@ -16,7 +17,11 @@ type SimpleString struct {
 }
 
 func (s *SimpleString) ToBytes() []byte {
-	return []byte(fmt.Sprintf("+%s\r\n", s.Data))
+	return Encode(s, 2)
+}
+
+func (s *SimpleString) encode(e *Encoder) {
+	e.WriteSimpleString(s.Data)
 }
 
 type BulkString struct {
@@ -24,7 +29,26 @@ type BulkString struct {
 }
 
 func (s *BulkString) ToBytes() []byte {
-	return []byte(fmt.Sprintf("$%d\r\n%s\r\n", len(s.Data), s.Data))
+	return Encode(s, 2)
+}
+
+func (s *BulkString) encode(e *Encoder) {
+	e.WriteBulkString(s.Data)
+}
+
+// BulkBytes is a bulk string held as bytes, such as a stored value, which
+// is written out without being copied. The bytes must not change while
+// the reply is pending.
+type BulkBytes struct {
+	Data []byte
+}
+
+func (b *BulkBytes) ToBytes() []byte {
+	return Encode(b, 2)
+}
+
+func (b *BulkBytes) encode(e *Encoder) {
+	e.WriteBulk(b.Data)
 }
 
 type Array struct {
@@ -32,33 +56,46 @@ type Array struct {
 }
 
 func (a *Array) ToBytes() []byte {
+	return Encode(a, 2)
+}
+
+func (a *Array) encode(e *Encoder) {
 	if a.Elements == nil {
-		return []byte("*-1\r\n")
+		e.WriteNullArray()
+		return
 	}
-
-	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("*%d\r\n", len(a.Elements)))
-
+	e.WriteArrayLen(len(a.Elements))
 	for _, elem := range a.Elements {
-		sb.Write(elem.ToBytes())
+		e.WriteValue(elem)
 	}
-
-	return []byte(sb.String())
 }
 
 type Error struct {
 	Message string
 }
 
-func (e *Error) ToBytes() []byte {
-	return []byte(fmt.Sprintf("-%s\r\n", e.Message))
+func (err *Error) ToBytes() []byte {
+	return Encode(err, 2)
+}
+
+func (err *Error) encode(e *Encoder) {
+	e.WriteError(err.Message)
+}
+
+// Error lets clients return error replies as Go errors.
+func (err *Error) Error() string {
+	return err.Message
 }
 
 type NullBulkString struct {
 }
 
 func (n *NullBulkString) ToBytes() []byte {
-	return []byte("$-1\r\n")
+	return Encode(n, 2)
+}
+
+func (n *NullBulkString) encode(e *Encoder) {
+	e.WriteNull()
 }
 
 type IntegerBulkString struct {
@@ -66,76 +103,217 @@ type IntegerBulkString struct {
 }
 
 func (i *IntegerBulkString) ToBytes() []byte {
-	return []byte(fmt.Sprintf(":%d\r\n", i.Data))
+	return Encode(i, 2)
+}
+
+func (i *IntegerBulkString) encode(e *Encoder) {
+	e.WriteInteger(i.Data)
+}
+
+// EncodeCommand encodes args as a RESP array of bulk strings, the form in
+// which clients send commands.
+func EncodeCommand[T string | []byte](args []T) []byte {
+	size := 16
+	for _, arg := range args {
+		size += len(arg) + 16
+	}
+	buf := make([]byte, 0, size)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	return buf
 }
 
+// ReplyBufferSize is how many bytes of replies are buffered before they
+// are written to the connection even though more requests are pending.
+const ReplyBufferSize = 16 * 1024
+
+// RespProtocol reads requests from and writes replies to a connection.
+// Replies can be buffered, so that a pipeline of requests is answered with
+// a few large writes; buffered replies are flushed whenever reading the
+// next request would wait for the network. Writing is safe for concurrent
+// use, reading is not.
 type RespProtocol struct {
 	Conn   net.Conn
 	Reader *bufio.Reader
+	// Consumed counts the bytes of every request returned by Read.
+	Consumed int64
+	// KeepRaw makes Read keep the bytes of each request, as received, in
+	// Raw until the next Read.
+	KeepRaw bool
+	Raw     []byte
+	// Limits bounds the size of requests; nil means unbounded.
+	Limits *Limits
+
+	// buf holds the arguments of the request Read last returned, args
+	// slices it and ends marks where each argument ends. All three are
+	// reused by the next Read.
+	buf  []byte
+	args [][]byte
+	ends []int
+
+	writeMu sync.Mutex
+	writer  *bufio.Writer
+	encoder *Encoder
+	version atomic.Int32
+
+	// pushed holds the replies queued by Push until they are moved to the
+	// writer, ahead of whatever is written next.
+	pushMu    sync.Mutex
+	pushed    []byte
+	pushOnce  sync.Once
+	pushWake  chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
 }
 
 func NewRespProtocol(conn net.Conn) *RespProtocol {
-	return &RespProtocol{
-		Conn:   conn,
-		Reader: bufio.NewReader(conn),
+	rp := &RespProtocol{
+		Conn:     conn,
+		writer:   bufio.NewWriterSize(conn, ReplyBufferSize),
+		pushWake: make(chan struct{}, 1),
+		closed:   make(chan struct{}),
 	}
+	rp.encoder = NewEncoder(rp.writer, 2)
+	rp.Reader = bufio.NewReader(flushingReader{rp})
+	rp.version.Store(2)
+	return rp
 }
 
-func (rp *RespProtocol) Write(value RespValue) error {
-	_, err := rp.Conn.Write(value.ToBytes())
-	return err
+// flushingReader flushes buffered replies before waiting for input, so a
+// client never waits for a reply that is sitting in the buffer.
+type flushingReader struct {
+	rp *RespProtocol
 }
 
-// Reads exactly N bytes + discards trailing CRLF
-func (rp *RespProtocol) readBulkString(length int) (string, error) {
-	buf := make([]byte, length)
-	_, err := rp.Reader.Read(buf)
-	if err != nil {
-		return "", err
+func (r flushingReader) Read(p []byte) (int, error) {
+	if err := r.rp.Flush(); err != nil {
+		return 0, err
 	}
+	return r.rp.Conn.Read(p)
+}
 
-	// Discard trailing \r\n
-	_, err = rp.Reader.Discard(2)
-	if err != nil {
-		return "", err
-	}
+// Version returns the protocol version replies are encoded in, 2 or 3.
+func (rp *RespProtocol) Version() int {
+	return int(rp.version.Load())
+}
 
-	return string(buf), nil
+// SetVersion switches the encoding of later replies, as HELLO does.
+func (rp *RespProtocol) SetVersion(version int) {
+	rp.version.Store(int32(version))
 }
 
-func (rp *RespProtocol) Read() ([]string, error) {
-	line, err := rp.Reader.ReadString('\n')
-	if err != nil {
-		return nil, err
+// Write sends a reply, along with any buffered before it.
+func (rp *RespProtocol) Write(value RespValue) error {
+	rp.writeMu.Lock()
+	defer rp.writeMu.Unlock()
+	rp.writePushedLocked()
+	rp.encode(value)
+	return rp.writer.Flush()
+}
+
+// WriteRaw sends data that is already RESP encoded, along with any replies
+// buffered before it.
+func (rp *RespProtocol) WriteRaw(data []byte) error {
+	rp.writeMu.Lock()
+	defer rp.writeMu.Unlock()
+	rp.writePushedLocked()
+	if _, err := rp.writer.Write(data); err != nil {
+		return err
 	}
-	line = strings.TrimSpace(line)
+	return rp.writer.Flush()
+}
 
-	if len(line) == 0 || line[0] != '*' {
-		return nil, fmt.Errorf("expected array")
+// Buffer queues a reply. It is written once ReplyBufferSize bytes are
+// pending, or by the next Flush, Write or wait for input.
+func (rp *RespProtocol) Buffer(value RespValue) error {
+	rp.writeMu.Lock()
+	defer rp.writeMu.Unlock()
+	rp.writePushedLocked()
+	rp.encode(value)
+	// bufio.Writer keeps the first write error and returns it from then on.
+	_, err := rp.writer.Write(nil)
+	return err
+}
+
+// encode writes value to the buffer; rp.writeMu must be held.
+func (rp *RespProtocol) encode(value RespValue) {
+	rp.encoder.version = rp.Version()
+	rp.encoder.WriteValue(value)
+}
+
+func (rp *RespProtocol) Flush() error {
+	rp.writeMu.Lock()
+	defer rp.writeMu.Unlock()
+	rp.writePushedLocked()
+	return rp.writer.Flush()
+}
+
+// Push queues a reply from another goroutine, such as a published message,
+// without waiting for the connection: a goroutine of its own sends it. It
+// goes out ahead of anything written after it. Push reports false, and
+// queues nothing, if that would leave more than limit bytes waiting,
+// which means the client is not keeping up. Pushes to a closed connection
+// are dropped.
+func (rp *RespProtocol) Push(value RespValue, limit int) bool {
+	select {
+	case <-rp.closed:
+		return true
+	default:
+	}
+	data := Encode(value, rp.Version())
+	rp.pushMu.Lock()
+	if len(rp.pushed)+len(data) > limit {
+		rp.pushMu.Unlock()
+		return false
 	}
+	rp.pushed = append(rp.pushed, data...)
+	rp.pushMu.Unlock()
 
-	var numElements int
-	fmt.Sscanf(line, "*%d", &numElements)
-	args := make([]string, 0, numElements)
+	rp.pushOnce.Do(func() { go rp.sendPushed() })
+	select {
+	case rp.pushWake <- struct{}{}:
+	default:
+	}
+	return true
+}
 
-	for i := 0; i < numElements; i++ {
-		lenLine, err := rp.Reader.ReadString('\n')
-		if err != nil {
-			return nil, err
+// sendPushed flushes the replies Push queues until the connection closes
+// or fails.
+func (rp *RespProtocol) sendPushed() {
+	for {
+		select {
+		case <-rp.pushWake:
+		case <-rp.closed:
+			return
 		}
-		lenLine = strings.TrimSpace(lenLine)
-		if lenLine[0] != '$' {
-			return nil, fmt.Errorf("expected bulk string")
+		if err := rp.Flush(); err != nil {
+			return
 		}
+	}
+}
 
-		var strLen int
-		fmt.Sscanf(lenLine, "$%d", &strLen)
-		dataLine, err := rp.readBulkString(strLen)
-		if err != nil {
-			return nil, err
-		}
-		args = append(args, dataLine)
+// writePushedLocked moves the replies Push queued to the writer.
+// rp.writeMu must be held.
+func (rp *RespProtocol) writePushedLocked() {
+	rp.pushMu.Lock()
+	pushed := rp.pushed
+	rp.pushed = nil
+	rp.pushMu.Unlock()
+	if len(pushed) > 0 {
+		_, _ = rp.writer.Write(pushed)
 	}
+}
 
-	return args, nil
+// Close closes the connection, and stops the goroutine sending pushes.
+func (rp *RespProtocol) Close() error {
+	rp.closeOnce.Do(func() { close(rp.closed) })
+	return rp.Conn.Close()
 }
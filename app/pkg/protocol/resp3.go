@@ -0,0 +1,155 @@
+package protocol
+
+import (
+	"math/big"
+)
+
+// The RESP3 types below are sent to RESP2 clients the way Redis sends
+// them: maps become flat arrays of keys and values, doubles and big
+// numbers become bulk strings, and so on. Handlers can return them
+// regardless of the client's protocol version.
+
+// Null is the RESP3 null. RESP2 clients receive a null bulk string.
+type Null struct{}
+
+func (n *Null) ToBytes() []byte {
+	return Encode(n, 2)
+}
+
+func (n *Null) encode(e *Encoder) {
+	e.WriteNull()
+}
+
+type MapEntry struct {
+	Key   RespValue
+	Value RespValue
+}
+
+// Map is an ordered list of key-value pairs.
+type Map struct {
+	Entries []MapEntry
+}
+
+func (m *Map) ToBytes() []byte {
+	return Encode(m, 2)
+}
+
+func (m *Map) encode(e *Encoder) {
+	e.WriteMapLen(len(m.Entries))
+	writeEntries(e, m.Entries)
+}
+
+func writeEntries(e *Encoder, entries []MapEntry) {
+	for _, entry := range entries {
+		e.WriteValue(entry.Key)
+		e.WriteValue(entry.Value)
+	}
+}
+
+// Set is an unordered collection of distinct elements.
+type Set struct {
+	Elements []RespValue
+}
+
+func (s *Set) ToBytes() []byte {
+	return Encode(s, 2)
+}
+
+func (s *Set) encode(e *Encoder) {
+	e.WriteSetLen(len(s.Elements))
+	for _, elem := range s.Elements {
+		e.WriteValue(elem)
+	}
+}
+
+type Double struct {
+	Data float64
+}
+
+func (d *Double) ToBytes() []byte {
+	return Encode(d, 2)
+}
+
+func (d *Double) encode(e *Encoder) {
+	e.WriteDouble(d.Data)
+}
+
+// Boolean is sent to RESP2 clients as the integer 1 or 0.
+type Boolean struct {
+	Data bool
+}
+
+func (b *Boolean) ToBytes() []byte {
+	return Encode(b, 2)
+}
+
+func (b *Boolean) encode(e *Encoder) {
+	e.WriteBoolean(b.Data)
+}
+
+type BigNumber struct {
+	Data *big.Int
+}
+
+func (n *BigNumber) ToBytes() []byte {
+	return Encode(n, 2)
+}
+
+func (n *BigNumber) encode(e *Encoder) {
+	if e.version == 3 {
+		e.writeLine('(', n.Data.String())
+		return
+	}
+	e.WriteBulkString(n.Data.String())
+}
+
+// VerbatimString is text with a three-letter format such as "txt" or
+// "mkd", which RESP2 clients receive as a plain bulk string.
+type VerbatimString struct {
+	Format string
+	Data   string
+}
+
+func (v *VerbatimString) ToBytes() []byte {
+	return Encode(v, 2)
+}
+
+func (v *VerbatimString) encode(e *Encoder) {
+	e.WriteVerbatimString(v.Format, v.Data)
+}
+
+// Push is out-of-band data such as a pub/sub message, which RESP2 clients
+// receive as an array.
+type Push struct {
+	Elements []RespValue
+}
+
+func (p *Push) ToBytes() []byte {
+	return Encode(p, 2)
+}
+
+func (p *Push) encode(e *Encoder) {
+	e.WritePushLen(len(p.Elements))
+	for _, elem := range p.Elements {
+		e.WriteValue(elem)
+	}
+}
+
+// Attribute annotates Value with auxiliary key-value pairs. RESP2 has no
+// attributes, so RESP2 clients only receive Value.
+type Attribute struct {
+	Entries []MapEntry
+	Value   RespValue
+}
+
+func (a *Attribute) ToBytes() []byte {
+	return Encode(a, 2)
+}
+
+func (a *Attribute) encode(e *Encoder) {
+	if e.version == 3 {
+		e.writeInt('|', int64(len(a.Entries)))
+		writeEntries(e, a.Entries)
+	}
+	e.WriteValue(a.Value)
+}
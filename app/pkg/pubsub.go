@@ -0,0 +1,172 @@
+package pkg
+
+import (
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+)
+
+// subscribedModeCommands are the only commands a client with active
+// subscriptions may run.
+var subscribedModeCommands = map[string]bool{
+	"subscribe":    true,
+	"unsubscribe":  true,
+	"psubscribe":   true,
+	"punsubscribe": true,
+	"ping":         true,
+	"quit":         true,
+}
+
+// commandChannels returns the channels a command accesses, and whether
+// they are subscription patterns, for the ACL channel checks.
+func commandChannels(cmd *Command, argv [][]byte) ([][]byte, bool) {
+	switch cmd.Name {
+	case "publish":
+		return argv[1:2], false
+	case "subscribe":
+		return argv[1:], false
+	case "psubscribe":
+		return argv[1:], true
+	}
+	return nil, false
+}
+
+func subscriptionReply(kind string, name protocol.RespValue, count int) protocol.RespValue {
+	return &protocol.Push{Elements: []protocol.RespValue{
+		&protocol.BulkString{Data: kind},
+		name,
+		&protocol.IntegerBulkString{Data: int64(count)},
+	}}
+}
+
+// replies writes several replies in a row, as (un)subscribing to several
+// channels does. Inside EXEC they stand together for the command's reply.
+func replies(values []protocol.RespValue) protocol.RespValue {
+	return protocol.Stream(func(e *protocol.Encoder) {
+		for _, v := range values {
+			e.WriteValue(v)
+		}
+	})
+}
+
+func subscribeCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	var confirmations []protocol.RespValue
+	for _, arg := range args {
+		channel := string(arg)
+		if _, ok := c.channels[channel]; !ok {
+			c.channels[channel] = struct{}{}
+			s.PubSub.Subscribe(c, channel)
+		}
+		confirmations = append(confirmations, subscriptionReply("subscribe", &protocol.BulkString{Data: channel}, c.subscriptionCount()))
+	}
+	return replies(confirmations), nil
+}
+
+func unsubscribeCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	channels := stringArgs(args)
+	if len(channels) == 0 {
+		for channel := range c.channels {
+			channels = append(channels, channel)
+		}
+		if len(channels) == 0 {
+			return subscriptionReply("unsubscribe", &protocol.NullBulkString{}, c.subscriptionCount()), nil
+		}
+	}
+	var confirmations []protocol.RespValue
+	for _, channel := range channels {
+		if _, ok := c.channels[channel]; ok {
+			delete(c.channels, channel)
+			s.PubSub.Unsubscribe(c, channel)
+		}
+		confirmations = append(confirmations, subscriptionReply("unsubscribe", &protocol.BulkString{Data: channel}, c.subscriptionCount()))
+	}
+	return replies(confirmations), nil
+}
+
+func psubscribeCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	var confirmations []protocol.RespValue
+	for _, arg := range args {
+		pattern := string(arg)
+		if _, ok := c.patterns[pattern]; !ok {
+			c.patterns[pattern] = struct{}{}
+			s.PubSub.PSubscribe(c, pattern)
+		}
+		confirmations = append(confirmations, subscriptionReply("psubscribe", &protocol.BulkString{Data: pattern}, c.subscriptionCount()))
+	}
+	return replies(confirmations), nil
+}
+
+func punsubscribeCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	patterns := stringArgs(args)
+	if len(patterns) == 0 {
+		for pattern := range c.patterns {
+			patterns = append(patterns, pattern)
+		}
+		if len(patterns) == 0 {
+			return subscriptionReply("punsubscribe", &protocol.NullBulkString{}, c.subscriptionCount()), nil
+		}
+	}
+	var confirmations []protocol.RespValue
+	for _, pattern := range patterns {
+		if _, ok := c.patterns[pattern]; ok {
+			delete(c.patterns, pattern)
+			s.PubSub.PUnsubscribe(c, pattern)
+		}
+		confirmations = append(confirmations, subscriptionReply("punsubscribe", &protocol.BulkString{Data: pattern}, c.subscriptionCount()))
+	}
+	return replies(confirmations), nil
+}
+
+// unsubscribeAll drops every subscription of c without replying.
+func (s *Server) unsubscribeAll(c *Client) {
+	for channel := range c.channels {
+		delete(c.channels, channel)
+		s.PubSub.Unsubscribe(c, channel)
+	}
+	for pattern := range c.patterns {
+		delete(c.patterns, pattern)
+		s.PubSub.PUnsubscribe(c, pattern)
+	}
+}
+
+func publishCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	receivers := s.PubSub.Publish(args[0], args[1])
+	return &protocol.IntegerBulkString{Data: int64(receivers)}, nil
+}
+
+func pubsubCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	switch strings.ToUpper(string(args[0])) {
+	case "CHANNELS":
+		if len(args) > 2 {
+			return nil, &protocol.Error{Message: "ERR wrong number of arguments for 'pubsub|channels' command"}
+		}
+		pattern := ""
+		if len(args) == 2 {
+			pattern = string(args[1])
+		}
+		channels := s.PubSub.Channels(pattern)
+		elements := make([]protocol.RespValue, len(channels))
+		for i, channel := range channels {
+			elements[i] = &protocol.BulkString{Data: channel}
+		}
+		return &protocol.Array{Elements: elements}, nil
+
+	case "NUMSUB":
+		elements := make([]protocol.RespValue, 0, (len(args)-1)*2)
+		for _, channel := range args[1:] {
+			elements = append(elements,
+				&protocol.BulkBytes{Data: channel},
+				&protocol.IntegerBulkString{Data: int64(s.PubSub.NumSub(string(channel)))})
+		}
+		return &protocol.Array{Elements: elements}, nil
+
+	case "NUMPAT":
+		if len(args) != 1 {
+			return nil, &protocol.Error{Message: "ERR wrong number of arguments for 'pubsub|numpat' command"}
+		}
+		return &protocol.IntegerBulkString{Data: int64(s.PubSub.NumPat())}, nil
+
+	default:
+		return nil, &protocol.Error{Message: "ERR unknown subcommand '" + string(args[0]) + "'. Try PUBSUB HELP."}
+	}
+}
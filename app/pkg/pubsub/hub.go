@@ -0,0 +1,145 @@
+// Package pubsub routes PUBLISH messages to channel and pattern subscribers.
+package pubsub
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/glob"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+)
+
+// Subscriber receives the messages published to its channels and patterns.
+// Deliver is called from the publishing goroutine, often with the server
+// lock held, so it must queue the message rather than wait for the
+// subscriber's connection. msg may share the publisher's arguments, so it
+// must be encoded or copied before Deliver returns.
+type Subscriber interface {
+	Deliver(msg protocol.RespValue)
+}
+
+type Hub struct {
+	mu       sync.RWMutex
+	channels map[string]map[Subscriber]struct{}
+	patterns map[string]map[Subscriber]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		channels: make(map[string]map[Subscriber]struct{}),
+		patterns: make(map[string]map[Subscriber]struct{}),
+	}
+}
+
+func (h *Hub) Subscribe(sub Subscriber, channel string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	add(h.channels, channel, sub)
+}
+
+func (h *Hub) Unsubscribe(sub Subscriber, channel string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	remove(h.channels, channel, sub)
+}
+
+func (h *Hub) PSubscribe(sub Subscriber, pattern string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	add(h.patterns, pattern, sub)
+}
+
+func (h *Hub) PUnsubscribe(sub Subscriber, pattern string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	remove(h.patterns, pattern, sub)
+}
+
+// Publish delivers message to every subscriber of channel and of every
+// pattern matching it, and returns the number of deliveries.
+func (h *Hub) Publish(channel, message []byte) int {
+	type delivery struct {
+		sub Subscriber
+		msg protocol.RespValue
+	}
+	var deliveries []delivery
+
+	h.mu.RLock()
+	if subs := h.channels[string(channel)]; len(subs) > 0 {
+		msg := &protocol.Push{Elements: []protocol.RespValue{
+			&protocol.BulkString{Data: "message"},
+			&protocol.BulkBytes{Data: channel},
+			&protocol.BulkBytes{Data: message},
+		}}
+		for sub := range subs {
+			deliveries = append(deliveries, delivery{sub, msg})
+		}
+	}
+	for pattern, subs := range h.patterns {
+		if !glob.Match(pattern, channel) {
+			continue
+		}
+		msg := &protocol.Push{Elements: []protocol.RespValue{
+			&protocol.BulkString{Data: "pmessage"},
+			&protocol.BulkString{Data: pattern},
+			&protocol.BulkBytes{Data: channel},
+			&protocol.BulkBytes{Data: message},
+		}}
+		for sub := range subs {
+			deliveries = append(deliveries, delivery{sub, msg})
+		}
+	}
+	h.mu.RUnlock()
+
+	// Deliver outside the lock so a slow subscriber cannot stall
+	// subscriptions on other connections.
+	for _, d := range deliveries {
+		d.sub.Deliver(d.msg)
+	}
+	return len(deliveries)
+}
+
+// Channels returns the active channels matching pattern, or every active
+// channel when pattern is empty.
+func (h *Hub) Channels(pattern string) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var channels []string
+	for channel := range h.channels {
+		if pattern == "" || glob.Match(pattern, channel) {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+func (h *Hub) NumSub(channel string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.channels[channel])
+}
+
+// NumPat returns the number of distinct patterns subscribed to.
+func (h *Hub) NumPat() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.patterns)
+}
+
+func add(m map[string]map[Subscriber]struct{}, name string, sub Subscriber) {
+	subs := m[name]
+	if subs == nil {
+		subs = make(map[Subscriber]struct{})
+		m[name] = subs
+	}
+	subs[sub] = struct{}{}
+}
+
+func remove(m map[string]map[Subscriber]struct{}, name string, sub Subscriber) {
+	subs := m[name]
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(m, name)
+	}
+}
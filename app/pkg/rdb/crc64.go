@@ -0,0 +1,14 @@
+package rdb
+
+import "hash/crc64"
+
+// Redis checksums RDB files with CRC-64/Jones: reflected, no initial value
+// and no final xor, which hash/crc64 does not offer directly.
+var jonesTable = crc64.MakeTable(0x95ac9329ac4bc9b5)
+
+func crc64Update(crc uint64, p []byte) uint64 {
+	for _, b := range p {
+		crc = jonesTable[byte(crc)^b] ^ (crc >> 8)
+	}
+	return crc
+}
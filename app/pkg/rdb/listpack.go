@@ -0,0 +1,189 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+var errListpack = errors.New("rdb: invalid listpack")
+
+// listpack builds the compact serialisation Redis uses for small lists and
+// stream nodes. Elements that look like integers are stored as integers.
+type listpack struct {
+	buf   []byte
+	count int
+}
+
+func (lp *listpack) appendString(s string) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && strconv.FormatInt(n, 10) == s {
+		lp.appendInt(n)
+		return
+	}
+	start := len(lp.buf)
+	switch l := len(s); {
+	case l < 64:
+		lp.buf = append(lp.buf, 0x80|byte(l))
+	case l < 4096:
+		lp.buf = append(lp.buf, 0xe0|byte(l>>8), byte(l))
+	default:
+		lp.buf = append(lp.buf, 0xf0)
+		lp.buf = binary.LittleEndian.AppendUint32(lp.buf, uint32(l))
+	}
+	lp.buf = append(lp.buf, s...)
+	lp.appendBacklen(len(lp.buf) - start)
+	lp.count++
+}
+
+func (lp *listpack) appendInt(n int64) {
+	start := len(lp.buf)
+	switch {
+	case n >= 0 && n <= 127:
+		lp.buf = append(lp.buf, byte(n))
+	case n >= -4096 && n <= 4095:
+		u := uint64(n) & 0x1fff
+		lp.buf = append(lp.buf, 0xc0|byte(u>>8), byte(u))
+	case n >= -32768 && n <= 32767:
+		lp.buf = append(lp.buf, 0xf1)
+		lp.buf = binary.LittleEndian.AppendUint16(lp.buf, uint16(n))
+	case n >= -8388608 && n <= 8388607:
+		u := uint32(n)
+		lp.buf = append(lp.buf, 0xf2, byte(u), byte(u>>8), byte(u>>16))
+	case n >= -2147483648 && n <= 2147483647:
+		lp.buf = append(lp.buf, 0xf3)
+		lp.buf = binary.LittleEndian.AppendUint32(lp.buf, uint32(n))
+	default:
+		lp.buf = append(lp.buf, 0xf4)
+		lp.buf = binary.LittleEndian.AppendUint64(lp.buf, uint64(n))
+	}
+	lp.appendBacklen(len(lp.buf) - start)
+	lp.count++
+}
+
+// appendBacklen stores the size of the element just written so the
+// listpack can be walked backwards.
+func (lp *listpack) appendBacklen(l int) {
+	switch {
+	case l <= 127:
+		lp.buf = append(lp.buf, byte(l))
+	case l < 16383:
+		lp.buf = append(lp.buf, byte(l>>7), byte(l&127)|128)
+	case l < 2097151:
+		lp.buf = append(lp.buf, byte(l>>14), byte((l>>7)&127)|128, byte(l&127)|128)
+	case l < 268435455:
+		lp.buf = append(lp.buf, byte(l>>21), byte((l>>14)&127)|128, byte((l>>7)&127)|128, byte(l&127)|128)
+	default:
+		lp.buf = append(lp.buf, byte(l>>28), byte((l>>21)&127)|128, byte((l>>14)&127)|128, byte((l>>7)&127)|128, byte(l&127)|128)
+	}
+}
+
+// bytes returns the finished listpack with its header and terminator.
+func (lp *listpack) bytes() []byte {
+	out := make([]byte, 6, len(lp.buf)+7)
+	binary.LittleEndian.PutUint32(out, uint32(len(lp.buf)+7))
+	count := lp.count
+	if count > 65535 {
+		count = 65535
+	}
+	binary.LittleEndian.PutUint16(out[4:], uint16(count))
+	out = append(out, lp.buf...)
+	return append(out, 0xff)
+}
+
+// parseListpack returns every element of a listpack as a string.
+func parseListpack(b []byte) ([]string, error) {
+	if len(b) < 7 {
+		return nil, errListpack
+	}
+	var elements []string
+	i := 6
+	for {
+		if i >= len(b) {
+			return nil, errListpack
+		}
+		enc := b[i]
+		if enc == 0xff {
+			return elements, nil
+		}
+
+		var value string
+		var size int
+		switch {
+		case enc&0x80 == 0:
+			value, size = strconv.Itoa(int(enc)), 1
+		case enc&0xc0 == 0x80:
+			l := int(enc & 0x3f)
+			if i+1+l > len(b) {
+				return nil, errListpack
+			}
+			value, size = string(b[i+1:i+1+l]), 1+l
+		case enc&0xe0 == 0xc0:
+			if i+2 > len(b) {
+				return nil, errListpack
+			}
+			u := int64(enc&0x1f)<<8 | int64(b[i+1])
+			if u >= 1<<12 {
+				u -= 1 << 13
+			}
+			value, size = strconv.FormatInt(u, 10), 2
+		case enc&0xf0 == 0xe0:
+			if i+2 > len(b) {
+				return nil, errListpack
+			}
+			l := int(enc&0x0f)<<8 | int(b[i+1])
+			if i+2+l > len(b) {
+				return nil, errListpack
+			}
+			value, size = string(b[i+2:i+2+l]), 2+l
+		case enc == 0xf0:
+			if i+5 > len(b) {
+				return nil, errListpack
+			}
+			l := int(binary.LittleEndian.Uint32(b[i+1:]))
+			if l < 0 || i+5+l > len(b) {
+				return nil, errListpack
+			}
+			value, size = string(b[i+5:i+5+l]), 5+l
+		case enc == 0xf1:
+			if i+3 > len(b) {
+				return nil, errListpack
+			}
+			value, size = strconv.FormatInt(int64(int16(binary.LittleEndian.Uint16(b[i+1:]))), 10), 3
+		case enc == 0xf2:
+			if i+4 > len(b) {
+				return nil, errListpack
+			}
+			u := int32(uint32(b[i+1])<<8|uint32(b[i+2])<<16|uint32(b[i+3])<<24) >> 8
+			value, size = strconv.FormatInt(int64(u), 10), 4
+		case enc == 0xf3:
+			if i+5 > len(b) {
+				return nil, errListpack
+			}
+			value, size = strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(b[i+1:]))), 10), 5
+		case enc == 0xf4:
+			if i+9 > len(b) {
+				return nil, errListpack
+			}
+			value, size = strconv.FormatInt(int64(binary.LittleEndian.Uint64(b[i+1:])), 10), 9
+		default:
+			return nil, errListpack
+		}
+		elements = append(elements, value)
+		i += size + backlenSize(size)
+	}
+}
+
+func backlenSize(l int) int {
+	switch {
+	case l <= 127:
+		return 1
+	case l < 16383:
+		return 2
+	case l < 2097151:
+		return 3
+	case l < 268435455:
+		return 4
+	default:
+		return 5
+	}
+}
@@ -0,0 +1,569 @@
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/store"
+)
+
+var ErrChecksum = errors.New("rdb: checksum mismatch")
+
+type decoder struct {
+	r   *bufio.Reader
+	crc uint64
+}
+
+func (d *decoder) read(n int) ([]byte, error) {
+	// Lengths above math.MaxInt wrap around to negative ones.
+	if n < 0 {
+		return nil, errors.New("rdb: invalid length")
+	}
+	// Grow with the data actually read so a corrupt length cannot force a
+	// huge allocation up front.
+	var buf bytes.Buffer
+	copied, err := io.CopyN(&buf, d.r, int64(n))
+	if err != nil {
+		if err == io.EOF && copied < int64(n) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	p := buf.Bytes()
+	d.crc = crc64Update(d.crc, p)
+	return p, nil
+}
+
+func (d *decoder) byte() (byte, error) {
+	b, err := d.r.ReadByte()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	d.crc = crc64Update(d.crc, []byte{b})
+	return b, nil
+}
+
+// length reads a length. special reports the 11xxxxxx form used for
+// encoded strings, in which case n is the encoding type.
+func (d *decoder) length() (n uint64, special bool, err error) {
+	b, err := d.byte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch b >> 6 {
+	case 0:
+		return uint64(b & 0x3f), false, nil
+	case 1:
+		next, err := d.byte()
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(b&0x3f)<<8 | uint64(next), false, nil
+	case 2:
+		switch b {
+		case 0x80:
+			p, err := d.read(4)
+			if err != nil {
+				return 0, false, err
+			}
+			return uint64(binary.BigEndian.Uint32(p)), false, nil
+		case 0x81:
+			p, err := d.read(8)
+			if err != nil {
+				return 0, false, err
+			}
+			return binary.BigEndian.Uint64(p), false, nil
+		default:
+			return 0, false, fmt.Errorf("rdb: unknown length encoding 0x%x", b)
+		}
+	default:
+		return uint64(b & 0x3f), true, nil
+	}
+}
+
+func (d *decoder) plainLength() (uint64, error) {
+	n, special, err := d.length()
+	if err != nil {
+		return 0, err
+	}
+	if special {
+		return 0, errors.New("rdb: unexpected encoded length")
+	}
+	return n, nil
+}
+
+func (d *decoder) string() (string, error) {
+	n, special, err := d.length()
+	if err != nil {
+		return "", err
+	}
+	if !special {
+		p, err := d.read(int(n))
+		return string(p), err
+	}
+
+	switch n {
+	case encInt8:
+		b, err := d.byte()
+		return strconv.Itoa(int(int8(b))), err
+	case encInt16:
+		p, err := d.read(2)
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(int(int16(binary.LittleEndian.Uint16(p)))), nil
+	case encInt32:
+		p, err := d.read(4)
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(int(int32(binary.LittleEndian.Uint32(p)))), nil
+	case encLZF:
+		compressedLen, err := d.plainLength()
+		if err != nil {
+			return "", err
+		}
+		outLen, err := d.plainLength()
+		if err != nil {
+			return "", err
+		}
+		compressed, err := d.read(int(compressedLen))
+		if err != nil {
+			return "", err
+		}
+		out, err := lzfDecompress(compressed, int(outLen))
+		return string(out), err
+	default:
+		return "", fmt.Errorf("rdb: unknown string encoding %d", n)
+	}
+}
+
+// Load replaces the content of st with the snapshot read from r. Only keys
+// of database 0 are kept, since the store has a single database.
+func Load(r io.Reader, st *store.Store) error {
+	d := &decoder{r: bufio.NewReader(r)}
+	header, err := d.read(9)
+	if err != nil {
+		return err
+	}
+	if string(header[:5]) != "REDIS" {
+		return errors.New("rdb: wrong signature")
+	}
+	fileVersion, err := strconv.Atoi(string(header[5:]))
+	if err != nil || fileVersion < 1 || fileVersion > 12 {
+		return fmt.Errorf("rdb: unsupported version %q", header[5:])
+	}
+
+	st.Flush()
+
+	db := uint64(0)
+	var expiresAt time.Time
+	for {
+		op, err := d.byte()
+		if err != nil {
+			return err
+		}
+
+		switch op {
+		case opEOF:
+			if fileVersion < 5 {
+				return nil
+			}
+			expected := d.crc
+			p := make([]byte, 8)
+			if _, err := io.ReadFull(d.r, p); err != nil {
+				return err
+			}
+			// A zero checksum means the writer had checksums disabled.
+			if sum := binary.LittleEndian.Uint64(p); sum != 0 && sum != expected {
+				return ErrChecksum
+			}
+			return nil
+
+		case opSelectDB:
+			if db, err = d.plainLength(); err != nil {
+				return err
+			}
+
+		case opResizeDB:
+			if _, err := d.plainLength(); err != nil {
+				return err
+			}
+			if _, err := d.plainLength(); err != nil {
+				return err
+			}
+
+		case opAux:
+			if _, err := d.string(); err != nil {
+				return err
+			}
+			if _, err := d.string(); err != nil {
+				return err
+			}
+
+		case opExpireTimeMs:
+			p, err := d.read(8)
+			if err != nil {
+				return err
+			}
+			expiresAt = time.UnixMilli(int64(binary.LittleEndian.Uint64(p)))
+
+		case opExpireTime:
+			p, err := d.read(4)
+			if err != nil {
+				return err
+			}
+			expiresAt = time.Unix(int64(binary.LittleEndian.Uint32(p)), 0)
+
+		case opIdle:
+			if _, err := d.plainLength(); err != nil {
+				return err
+			}
+
+		case opFreq:
+			if _, err := d.byte(); err != nil {
+				return err
+			}
+
+		case opSlotInfo:
+			for i := 0; i < 3; i++ {
+				if _, err := d.plainLength(); err != nil {
+					return err
+				}
+			}
+
+		case opFunction2:
+			if _, err := d.string(); err != nil {
+				return err
+			}
+
+		case opModuleAux:
+			return errors.New("rdb: module data is not supported")
+
+		default:
+			key, err := d.string()
+			if err != nil {
+				return err
+			}
+			if err := d.object(op, key, db == 0, expiresAt, st); err != nil {
+				return err
+			}
+			expiresAt = time.Time{}
+		}
+	}
+}
+
+// object reads a value of the given type and, if keep is set, stores it.
+func (d *decoder) object(valueType byte, key string, keep bool, expiresAt time.Time, st *store.Store) error {
+	switch valueType {
+	case typeString:
+		value, err := d.string()
+		if err != nil {
+			return err
+		}
+		if keep && (expiresAt.IsZero() || expiresAt.After(time.Now())) {
+			st.KV.SetWithDeadline(key, []byte(value), expiresAt)
+			st.KeyTypeStore.Register(key, store.String)
+		}
+
+	case typeList:
+		n, err := d.plainLength()
+		if err != nil {
+			return err
+		}
+		var values [][]byte
+		for i := uint64(0); i < n; i++ {
+			value, err := d.string()
+			if err != nil {
+				return err
+			}
+			values = append(values, []byte(value))
+		}
+		if keep && len(values) > 0 {
+			st.Lists.RPush(key, values...)
+			st.KeyTypeStore.Register(key, store.List)
+		}
+
+	case typeListQuicklist2:
+		nodes, err := d.plainLength()
+		if err != nil {
+			return err
+		}
+		var values [][]byte
+		for i := uint64(0); i < nodes; i++ {
+			container, err := d.plainLength()
+			if err != nil {
+				return err
+			}
+			data, err := d.string()
+			if err != nil {
+				return err
+			}
+			if container == quicklistNodePlain {
+				values = append(values, []byte(data))
+				continue
+			}
+			elements, err := parseListpack([]byte(data))
+			if err != nil {
+				return err
+			}
+			for _, element := range elements {
+				values = append(values, []byte(element))
+			}
+		}
+		if keep && len(values) > 0 {
+			st.Lists.RPush(key, values...)
+			st.KeyTypeStore.Register(key, store.List)
+		}
+
+	case typeStreamListpacks, typeStreamListpacks2, typeStreamListpacks3:
+		entries, err := d.stream(valueType)
+		if err != nil {
+			return err
+		}
+		if keep {
+			for _, entry := range entries {
+				st.StreamStore.Add(key, entry)
+			}
+			st.KeyTypeStore.Register(key, store.Stream)
+		}
+
+	default:
+		return fmt.Errorf("rdb: unsupported value type %d for key %q", valueType, key)
+	}
+	return nil
+}
+
+func (d *decoder) stream(valueType byte) ([]*store.StreamEntry, error) {
+	nodes, err := d.plainLength()
+	if err != nil {
+		return nil, err
+	}
+	var entries []*store.StreamEntry
+	for i := uint64(0); i < nodes; i++ {
+		nodeKey, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+		if len(nodeKey) != 16 {
+			return nil, errors.New("rdb: invalid stream node key")
+		}
+		masterMs := binary.BigEndian.Uint64([]byte(nodeKey[:8]))
+		masterSeq := binary.BigEndian.Uint64([]byte(nodeKey[8:]))
+
+		data, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+		elements, err := parseListpack([]byte(data))
+		if err != nil {
+			return nil, err
+		}
+		nodeEntries, err := streamNodeEntries(elements, masterMs, masterSeq)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, nodeEntries...)
+	}
+
+	// Length and last ID.
+	for j := 0; j < 3; j++ {
+		if _, err := d.plainLength(); err != nil {
+			return nil, err
+		}
+	}
+	if valueType >= typeStreamListpacks2 {
+		// First ID, max deleted ID and entries added.
+		for j := 0; j < 5; j++ {
+			if _, err := d.plainLength(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := d.skipConsumerGroups(valueType); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// streamNodeEntries decodes the entries of one stream listpack node,
+// skipping deleted ones.
+func streamNodeEntries(elements []string, masterMs, masterSeq uint64) ([]*store.StreamEntry, error) {
+	next := func() (string, error) {
+		if len(elements) == 0 {
+			return "", errListpack
+		}
+		e := elements[0]
+		elements = elements[1:]
+		return e, nil
+	}
+	nextInt := func() (int64, error) {
+		e, err := next()
+		if err != nil {
+			return 0, err
+		}
+		return strconv.ParseInt(e, 10, 64)
+	}
+
+	count, err := nextInt()
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := nextInt()
+	if err != nil {
+		return nil, err
+	}
+	numMasterFields, err := nextInt()
+	if err != nil {
+		return nil, err
+	}
+	// Every entry and field takes at least one element, so the counts are
+	// bounded by the listpack already read.
+	if count < 0 || deleted < 0 || numMasterFields < 0 ||
+		count > int64(len(elements)) || numMasterFields > int64(len(elements)) {
+		return nil, errListpack
+	}
+	masterFields := make([]string, 0, numMasterFields)
+	for i := int64(0); i < numMasterFields; i++ {
+		field, err := next()
+		if err != nil {
+			return nil, err
+		}
+		masterFields = append(masterFields, field)
+	}
+	if _, err := next(); err != nil {
+		return nil, err
+	}
+
+	entries := make([]*store.StreamEntry, 0, count)
+	for i := int64(0); i < count+deleted; i++ {
+		flags, err := nextInt()
+		if err != nil {
+			return nil, err
+		}
+		msDiff, err := nextInt()
+		if err != nil {
+			return nil, err
+		}
+		seqDiff, err := nextInt()
+		if err != nil {
+			return nil, err
+		}
+
+		entry := &store.StreamEntry{
+			Id: fmt.Sprintf("%d-%d", masterMs+uint64(msDiff), masterSeq+uint64(seqDiff)),
+		}
+		if flags&streamItemFlagSameFields != 0 {
+			for _, field := range masterFields {
+				value, err := next()
+				if err != nil {
+					return nil, err
+				}
+				entry.Keys = append(entry.Keys, []byte(field))
+				entry.Values = append(entry.Values, []byte(value))
+			}
+		} else {
+			numFields, err := nextInt()
+			if err != nil {
+				return nil, err
+			}
+			for j := int64(0); j < numFields; j++ {
+				field, err := next()
+				if err != nil {
+					return nil, err
+				}
+				value, err := next()
+				if err != nil {
+					return nil, err
+				}
+				entry.Keys = append(entry.Keys, []byte(field))
+				entry.Values = append(entry.Values, []byte(value))
+			}
+		}
+		// lp-count
+		if _, err := next(); err != nil {
+			return nil, err
+		}
+		if flags&streamItemFlagDeleted == 0 {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// skipConsumerGroups reads and discards consumer groups, which the store
+// does not support.
+func (d *decoder) skipConsumerGroups(valueType byte) error {
+	groups, err := d.plainLength()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < groups; i++ {
+		if _, err := d.string(); err != nil {
+			return err
+		}
+		// Last delivered ID.
+		for j := 0; j < 2; j++ {
+			if _, err := d.plainLength(); err != nil {
+				return err
+			}
+		}
+		if valueType >= typeStreamListpacks2 {
+			// Entries read.
+			if _, err := d.plainLength(); err != nil {
+				return err
+			}
+		}
+
+		pending, err := d.plainLength()
+		if err != nil {
+			return err
+		}
+		for j := uint64(0); j < pending; j++ {
+			// Raw ID and delivery time, then the delivery count.
+			if _, err := d.read(16 + 8); err != nil {
+				return err
+			}
+			if _, err := d.plainLength(); err != nil {
+				return err
+			}
+		}
+
+		consumers, err := d.plainLength()
+		if err != nil {
+			return err
+		}
+		for j := uint64(0); j < consumers; j++ {
+			if _, err := d.string(); err != nil {
+				return err
+			}
+			times := 8
+			if valueType >= typeStreamListpacks3 {
+				times = 16
+			}
+			if _, err := d.read(times); err != nil {
+				return err
+			}
+			consumerPending, err := d.plainLength()
+			if err != nil {
+				return err
+			}
+			for k := uint64(0); k < consumerPending; k++ {
+				// Raw ID of a pending entry.
+				if _, err := d.read(16); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
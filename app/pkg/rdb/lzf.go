@@ -0,0 +1,60 @@
+package rdb
+
+import "errors"
+
+var errLZF = errors.New("rdb: invalid LZF data")
+
+// lzfMaxRatio bounds how much LZF data can expand: a three byte back
+// reference copies at most 264 bytes.
+const lzfMaxRatio = 88
+
+// lzfDecompress expands data compressed with LibLZF, which Redis uses for
+// long strings, into a buffer of exactly outLen bytes. outLen comes from
+// the snapshot, so it is checked against the input before allocating.
+func lzfDecompress(in []byte, outLen int) ([]byte, error) {
+	if outLen < 0 || outLen > len(in)*lzfMaxRatio {
+		return nil, errLZF
+	}
+	out := make([]byte, 0, outLen)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 32 {
+			// Literal run of ctrl+1 bytes.
+			n := ctrl + 1
+			if i+n > len(in) || len(out)+n > outLen {
+				return nil, errLZF
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+
+		// Back reference.
+		n := ctrl >> 5
+		if n == 7 {
+			if i >= len(in) {
+				return nil, errLZF
+			}
+			n += int(in[i])
+			i++
+		}
+		n += 2
+		if i >= len(in) {
+			return nil, errLZF
+		}
+		ref := len(out) - ((ctrl & 0x1f) << 8) - int(in[i]) - 1
+		i++
+		if ref < 0 || len(out)+n > outLen {
+			return nil, errLZF
+		}
+		// Copy byte by byte: the reference may overlap the output.
+		for j := 0; j < n; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != outLen {
+		return nil, errLZF
+	}
+	return out, nil
+}
@@ -0,0 +1,40 @@
+// Package rdb reads and writes snapshots of the store in the Redis RDB
+// file format, used for full resynchronisation and persistence.
+package rdb
+
+const (
+	version = 11
+
+	typeString           = 0
+	typeList             = 1
+	typeStreamListpacks  = 15
+	typeListQuicklist2   = 18
+	typeStreamListpacks2 = 19
+	typeStreamListpacks3 = 21
+
+	opSlotInfo     = 0xf4
+	opFunction2    = 0xf5
+	opModuleAux    = 0xf7
+	opIdle         = 0xf8
+	opFreq         = 0xf9
+	opAux          = 0xfa
+	opResizeDB     = 0xfb
+	opExpireTimeMs = 0xfc
+	opExpireTime   = 0xfd
+	opSelectDB     = 0xfe
+	opEOF          = 0xff
+
+	encInt8  = 0
+	encInt16 = 1
+	encInt32 = 2
+	encLZF   = 3
+
+	quicklistNodePlain  = 1
+	quicklistNodePacked = 2
+
+	streamItemFlagDeleted    = 1
+	streamItemFlagSameFields = 2
+
+	// streamNodeMaxEntries matches the default stream-node-max-entries.
+	streamNodeMaxEntries = 100
+)
@@ -0,0 +1,313 @@
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/store"
+)
+
+func newStore() *store.Store {
+	return &store.Store{KV: store.NewKVStore(), Lists: store.NewListsStore(),
+		StreamStore: store.NewStreamStore(), KeyTypeStore: store.NewKeyTypeStore()}
+}
+
+// filledStore holds keys of every type, with values that exercise each
+// encoding Save chooses.
+func filledStore() *store.Store {
+	st := newStore()
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	for key, value := range map[string]string{
+		"plain":    "value",
+		"empty":    "",
+		"binary":   "\x00\xff\r\n",
+		"int":      "12345",
+		"negative": "-1",
+		"padded":   "0123",
+		"long":     strings.Repeat("long value ", 1000),
+	} {
+		st.KV.SetWithDeadline(key, []byte(value), time.Time{})
+		st.KeyTypeStore.Register(key, store.String)
+	}
+	st.KV.SetWithDeadline("expiring", []byte("soon"), expiresAt)
+	st.KeyTypeStore.Register("expiring", store.String)
+
+	st.Lists.RPush("list", []byte("a"), []byte(""), []byte("42"), []byte(strings.Repeat("x", 5000)))
+	st.KeyTypeStore.Register("list", store.List)
+
+	// More entries than fit in one listpack node, some with the fields of
+	// the node's first entry and some with their own.
+	for i := range 250 {
+		entry := &store.StreamEntry{Id: fmt.Sprintf("1700000000000-%d", i),
+			Keys: [][]byte{[]byte("field")}, Values: [][]byte{[]byte(fmt.Sprint(i))}}
+		if i%3 == 0 {
+			entry.Keys = append(entry.Keys, []byte("other"))
+			entry.Values = append(entry.Values, []byte("value"))
+		}
+		st.StreamStore.Add("stream", entry)
+	}
+	st.KeyTypeStore.Register("stream", store.Stream)
+	return st
+}
+
+func TestSaveLoad(t *testing.T) {
+	want := filledStore()
+	var buf bytes.Buffer
+	if err := Save(&buf, want); err != nil {
+		t.Fatal(err)
+	}
+	got := newStore()
+	got.KV.SetWithDeadline("stale", []byte("replaced"), time.Time{})
+	if err := Load(&buf, got); err != nil {
+		t.Fatal(err)
+	}
+
+	wantKV, gotKV := want.KV.Snapshot(), got.KV.Snapshot()
+	if len(gotKV) != len(wantKV) {
+		t.Errorf("%d strings loaded, want %d", len(gotKV), len(wantKV))
+	}
+	for key, w := range wantKV {
+		g, ok := gotKV[key]
+		if !ok || !bytes.Equal(g.Data, w.Data) || !g.ExpiresAt.Equal(w.ExpiresAt) {
+			t.Errorf("string %q: got %q expiring %v, want %q expiring %v", key, g.Data, g.ExpiresAt, w.Data, w.ExpiresAt)
+		}
+	}
+	if g, w := got.Lists.Snapshot(), want.Lists.Snapshot(); !reflect.DeepEqual(g, w) {
+		t.Errorf("lists: got %q, want %q", g, w)
+	}
+	if g, w := got.StreamStore.Snapshot(), want.StreamStore.Snapshot(); !reflect.DeepEqual(g, w) {
+		t.Error("streams differ after a round trip")
+	}
+	for _, key := range []string{"plain", "expiring", "list", "stream"} {
+		if g, w := got.KeyTypeStore.Get(key), want.KeyTypeStore.Get(key); g != w {
+			t.Errorf("type of %q: %q, want %q", key, g, w)
+		}
+	}
+}
+
+func TestSaveChecksum(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Save(&buf, filledStore()); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	data[len(data)-1] ^= 0xff
+	if err := Load(bytes.NewReader(data), newStore()); err != ErrChecksum {
+		t.Errorf("got %v, want ErrChecksum", err)
+	}
+}
+
+// snapshot builds an RDB file whose keys body writes, without a checksum.
+func snapshot(body func(e *encoder)) []byte {
+	var buf bytes.Buffer
+	e := &encoder{w: bufio.NewWriter(&buf)}
+	e.write([]byte("REDIS0011"))
+	body(e)
+	e.byte(opEOF)
+	e.write(make([]byte, 8))
+	_ = e.w.Flush()
+	return buf.Bytes()
+}
+
+// TestLoadEncodings loads the encodings Redis writes but Save does not.
+func TestLoadEncodings(t *testing.T) {
+	lp := &listpack{}
+	for _, s := range []string{"a", "-5000", "bb", "70000", "9000000000"} {
+		lp.appendString(s)
+	}
+	data := snapshot(func(e *encoder) {
+		e.byte(typeString)
+		e.string("int8")
+		e.write([]byte{0xc0 | encInt8, 0xfe})
+		e.byte(typeString)
+		e.string("int16")
+		e.write([]byte{0xc0 | encInt16, 0x30, 0xf8})
+		e.byte(typeString)
+		e.string("int32")
+		e.write([]byte{0xc0 | encInt32, 0x40, 0x42, 0x0f, 0x00})
+
+		// "a" as a literal, then a back reference copying it 9 times.
+		e.byte(typeString)
+		e.string("lzf")
+		e.byte(0xc0 | encLZF)
+		e.length(5)
+		e.length(10)
+		e.write([]byte{0x00, 'a', 0xe0, 0x00, 0x00})
+
+		e.byte(typeListQuicklist2)
+		e.string("quicklist")
+		e.length(2)
+		e.length(quicklistNodePacked)
+		e.string(string(lp.bytes()))
+		e.length(quicklistNodePlain)
+		e.string("plain node")
+
+		// Keys of other databases are skipped.
+		e.byte(opSelectDB)
+		e.length(1)
+		e.byte(typeString)
+		e.string("other db")
+		e.string("value")
+	})
+
+	st := newStore()
+	if err := Load(bytes.NewReader(data), st); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{"int8": "-2", "int16": "-2000", "int32": "1000000", "lzf": "aaaaaaaaaa"} {
+		if got, ok := st.KV.Get(key); !ok || string(got) != want {
+			t.Errorf("%s: got %q, want %q", key, got, want)
+		}
+	}
+	want := [][]byte{[]byte("a"), []byte("-5000"), []byte("bb"), []byte("70000"), []byte("9000000000"), []byte("plain node")}
+	if got := st.Lists.LRange("quicklist", 0, -1); !reflect.DeepEqual(got, want) {
+		t.Errorf("quicklist: got %q, want %q", got, want)
+	}
+	if _, ok := st.KV.Get("other db"); ok {
+		t.Error("a key of database 1 was loaded")
+	}
+}
+
+// stream returns a stream of one listpack node holding elements, whose
+// consumer groups groups writes, or none if it is nil.
+func stream(groups func(e *encoder), elements ...string) func(e *encoder) {
+	return func(e *encoder) {
+		lp := &listpack{}
+		for _, element := range elements {
+			lp.appendString(element)
+		}
+		e.byte(typeStreamListpacks)
+		e.string("stream")
+		e.length(1)
+		e.string(string(make([]byte, 16)))
+		e.string(string(lp.bytes()))
+		e.length(1)
+		e.length(0)
+		e.length(0)
+		if groups == nil {
+			e.length(0)
+			return
+		}
+		groups(e)
+	}
+}
+
+// validNode is a stream node of one entry, 0-0 with field set to value.
+var validNode = []string{"1", "0", "1", "field", "0", "2", "0", "0", "value", "4"}
+
+func TestLoadCorrupt(t *testing.T) {
+	var valid bytes.Buffer
+	if err := Save(&valid, filledStore()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"signature", []byte("RODIS0011\xff")},
+		{"version", []byte("REDIS0099\xff")},
+		{"huge string length", snapshot(func(e *encoder) {
+			e.byte(typeString)
+			e.string("key")
+			e.write([]byte{0x81, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+		})},
+		{"string longer than the file", snapshot(func(e *encoder) {
+			e.byte(typeString)
+			e.string("key")
+			e.length(1 << 40)
+		})},
+		{"huge lzf output", snapshot(func(e *encoder) {
+			e.byte(typeString)
+			e.string("key")
+			e.byte(0xc0 | encLZF)
+			e.length(5)
+			e.length(1 << 62)
+			e.write([]byte{0x00, 'a', 0xe0, 0x00, 0x00})
+		})},
+		{"negative lzf output", snapshot(func(e *encoder) {
+			e.byte(typeString)
+			e.string("key")
+			e.byte(0xc0 | encLZF)
+			e.length(5)
+			e.length(1<<64 - 1)
+			e.write([]byte{0x00, 'a', 0xe0, 0x00, 0x00})
+		})},
+		{"lzf reference before the start", snapshot(func(e *encoder) {
+			e.byte(typeString)
+			e.string("key")
+			e.byte(0xc0 | encLZF)
+			e.length(2)
+			e.length(3)
+			e.write([]byte{0x20, 0x05})
+		})},
+		{"huge list length", snapshot(func(e *encoder) {
+			e.byte(typeList)
+			e.string("key")
+			e.length(1 << 62)
+		})},
+		{"truncated listpack", snapshot(func(e *encoder) {
+			e.byte(typeListQuicklist2)
+			e.string("key")
+			e.length(1)
+			e.length(quicklistNodePacked)
+			e.string("\x10\x00\x00\x00\x01\x00\xf0\xff\xff")
+		})},
+		{"huge stream entry count", snapshot(stream(nil, "1099511627776", "0", "1", "field", "0"))},
+		{"negative stream entry count", snapshot(stream(nil, "-1", "0", "1", "field", "0"))},
+		{"huge stream master field count", snapshot(stream(nil, "1", "0", "1099511627776", "field", "0"))},
+		{"negative stream master field count", snapshot(stream(nil, "1", "0", "-1", "field", "0"))},
+		{"huge consumer pending count", snapshot(stream(func(e *encoder) {
+			e.length(1)
+			e.string("group")
+			e.length(0)
+			e.length(0)
+			e.length(0)
+			e.length(1)
+			e.string("consumer")
+			e.write(make([]byte, 8))
+			// Times 16 bytes, this overflows to zero.
+			e.length(1 << 60)
+		}, validNode...))},
+		{"unknown type", snapshot(func(e *encoder) {
+			e.byte(100)
+			e.string("key")
+		})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Load(bytes.NewReader(tt.data), newStore()); err == nil {
+				t.Error("corrupt snapshot loaded without an error")
+			}
+		})
+	}
+
+	// A snapshot cut short anywhere fails to load.
+	data := valid.Bytes()
+	for n := range len(data) {
+		if err := Load(bytes.NewReader(data[:n]), newStore()); err == nil {
+			t.Fatalf("snapshot cut after %d of %d bytes loaded", n, len(data))
+		}
+	}
+}
+
+func FuzzLoad(f *testing.F) {
+	var valid bytes.Buffer
+	if err := Save(&valid, filledStore()); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(valid.Bytes())
+	f.Add(snapshot(stream(nil, validNode...)))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Arbitrary input fails with an error rather than a panic or an
+		// allocation it does not hold the data for.
+		_ = Load(bytes.NewReader(data), newStore())
+	})
+}
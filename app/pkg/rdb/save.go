@@ -0,0 +1,237 @@
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/store"
+)
+
+type encoder struct {
+	w   *bufio.Writer
+	crc uint64
+	err error
+}
+
+func (e *encoder) write(p []byte) {
+	if e.err != nil {
+		return
+	}
+	e.crc = crc64Update(e.crc, p)
+	_, e.err = e.w.Write(p)
+}
+
+func (e *encoder) byte(b byte) {
+	e.write([]byte{b})
+}
+
+func (e *encoder) length(n uint64) {
+	switch {
+	case n < 1<<6:
+		e.byte(byte(n))
+	case n < 1<<14:
+		e.write([]byte{0x40 | byte(n>>8), byte(n)})
+	case n <= 0xffffffff:
+		b := []byte{0x80, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(b[1:], uint32(n))
+		e.write(b)
+	default:
+		b := []byte{0x81, 0, 0, 0, 0, 0, 0, 0, 0}
+		binary.BigEndian.PutUint64(b[1:], n)
+		e.write(b)
+	}
+}
+
+func (e *encoder) string(s string) {
+	e.length(uint64(len(s)))
+	e.write([]byte(s))
+}
+
+func (e *encoder) aux(key, value string) {
+	e.byte(opAux)
+	e.string(key)
+	e.string(value)
+}
+
+// Save writes a snapshot of every key in st in RDB format.
+func Save(w io.Writer, st *store.Store) error {
+	kv := st.KV.Snapshot()
+	lists := st.Lists.Snapshot()
+	streams := st.StreamStore.Snapshot()
+
+	e := &encoder{w: bufio.NewWriter(w)}
+	e.write([]byte(fmt.Sprintf("REDIS%04d", version)))
+	e.aux("redis-ver", "7.2.0")
+	e.aux("redis-bits", "64")
+	e.aux("ctime", strconv.FormatInt(time.Now().Unix(), 10))
+	e.aux("aof-base", "0")
+
+	expires := 0
+	for _, entry := range kv {
+		if !entry.ExpiresAt.IsZero() {
+			expires++
+		}
+	}
+	if total := len(kv) + len(lists) + len(streams); total > 0 {
+		e.byte(opSelectDB)
+		e.length(0)
+		e.byte(opResizeDB)
+		e.length(uint64(total))
+		e.length(uint64(expires))
+	}
+
+	for key, entry := range kv {
+		if !entry.ExpiresAt.IsZero() {
+			b := make([]byte, 9)
+			b[0] = opExpireTimeMs
+			binary.LittleEndian.PutUint64(b[1:], uint64(entry.ExpiresAt.UnixMilli()))
+			e.write(b)
+		}
+		e.byte(typeString)
+		e.string(key)
+		e.string(string(entry.Data))
+	}
+
+	for key, list := range lists {
+		e.byte(typeList)
+		e.string(key)
+		e.length(uint64(len(list)))
+		for _, value := range list {
+			e.string(string(value))
+		}
+	}
+
+	for key, entries := range streams {
+		if len(entries) == 0 {
+			continue
+		}
+		if err := e.stream(key, entries); err != nil {
+			return err
+		}
+	}
+
+	e.byte(opEOF)
+	if e.err != nil {
+		return e.err
+	}
+	checksum := make([]byte, 8)
+	binary.LittleEndian.PutUint64(checksum, e.crc)
+	if _, err := e.w.Write(checksum); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+// stream writes a stream as listpack nodes of up to streamNodeMaxEntries
+// entries, each delta-encoded against the node's first entry.
+func (e *encoder) stream(key string, entries []*store.StreamEntry) error {
+	type node struct {
+		key []byte
+		lp  []byte
+	}
+	var nodes []node
+	var lastMs, lastSeq uint64
+
+	for start := 0; start < len(entries); start += streamNodeMaxEntries {
+		end := min(start+streamNodeMaxEntries, len(entries))
+		chunk := entries[start:end]
+
+		masterMs, masterSeq, err := parseID(chunk[0].Id)
+		if err != nil {
+			return err
+		}
+		masterFields := chunk[0].Keys
+
+		lp := &listpack{}
+		lp.appendInt(int64(len(chunk)))
+		lp.appendInt(0)
+		lp.appendInt(int64(len(masterFields)))
+		for _, field := range masterFields {
+			lp.appendString(string(field))
+		}
+		lp.appendInt(0)
+
+		for _, entry := range chunk {
+			ms, seq, err := parseID(entry.Id)
+			if err != nil {
+				return err
+			}
+			lastMs, lastSeq = ms, seq
+
+			sameFields := equalFields(entry.Keys, masterFields)
+			flags := int64(0)
+			if sameFields {
+				flags = streamItemFlagSameFields
+			}
+			lp.appendInt(flags)
+			lp.appendInt(int64(ms - masterMs))
+			lp.appendInt(int64(seq - masterSeq))
+			if sameFields {
+				for _, value := range entry.Values {
+					lp.appendString(string(value))
+				}
+				lp.appendInt(int64(len(entry.Keys) + 3))
+			} else {
+				lp.appendInt(int64(len(entry.Keys)))
+				for i, field := range entry.Keys {
+					lp.appendString(string(field))
+					lp.appendString(string(entry.Values[i]))
+				}
+				lp.appendInt(int64(2*len(entry.Keys) + 4))
+			}
+		}
+
+		nodeKey := make([]byte, 16)
+		binary.BigEndian.PutUint64(nodeKey, masterMs)
+		binary.BigEndian.PutUint64(nodeKey[8:], masterSeq)
+		nodes = append(nodes, node{key: nodeKey, lp: lp.bytes()})
+	}
+
+	e.byte(typeStreamListpacks)
+	e.string(key)
+	e.length(uint64(len(nodes)))
+	for _, n := range nodes {
+		e.string(string(n.key))
+		e.string(string(n.lp))
+	}
+	e.length(uint64(len(entries)))
+	e.length(lastMs)
+	e.length(lastSeq)
+	// No consumer groups.
+	e.length(0)
+	return nil
+}
+
+func parseID(id string) (uint64, uint64, error) {
+	msPart, seqPart, ok := strings.Cut(id, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("rdb: invalid stream ID %q", id)
+	}
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("rdb: invalid stream ID %q", id)
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("rdb: invalid stream ID %q", id)
+	}
+	return ms, seq, nil
+}
+
+func equalFields(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,256 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/rdb"
+)
+
+const (
+	replicaRetryInterval = time.Second
+	replicaAckInterval   = time.Second
+)
+
+// startReplication makes the server a replica of host:port, replacing any
+// previous primary.
+func (s *Server) startReplication(host, port string) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s.repl.mu.Lock()
+	if s.repl.stop != nil {
+		s.repl.stop()
+	}
+	s.repl.primaryHost, s.repl.primaryPort = host, port
+	s.repl.linkUp = false
+	s.repl.stop = cancel
+	// Our own replicas must resynchronise with the new dataset.
+	s.disconnectReplicasLocked()
+	s.repl.mu.Unlock()
+
+	go s.replicate(ctx, host, port)
+}
+
+// replicate keeps a link to the primary until ctx is cancelled,
+// reconnecting whenever the link breaks.
+func (s *Server) replicate(ctx context.Context, host, port string) {
+	for {
+		err := s.syncWithPrimary(ctx, host, port)
+		if ctx.Err() != nil {
+			return
+		}
+		fmt.Println("Replication link with primary lost:", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(replicaRetryInterval):
+		}
+	}
+}
+
+func (s *Server) syncWithPrimary(ctx context.Context, host, port string) error {
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	rp := protocol.NewRespProtocol(conn)
+	send := func(args ...string) (string, error) {
+		if _, err := conn.Write(protocol.EncodeCommand(args)); err != nil {
+			return "", err
+		}
+		line, err := rp.Reader.ReadString('\n')
+		return strings.TrimRight(line, "\r\n"), err
+	}
+	expect := func(want string, args ...string) error {
+		reply, err := send(args...)
+		if err != nil {
+			return err
+		}
+		if reply != want {
+			return fmt.Errorf("unexpected reply to %s: %q", args[0], reply)
+		}
+		return nil
+	}
+
+	if password := s.Config.Get("masterauth"); password != "" {
+		auth := []string{"AUTH", password}
+		if user := s.Config.Get("masteruser"); user != "" {
+			auth = []string{"AUTH", user, password}
+		}
+		if err := expect("+OK", auth...); err != nil {
+			return err
+		}
+	}
+	if err := expect("+PONG", "PING"); err != nil {
+		return err
+	}
+	if err := expect("+OK", "REPLCONF", "listening-port", s.Config.Get("port")); err != nil {
+		return err
+	}
+	if err := expect("+OK", "REPLCONF", "capa", "psync2"); err != nil {
+		return err
+	}
+
+	// With a replication history, ask to continue from our offset.
+	psyncID, psyncOffset := "?", "-1"
+	s.repl.mu.Lock()
+	if s.repl.backlog != nil {
+		psyncID, psyncOffset = s.repl.id, strconv.FormatInt(s.repl.offset+1, 10)
+	}
+	s.repl.mu.Unlock()
+
+	reply, err := send("PSYNC", psyncID, psyncOffset)
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(reply)
+	switch {
+	case len(fields) == 3 && fields[0] == "+FULLRESYNC":
+		offset, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid PSYNC offset %q", fields[2])
+		}
+		if err := s.loadSnapshotFromPrimary(rp); err != nil {
+			return err
+		}
+
+		s.repl.mu.Lock()
+		if ctx.Err() != nil {
+			s.repl.mu.Unlock()
+			return ctx.Err()
+		}
+		s.repl.id, s.repl.id2 = fields[1], noReplID
+		s.repl.offset, s.repl.secondOffset = offset, -1
+		s.resetBacklogLocked()
+		s.disconnectReplicasLocked()
+
+	case len(fields) >= 1 && fields[0] == "+CONTINUE":
+		s.repl.mu.Lock()
+		if ctx.Err() != nil {
+			s.repl.mu.Unlock()
+			return ctx.Err()
+		}
+		// The primary may have been promoted since we last synced.
+		if len(fields) == 2 && fields[1] != s.repl.id {
+			s.shiftReplIDLocked(fields[1])
+			s.disconnectReplicasLocked()
+		}
+
+	default:
+		return fmt.Errorf("unexpected reply to PSYNC: %q", reply)
+	}
+	s.repl.linkUp = true
+	s.repl.mu.Unlock()
+	defer func() {
+		s.repl.mu.Lock()
+		if ctx.Err() == nil {
+			s.repl.linkUp = false
+		}
+		s.repl.mu.Unlock()
+	}()
+
+	return s.applyReplicationStream(ctx, rp)
+}
+
+// loadSnapshotFromPrimary reads the "$<length>\r\n<rdb>" payload that
+// follows +FULLRESYNC and replaces the dataset with it.
+func (s *Server) loadSnapshotFromPrimary(rp *protocol.RespProtocol) error {
+	line, err := rp.Reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "$") {
+		return fmt.Errorf("unexpected snapshot header %q", line)
+	}
+	length, err := strconv.Atoi(line[1:])
+	if err != nil || length < 0 {
+		return fmt.Errorf("invalid snapshot length %q", line)
+	}
+	snapshot := make([]byte, 0, min(length, 1<<20))
+	buf := bytes.NewBuffer(snapshot)
+	if _, err := io.CopyN(buf, rp.Reader, int64(length)); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return rdb.Load(buf, s.Store)
+}
+
+// applyReplicationStream executes the commands the primary streams after
+// the snapshot and forwards them to this server's own replicas.
+func (s *Server) applyReplicationStream(ctx context.Context, rp *protocol.RespProtocol) error {
+	c := newClient(rp)
+	c.primary = true
+	c.authenticated = true
+	if err := s.addClient(c); err != nil {
+		return err
+	}
+	defer s.removeClient(c)
+
+	done := make(chan struct{})
+	defer close(done)
+	go s.ackPrimary(c, done)
+
+	rp.KeepRaw = true
+	for {
+		argv, err := rp.Read()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return errors.New("connection closed by primary")
+			}
+			return err
+		}
+		if len(argv) > 0 {
+			// Replies to the primary are suppressed.
+			_, _ = s.dispatch(c, argv)
+		}
+
+		// The offset counts the bytes received from the primary, however
+		// they were framed, and replicas of this server get the same bytes
+		// to keep theirs in step.
+		s.repl.mu.Lock()
+		if ctx.Err() == nil {
+			s.feedReplicasLocked(bytes.Clone(rp.Raw))
+		}
+		s.repl.mu.Unlock()
+	}
+}
+
+// ackPrimary periodically reports the processed offset to the primary, so
+// its view of this replica stays current even without REPLCONF GETACK.
+func (s *Server) ackPrimary(c *Client, done <-chan struct{}) {
+	ticker := time.NewTicker(replicaAckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		s.repl.mu.Lock()
+		offset := s.repl.offset
+		s.repl.mu.Unlock()
+		if err := c.writeRaw(ackCommand(offset)); err != nil {
+			return
+		}
+	}
+}
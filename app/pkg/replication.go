@@ -0,0 +1,454 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/rdb"
+)
+
+// replicaOutputLimit is how many propagated commands may wait for a slow
+// replica before it is disconnected.
+const replicaOutputLimit = 1 << 14
+
+// replication is the replication state of a server, both as a primary for
+// its replicas and as a replica of its own primary.
+type replication struct {
+	mu       sync.Mutex
+	id       string
+	offset   int64
+	replicas map[*Client]*replicaLink
+
+	// id2 is the replication ID this server used before its last ID
+	// change, valid for offsets up to secondOffset. It lets replicas of a
+	// promoted server's former primary continue with a partial resync.
+	id2          string
+	secondOffset int64
+
+	// backlog is created when the first replica attaches, or when this
+	// server syncs with its own primary, and then fed with every write.
+	backlog *backlog
+
+	// primaryHost is empty when this server is a primary.
+	primaryHost string
+	primaryPort string
+	linkUp      bool
+	stop        context.CancelFunc
+
+	// acked is closed and replaced whenever a replica acknowledges an
+	// offset, waking clients blocked in WAIT.
+	acked chan struct{}
+}
+
+// replicaLink streams the replication stream to one connected replica.
+type replicaLink struct {
+	client  *Client
+	out     chan []byte
+	dropped bool
+
+	ackOffset int64
+	ackTime   time.Time
+}
+
+const noReplID = "0000000000000000000000000000000000000000"
+
+func newReplication() *replication {
+	return &replication{
+		id:           newReplID(),
+		id2:          noReplID,
+		secondOffset: -1,
+		replicas:     make(map[*Client]*replicaLink),
+		acked:        make(chan struct{}),
+	}
+}
+
+func newReplID() string {
+	b := make([]byte, 20)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (s *Server) isReplica() bool {
+	s.repl.mu.Lock()
+	defer s.repl.mu.Unlock()
+	return s.repl.primaryHost != ""
+}
+
+// propagate sends a write command c executed to the replicas and records
+// the resulting offset as c's last write for WAIT.
+func (s *Server) propagate(c *Client, argv [][]byte) {
+	s.repl.mu.Lock()
+	defer s.repl.mu.Unlock()
+	if len(s.repl.replicas) == 0 && s.repl.backlog == nil {
+		return
+	}
+	s.feedReplicasLocked(protocol.EncodeCommand(argv))
+	c.replOffset = s.repl.offset
+}
+
+// feedReplicasLocked appends data to the replication stream. s.repl.mu must be held.
+func (s *Server) feedReplicasLocked(data []byte) {
+	s.repl.offset += int64(len(data))
+	if s.repl.backlog != nil {
+		s.repl.backlog.write(data)
+	}
+	s.sendToReplicasLocked(data)
+}
+
+func (s *Server) sendToReplicasLocked(data []byte) {
+	for _, link := range s.repl.replicas {
+		if link.dropped {
+			continue
+		}
+		select {
+		case link.out <- data:
+		default:
+			fmt.Println("Disconnecting replica that is too far behind:", link.client.rp.Conn.RemoteAddr())
+			link.dropped = true
+			_ = link.client.Close()
+		}
+	}
+}
+
+func (link *replicaLink) run() {
+	for data := range link.out {
+		if err := link.client.writeRaw(data); err != nil {
+			_ = link.client.Close()
+			// Keep draining until the link is removed and out is closed.
+		}
+	}
+}
+
+// resetBacklogLocked starts a new, empty backlog whose history begins
+// after the current offset.
+func (s *Server) resetBacklogLocked() {
+	s.repl.backlog = newBacklog(int(s.Config.Int("repl-backlog-size")))
+}
+
+// shiftReplIDLocked switches to a new replication ID, remembering the old
+// one so replicas that know it can still continue.
+func (s *Server) shiftReplIDLocked(newID string) {
+	s.repl.id2 = s.repl.id
+	s.repl.secondOffset = s.repl.offset + 1
+	s.repl.id = newID
+}
+
+func (s *Server) disconnectReplicasLocked() {
+	for c := range s.repl.replicas {
+		_ = c.Close()
+	}
+}
+
+// canContinueLocked reports whether a replica that has replID up to
+// offset-1 can be served from the backlog.
+func (s *Server) canContinueLocked(replID string, offset int64) bool {
+	if s.repl.backlog == nil {
+		return false
+	}
+	if replID != s.repl.id && (replID != s.repl.id2 || offset > s.repl.secondOffset) {
+		return false
+	}
+	first := s.repl.offset - int64(s.repl.backlog.histLen) + 1
+	return offset >= first && offset <= s.repl.offset+1
+}
+
+func (s *Server) attachReplicaLocked(c *Client, preamble []byte) {
+	link := &replicaLink{client: c, out: make(chan []byte, replicaOutputLimit), ackTime: time.Now()}
+	link.out <- preamble
+	s.repl.replicas[c] = link
+	s.countAsLink(c)
+	go link.run()
+}
+
+// removeReplica forgets c if it was a replica.
+func (s *Server) removeReplica(c *Client) {
+	s.repl.mu.Lock()
+	defer s.repl.mu.Unlock()
+	if link, ok := s.repl.replicas[c]; ok {
+		delete(s.repl.replicas, c)
+		close(link.out)
+	}
+}
+
+func replconfCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	if len(args)%2 != 0 {
+		return nil, &protocol.Error{Message: "ERR syntax error"}
+	}
+	for i := 0; i < len(args); i += 2 {
+		switch strings.ToLower(string(args[i])) {
+		case "listening-port":
+			port := string(args[i+1])
+			if _, err := strconv.Atoi(port); err != nil {
+				return nil, &protocol.Error{Message: "ERR value is not an integer or out of range"}
+			}
+			c.replListeningPort = port
+		case "ack":
+			// Acknowledgements from a replica are never replied to.
+			offset, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, nil
+			}
+			s.recordAck(c, offset)
+			return nil, nil
+		case "getack":
+			if c.primary {
+				s.repl.mu.Lock()
+				offset := s.repl.offset
+				s.repl.mu.Unlock()
+				_ = c.writeRaw(ackCommand(offset))
+			}
+			return nil, nil
+		case "capa", "ip-address":
+		default:
+			return nil, &protocol.Error{Message: fmt.Sprintf("ERR Unrecognized REPLCONF option: %s", args[i])}
+		}
+	}
+	return &protocol.SimpleString{Data: "OK"}, nil
+}
+
+// psyncCommand answers a replica's synchronisation request. When the
+// replica's offset is still in the backlog it gets +CONTINUE and the
+// missing bytes; otherwise a full resynchronisation: the snapshot followed
+// by the live write stream.
+func psyncCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	if c.primary {
+		return nil, &protocol.Error{Message: "ERR PSYNC is not allowed from the primary link"}
+	}
+	offset, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, &protocol.Error{Message: "ERR value is not an integer or out of range"}
+	}
+
+	s.repl.mu.Lock()
+	if _, ok := s.repl.replicas[c]; ok {
+		s.repl.mu.Unlock()
+		return nil, &protocol.Error{Message: "ERR replica already synchronised"}
+	}
+	if s.repl.primaryHost != "" && !s.repl.linkUp {
+		s.repl.mu.Unlock()
+		return nil, &protocol.Error{Message: "NOMASTERLINK Can't SYNC while not connected with my master"}
+	}
+	if s.canContinueLocked(string(args[0]), offset) {
+		missing := s.repl.backlog.last(int(s.repl.offset + 1 - offset))
+		preamble := append([]byte("+CONTINUE "+s.repl.id+"\r\n"), missing...)
+		s.attachReplicaLocked(c, preamble)
+		s.repl.mu.Unlock()
+		return nil, nil
+	}
+	s.repl.mu.Unlock()
+
+	// Writes hold s.mu exclusively, so the snapshot and the offset it
+	// corresponds to cannot be separated by a write.
+	var snapshot bytes.Buffer
+	if err := rdb.Save(&snapshot, s.Store); err != nil {
+		return nil, &protocol.Error{Message: "ERR " + err.Error()}
+	}
+
+	s.repl.mu.Lock()
+	defer s.repl.mu.Unlock()
+	if s.repl.backlog == nil {
+		s.resetBacklogLocked()
+	}
+
+	var preamble bytes.Buffer
+	fmt.Fprintf(&preamble, "+FULLRESYNC %s %d\r\n", s.repl.id, s.repl.offset)
+	fmt.Fprintf(&preamble, "$%d\r\n", snapshot.Len())
+	preamble.Write(snapshot.Bytes())
+	s.attachReplicaLocked(c, preamble.Bytes())
+
+	return nil, nil
+}
+
+func ackCommand(offset int64) []byte {
+	return protocol.EncodeCommand([]string{"REPLCONF", "ACK", strconv.FormatInt(offset, 10)})
+}
+
+// recordAck notes that replica c has processed the stream up to offset.
+func (s *Server) recordAck(c *Client, offset int64) {
+	s.repl.mu.Lock()
+	defer s.repl.mu.Unlock()
+	link, ok := s.repl.replicas[c]
+	if !ok {
+		return
+	}
+	link.ackTime = time.Now()
+	if offset > link.ackOffset {
+		link.ackOffset = offset
+		close(s.repl.acked)
+		s.repl.acked = make(chan struct{})
+	}
+}
+
+// ackedReplicasLocked counts the replicas that acknowledged offset.
+func (s *Server) ackedReplicasLocked(offset int64) int {
+	n := 0
+	for _, link := range s.repl.replicas {
+		if !link.dropped && link.ackOffset >= offset {
+			n++
+		}
+	}
+	return n
+}
+
+// waitCommand blocks until numreplicas replicas acknowledged the client's
+// last write or the timeout expires. It waits on its own connection's
+// goroutine without holding any server lock, so other clients keep running.
+func waitCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	numReplicas, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return nil, &protocol.Error{Message: "ERR value is not an integer or out of range"}
+	}
+	timeout, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, &protocol.Error{Message: "ERR timeout is not an integer or out of range"}
+	}
+	if timeout < 0 {
+		return nil, &protocol.Error{Message: "ERR timeout is negative"}
+	}
+
+	s.repl.mu.Lock()
+	if s.repl.primaryHost != "" {
+		s.repl.mu.Unlock()
+		return nil, &protocol.Error{Message: "ERR WAIT cannot be used with replica instances."}
+	}
+	acked, wakeup := s.ackedReplicasLocked(c.replOffset), s.repl.acked
+	// Inside EXEC the replicas cannot make progress, so don't wait.
+	if acked >= numReplicas || c.inExec {
+		s.repl.mu.Unlock()
+		return &protocol.IntegerBulkString{Data: int64(acked)}, nil
+	}
+	if len(s.repl.replicas) > 0 {
+		s.feedReplicasLocked(protocol.EncodeCommand([]string{"REPLCONF", "GETACK", "*"}))
+	}
+	s.repl.mu.Unlock()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(time.Duration(timeout) * time.Millisecond)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	for {
+		timedOut := false
+		select {
+		case <-wakeup:
+		case <-expired:
+			timedOut = true
+		case <-s.closing:
+			timedOut = true
+		case <-c.closed:
+			timedOut = true
+		}
+		s.repl.mu.Lock()
+		acked, wakeup = s.ackedReplicasLocked(c.replOffset), s.repl.acked
+		s.repl.mu.Unlock()
+
+		if timedOut || acked >= numReplicas {
+			return &protocol.IntegerBulkString{Data: int64(acked)}, nil
+		}
+	}
+}
+
+func replicaofCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	host, port := string(args[0]), string(args[1])
+	if strings.EqualFold(host, "no") && strings.EqualFold(port, "one") {
+		s.promote()
+		return &protocol.SimpleString{Data: "OK"}, nil
+	}
+
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		return nil, &protocol.Error{Message: "ERR Invalid master port"}
+	}
+
+	s.repl.mu.Lock()
+	if s.repl.primaryHost == host && s.repl.primaryPort == port {
+		s.repl.mu.Unlock()
+		return &protocol.SimpleString{Data: "OK Already connected to specified master"}, nil
+	}
+	s.repl.mu.Unlock()
+
+	s.startReplication(host, port)
+	return &protocol.SimpleString{Data: "OK"}, nil
+}
+
+// promote turns a replica into a primary, keeping its data, offset and
+// backlog. Its replicas are disconnected so they learn the new ID; they
+// reconnect with the old one, which is kept as the secondary ID.
+func (s *Server) promote() {
+	s.repl.mu.Lock()
+	defer s.repl.mu.Unlock()
+	if s.repl.primaryHost == "" {
+		return
+	}
+	if s.repl.stop != nil {
+		s.repl.stop()
+		s.repl.stop = nil
+	}
+	s.repl.primaryHost, s.repl.primaryPort = "", ""
+	s.repl.linkUp = false
+	s.shiftReplIDLocked(newReplID())
+	s.disconnectReplicasLocked()
+}
+
+func (s *Server) replicationInfo() string {
+	s.repl.mu.Lock()
+	defer s.repl.mu.Unlock()
+
+	var sb strings.Builder
+	sb.WriteString("# Replication\r\n")
+	if s.repl.primaryHost == "" {
+		sb.WriteString("role:master\r\n")
+	} else {
+		linkStatus := "down"
+		if s.repl.linkUp {
+			linkStatus = "up"
+		}
+		sb.WriteString("role:slave\r\n")
+		fmt.Fprintf(&sb, "master_host:%s\r\n", s.repl.primaryHost)
+		fmt.Fprintf(&sb, "master_port:%s\r\n", s.repl.primaryPort)
+		fmt.Fprintf(&sb, "master_link_status:%s\r\n", linkStatus)
+		fmt.Fprintf(&sb, "slave_repl_offset:%d\r\n", s.repl.offset)
+		sb.WriteString("slave_read_only:1\r\n")
+	}
+
+	// Dropped links stay registered until their connection closes, but
+	// are no longer connected replicas.
+	var replicas []string
+	for c, link := range s.repl.replicas {
+		if link.dropped {
+			continue
+		}
+		host, _, _ := net.SplitHostPort(c.rp.Conn.RemoteAddr().String())
+		lag := int64(time.Since(link.ackTime) / time.Second)
+		replicas = append(replicas, fmt.Sprintf("slave%d:ip=%s,port=%s,state=online,offset=%d,lag=%d\r\n", len(replicas), host, c.replListeningPort, link.ackOffset, lag))
+	}
+	fmt.Fprintf(&sb, "connected_slaves:%d\r\n", len(replicas))
+	for _, line := range replicas {
+		sb.WriteString(line)
+	}
+	fmt.Fprintf(&sb, "master_replid:%s\r\n", s.repl.id)
+	fmt.Fprintf(&sb, "master_replid2:%s\r\n", s.repl.id2)
+	fmt.Fprintf(&sb, "master_repl_offset:%d\r\n", s.repl.offset)
+	fmt.Fprintf(&sb, "second_repl_offset:%d\r\n", s.repl.secondOffset)
+	if s.repl.backlog == nil {
+		sb.WriteString("repl_backlog_active:0\r\n")
+		fmt.Fprintf(&sb, "repl_backlog_size:%d\r\n", s.Config.Int("repl-backlog-size"))
+		sb.WriteString("repl_backlog_first_byte_offset:0\r\n")
+		sb.WriteString("repl_backlog_histlen:0\r\n")
+	} else {
+		sb.WriteString("repl_backlog_active:1\r\n")
+		fmt.Fprintf(&sb, "repl_backlog_size:%d\r\n", s.repl.backlog.size())
+		fmt.Fprintf(&sb, "repl_backlog_first_byte_offset:%d\r\n", s.repl.offset-int64(s.repl.backlog.histLen)+1)
+		fmt.Fprintf(&sb, "repl_backlog_histlen:%d\r\n", s.repl.backlog.histLen)
+	}
+	return sb.String()
+}
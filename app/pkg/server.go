@@ -1,120 +1,448 @@
 package pkg
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io/fs"
 	"net"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/codecrafters-io/redis-starter-go/app/pkg/handler"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/acl"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/config"
 	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/pubsub"
 	"github.com/codecrafters-io/redis-starter-go/app/pkg/store"
 )
 
 type Server struct {
-	Addr  string
-	Store *store.Store
+	// Addr, if set, is the one address to serve plain TCP on, in place of
+	// the bind and port settings.
+	Addr     string
+	Store    *store.Store
+	Commands *CommandTable
+	PubSub   *pubsub.Hub
+	Config   *config.Config
+	ACL      *acl.ACL
+
+	// mu is held shared by read commands and exclusively by writes and
+	// EXEC, so transactions are atomic and writes reach replicas in the
+	// order they were applied.
+	mu sync.RWMutex
+
+	repl    *replication
+	stats   *stats
+	slowlog *slowlog
+
+	// runID identifies this run of the server in INFO.
+	runID     string
+	startTime time.Time
+
+	watchMu sync.Mutex
+	watched map[string]map[*Client]struct{}
+
+	lnMu      sync.Mutex
+	listeners []net.Listener
+
+	// limits bounds the requests of client connections; it follows the
+	// proto-max-bulk-len and client-query-buffer-limit settings.
+	limits protocol.Limits
+
+	// tlsConfig is swapped when the certificates are reloaded.
+	tlsConfig atomic.Pointer[tls.Config]
+
+	// monitorCount mirrors len(monitors) so that commands can skip feeding
+	// monitors without taking monitorMu.
+	monitorMu    sync.Mutex
+	monitors     map[*Client]struct{}
+	monitorCount atomic.Int32
+
+	// links counts the registered clients that are the link to a primary
+	// or to a replica; maxclients limits only the others. clientsMu may be
+	// taken with repl.mu held.
+	clientsMu    sync.Mutex
+	clients      map[*Client]struct{}
+	links        int
+	nextClientID int64
+
+	// closing is closed when a shutdown commits and done once it has
+	// finished; shutdownMu serialises concurrent shutdowns.
+	shutdownMu sync.Mutex
+	closing    chan struct{}
+	done       chan struct{}
 }
 
 func NewServer(addr string, store *store.Store) *Server {
-	return &Server{Addr: addr, Store: store}
+	commands := NewCommandTable()
+	for _, cmd := range builtinCommands {
+		commands.Register(cmd)
+	}
+	s := &Server{
+		Addr:      addr,
+		Store:     store,
+		Commands:  commands,
+		PubSub:    pubsub.NewHub(),
+		Config:    config.New(),
+		repl:      newReplication(),
+		watched:   make(map[string]map[*Client]struct{}),
+		stats:     newStats(),
+		slowlog:   &slowlog{},
+		runID:     newReplID(),
+		startTime: time.Now(),
+		clients:   make(map[*Client]struct{}),
+		monitors:  make(map[*Client]struct{}),
+		closing:   make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	s.ACL = acl.New(s.commandExists)
+	return s
+}
+
+// commandExists reports whether a command, or one of its subcommands when
+// sub is not empty, exists.
+func (s *Server) commandExists(name, sub string) bool {
+	cmd, ok := s.Commands.Lookup(name)
+	if !ok || sub == "" {
+		return ok
+	}
+	_, ok = cmd.Subcommands[sub]
+	return ok
 }
 
+// ListenAndServe loads the snapshot on disk, if any, and serves clients
+// until the server is shut down, after which it returns ErrServerClosed.
 func (s *Server) ListenAndServe() error {
-	ln, err := net.Listen("tcp", s.Addr)
-	if err != nil {
-		return err
+	if err := s.initACL(); err != nil {
+		return fmt.Errorf("loading ACL: %w", err)
+	}
+	s.applyLimits()
+	if err := s.loadRDB(); err != nil {
+		return fmt.Errorf("loading %s: %w", s.rdbPath(), err)
+	}
+
+	var listeners []net.Listener
+	defer func() {
+		for _, ln := range listeners {
+			ln.Close()
+		}
+	}()
+	if s.Config.Int("port") != 0 {
+		lns, err := s.listenTCP()
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, lns...)
+	}
+	if s.tlsEnabled() {
+		lns, err := s.listenTLS()
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, lns...)
+	}
+	if path := s.Config.Get("unixsocket"); path != "" {
+		ln, err := s.listenUnix(path)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, ln)
+	}
+	if len(listeners) == 0 {
+		return fmt.Errorf("none of port, tls-port and unixsocket is set")
+	}
+	for _, ln := range listeners {
+		if !s.trackListener(ln) {
+			return ErrServerClosed
+		}
+		fmt.Println("Server running on", ln.Addr())
+	}
+
+	if primary := strings.Fields(s.Config.Get("replicaof")); len(primary) == 2 {
+		s.startReplication(primary[0], primary[1])
+	}
+
+	go s.closeIdleClients()
+	for _, ln := range listeners[1:] {
+		go s.serve(ln)
 	}
-	defer ln.Close()
-	fmt.Println("Server running on port 6379")
+	return s.serve(listeners[0])
+}
+
+// serve accepts connections on ln until the server is shut down.
+func (s *Server) serve(ln net.Listener) error {
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
+			if s.isClosing() {
+				<-s.done
+				return ErrServerClosed
+			}
 			fmt.Println("Error accepting connection:", err)
 			continue
 		}
 
+		s.setKeepAlive(conn)
 		respProtocol := protocol.NewRespProtocol(conn)
-		go s.handleConnection(respProtocol)
+		respProtocol.Limits = &s.limits
+		go s.handleConnection(newClient(respProtocol))
+	}
+}
+
+// listenTCP listens on Addr, or on every bind address with the port.
+func (s *Server) listenTCP() ([]net.Listener, error) {
+	if s.Addr == "" {
+		return s.listenBind(s.Config.Get("port"))
+	}
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return nil, err
+	}
+	return []net.Listener{ln}, nil
+}
+
+// listenBind listens on every bind address with port, skipping optional
+// addresses that are unavailable.
+func (s *Server) listenBind(port string) ([]net.Listener, error) {
+	var listeners []net.Listener
+	for _, bind := range s.Config.BindAddrs(port) {
+		ln, err := net.Listen(bind.Network, bind.Addr)
+		if err != nil {
+			if bind.Optional {
+				fmt.Printf("Skipping bind address %s: %v\n", bind.Addr, err)
+				continue
+			}
+			for _, ln := range listeners {
+				ln.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, ln)
+	}
+	if len(listeners) == 0 {
+		return nil, fmt.Errorf("none of the bind addresses is available on port %s", port)
+	}
+	return listeners, nil
+}
+
+// listenUnix listens on a Unix socket, replacing a stale socket file left
+// by a previous run. Closing the listener removes the file.
+func (s *Server) listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&fs.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if perm, _ := strconv.ParseUint(s.Config.Get("unixsocketperm"), 8, 32); perm != 0 {
+		if err := os.Chmod(path, fs.FileMode(perm)); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+	return ln, nil
+}
+
+// trackListener registers ln so Shutdown closes it. It reports false if
+// the server is already shut down.
+func (s *Server) trackListener(ln net.Listener) bool {
+	s.lnMu.Lock()
+	defer s.lnMu.Unlock()
+	if s.isClosing() {
+		return false
+	}
+	s.listeners = append(s.listeners, ln)
+	return true
+}
+
+// addClient registers c. Connections from clients, unlike the links to a
+// primary and to replicas, count towards maxclients.
+func (s *Server) addClient(c *Client) error {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	if s.isClosing() {
+		return ErrServerClosed
+	}
+	if !c.primary && int64(len(s.clients)-s.links) >= s.Config.Int("maxclients") {
+		s.stats.rejectedConnections.Add(1)
+		return errMaxClients
+	}
+	s.nextClientID++
+	c.id = s.nextClientID
+	s.stats.connections.Add(1)
+	s.clients[c] = struct{}{}
+	if c.primary {
+		c.link = true
+		s.links++
 	}
 	return nil
 }
 
-func (s *Server) handleConnection(rp *protocol.RespProtocol) {
-	defer rp.Conn.Close()
+// countAsLink stops counting c, which became a replica, towards maxclients.
+func (s *Server) countAsLink(c *Client) {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	if _, ok := s.clients[c]; ok && !c.link {
+		c.link = true
+		s.links++
+	}
+}
+
+func (s *Server) removeClient(c *Client) {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	delete(s.clients, c)
+	if c.link {
+		s.links--
+	}
+}
+
+func (s *Server) handleConnection(c *Client) {
+	defer c.Close()
+	if err := s.addClient(c); err != nil {
+		if err == errMaxClients {
+			_ = c.Write(&protocol.Error{Message: err.Error()})
+		}
+		return
+	}
+	defer s.removeClient(c)
+	c.authenticated = !s.ACL.AuthRequired()
+	defer s.unwatchAll(c)
+	defer s.unsubscribeAll(c)
+	defer s.removeReplica(c)
+	defer s.removeMonitor(c)
 
 	for {
-		input, err := rp.Read()
+		input, err := c.rp.Read()
 		if err != nil {
 			fmt.Println("Error reading input:", err)
+			var protoErr *protocol.ProtocolError
+			if errors.As(err, &protoErr) {
+				_ = c.Write(&protocol.Error{Message: "ERR " + protoErr.Error()})
+			}
 			return
 		}
 		if len(input) == 0 {
 			continue
 		}
 
-		cmd := strings.ToUpper(input[0])
-		args := input[1:]
-
-		var resp protocol.RespValue
-		var respErr *protocol.Error
-
-		switch cmd {
-		case "PING":
-			resp = &protocol.SimpleString{Data: "PONG"}
-
-		case "ECHO":
-			if len(args) != 1 {
-				respErr = &protocol.Error{Message: "ERR wrong number of arguments for 'ECHO'"}
-			} else {
-				resp = &protocol.BulkString{Data: args[0]}
-			}
-
-		case "SET":
-			resp, respErr = handler.Set(args, s.Store.KV)
-			if respErr == nil {
-				s.Store.KeyTypeStore.Register(args[0], store.String)
-			}
+		resp, respErr := s.dispatch(c, input)
+		c.commandDone()
+		if respErr != nil {
+			_ = c.reply(respErr)
+		} else if resp != nil {
+			_ = c.reply(resp)
+		}
+		if c.closeAfterReply {
+			_ = c.rp.Flush()
+			return
+		}
+	}
+}
 
-		case "GET":
-			resp, respErr = handler.Get(args, s.Store.KV)
+// dispatch looks up the command named by argv[0], checks its arity and
+// either queues it for a pending transaction or runs it.
+func (s *Server) dispatch(c *Client, argv [][]byte) (protocol.RespValue, *protocol.Error) {
+	cmd, ok := s.Commands.lookupArg(argv[0])
+	if !ok {
+		if c.multi != nil {
+			c.multi.aborted = true
+		}
+		return nil, &protocol.Error{Message: fmt.Sprintf("ERR unknown command '%s'", argv[0])}
+	}
+	c.setLastCommand(cmd.fullName(argv))
+	if !cmd.CheckArity(len(argv)) {
+		return s.reject(c, cmd, argv, cmd.wrongArity())
+	}
 
-		case "LPUSH":
-			resp, respErr = handler.LPush(args, s.Store.Lists)
+	if !c.authenticated && !cmd.Has(FlagNoAuth) && s.ACL.AuthRequired() {
+		return s.reject(c, cmd, argv, &protocol.Error{Message: "NOAUTH Authentication required."})
+	}
+	if err := s.checkACL(c, cmd, argv, "toplevel"); err != nil {
+		return s.reject(c, cmd, argv, err)
+	}
 
-		case "RPUSH":
-			resp, respErr = handler.RPush(args, s.Store.Lists)
+	// RESP3 can tell pushed messages from replies, so only RESP2 clients
+	// are restricted while subscribed.
+	if c.subscriptionCount() > 0 && c.rp.Version() == 2 && !subscribedModeCommands[cmd.Name] {
+		return s.reject(c, cmd, argv, &protocol.Error{Message: fmt.Sprintf("ERR Can't execute '%s': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context", cmd.Name)})
+	}
 
-		case "LPOP":
-			resp, respErr = handler.LPop(args, s.Store.Lists)
+	if cmd.Has(FlagWrite) && !c.primary && s.isReplica() {
+		return s.reject(c, cmd, argv, &protocol.Error{Message: "READONLY You can't write against a read only replica."})
+	}
 
-		case "LLEN":
-			resp, respErr = handler.LLen(args, s.Store.Lists)
+	if c.multi != nil && !cmd.Has(FlagNoMulti) {
+		c.multi.commands = append(c.multi.commands, queuedCommand{cmd: cmd, argv: protocol.CloneArgs(argv)})
+		return &protocol.SimpleString{Data: "QUEUED"}, nil
+	}
 
-		case "LRANGE":
-			resp, respErr = handler.LRange(args, s.Store.Lists)
+	// Blocking commands may wait indefinitely and transaction commands take
+	// the lock themselves, so neither holds it while running. REPLCONF only
+	// touches replication state, and replica acknowledgements must get
+	// through while a shutdown holds the lock waiting for them.
+	switch {
+	case cmd.Has(FlagBlocking) || cmd.Has(FlagNoMulti) || cmd.Name == "replconf":
+	case cmd.Has(FlagWrite):
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	default:
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+	}
+	if s.isClosing() {
+		return s.reject(c, cmd, argv, &protocol.Error{Message: "ERR server is shutting down"})
+	}
+	if cmd.Has(FlagBlocking) {
+		// Answer the commands pipelined before this one first.
+		_ = c.rp.Flush()
+		c.setBlocked(true)
+		defer c.setBlocked(false)
+	}
+	return s.call(c, cmd, argv)
+}
 
-		case "BLPOP":
-			resp, respErr = handler.BLPop(args, s.Store.Lists)
+// reject refuses a command before it runs, which also fails a pending
+// transaction.
+func (s *Server) reject(c *Client, cmd *Command, argv [][]byte, err *protocol.Error) (protocol.RespValue, *protocol.Error) {
+	if c.multi != nil {
+		c.multi.aborted = true
+	}
+	s.stats.rejected(cmd.fullName(argv))
+	return nil, err
+}
 
-		case "TYPE":
-			resp = &protocol.SimpleString{Data: s.Store.KeyTypeStore.Get(args[0])}
-		case "XADD":
-			resp, respErr = handler.XAdd(args, s.Store.StreamStore)
-			if respErr == nil {
-				s.Store.KeyTypeStore.Register(args[0], store.Stream)
+// call runs cmd and does the bookkeeping every executed command needs.
+func (s *Server) call(c *Client, cmd *Command, argv [][]byte) (protocol.RespValue, *protocol.Error) {
+	if s.monitorCount.Load() > 0 {
+		s.feedMonitors(c, cmd, argv)
+	}
+	start := time.Now()
+	resp, respErr := cmd.Handler(s, c, argv[1:])
+	elapsed := time.Since(start)
+	s.stats.called(cmd.fullName(argv), elapsed, respErr != nil)
+	// Time spent blocked waiting is not execution time.
+	if !cmd.Has(FlagBlocking) {
+		s.recordSlow(c, cmd, argv, elapsed)
+	}
+	// Blocking commands touch and propagate only the keys they wrote, in
+	// the non-blocking form of what they did.
+	if respErr == nil && cmd.Has(FlagWrite) && !cmd.Has(FlagBlocking) {
+		s.touchKeys(cmd.Keys(argv))
+		if !c.primary {
+			if c.inExec && !c.multiPropagated {
+				s.propagate(c, byteArgs("MULTI"))
+				c.multiPropagated = true
 			}
-		case "XRANGE":
-			resp, respErr = handler.XRange(args, s.Store.StreamStore)
-		case "XREAD":
-			resp, respErr = handler.XReadStreams(args[1:], s.Store.StreamStore)
-		default:
-			respErr = &protocol.Error{Message: fmt.Sprintf("ERR unknown command '%s'", cmd)}
-		}
-
-		if respErr != nil {
-			_ = rp.Write(respErr)
-		} else if resp != nil {
-			_ = rp.Write(resp)
+			s.propagate(c, argv)
 		}
 	}
+	return resp, respErr
 }
@@ -0,0 +1,357 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/config"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/store"
+)
+
+func newStore() *store.Store {
+	return &store.Store{KV: store.NewKVStore(), Lists: store.NewListsStore(),
+		StreamStore: store.NewStreamStore(), KeyTypeStore: store.NewKeyTypeStore()}
+}
+
+// startServer runs a server on an ephemeral loopback port, without
+// snapshots, and returns its address. It is shut down when the test ends.
+func startServer(t testing.TB) string {
+	t.Helper()
+	_, addrs := startServerArgs(t)
+	return addrs[0]
+}
+
+// startServerArgs is like startServer but also applies args, given as on
+// the command line, so tests can set what CONFIG SET can't. It returns the
+// server and the addresses of its listeners, in the order they are opened:
+// TCP, TLS, then the Unix socket. A TLS port needs a single bind address.
+func startServerArgs(t testing.TB, args ...string) (*Server, []string) {
+	t.Helper()
+	s := NewServer("127.0.0.1:0", newStore())
+	cfg, err := config.Parse(append([]string{"--dir", t.TempDir(), "--save", ""}, args...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Config = cfg
+	want := 1
+	if cfg.Int("tls-port") != 0 {
+		want++
+	}
+	if cfg.Get("unixsocket") != "" {
+		want++
+	}
+
+	served := make(chan error, 1)
+	go func() { served <- s.ListenAndServe() }()
+	t.Cleanup(func() {
+		if err := s.Shutdown(context.Background()); err != nil {
+			t.Error(err)
+		}
+		if err := <-served; !errors.Is(err, ErrServerClosed) {
+			t.Error(err)
+		}
+	})
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		select {
+		case err := <-served:
+			t.Fatalf("ListenAndServe: %v", err)
+		default:
+		}
+		var addrs []string
+		s.lnMu.Lock()
+		for _, ln := range s.listeners {
+			addrs = append(addrs, ln.Addr().String())
+		}
+		s.lnMu.Unlock()
+		if len(addrs) == want {
+			return s, addrs
+		}
+	}
+	t.Fatal("server did not start listening")
+	return nil, nil
+}
+
+func dial(t testing.TB, addr string, opts *client.Options) *client.Conn {
+	t.Helper()
+	c, err := client.Dial(context.Background(), "tcp", addr, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestSetGet(t *testing.T) {
+	c := dial(t, startServer(t), nil)
+
+	if got, err := client.String(c.Do("SET", "key", "value\r\n\x00")); err != nil || got != "OK" {
+		t.Fatalf("SET: %q, %v", got, err)
+	}
+	if got, err := client.String(c.Do("GET", "key")); err != nil || got != "value\r\n\x00" {
+		t.Errorf("GET: %q, %v", got, err)
+	}
+	if _, err := client.String(c.Do("GET", "missing")); err != client.ErrNil {
+		t.Errorf("GET of a missing key: %v, want ErrNil", err)
+	}
+	var replyErr *protocol.Error
+	if _, err := c.Do("GET"); !errors.As(err, &replyErr) {
+		t.Errorf("GET without a key: %v, want an error reply", err)
+	}
+	// The connection is still usable after an error reply.
+	if got, err := client.String(c.Do("PING")); err != nil || got != "PONG" {
+		t.Errorf("PING: %q, %v", got, err)
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	c := dial(t, startServer(t), nil)
+
+	var cmds [][]string
+	for i := range 1000 {
+		cmds = append(cmds, []string{"RPUSH", "list", strconv.Itoa(i)})
+	}
+	cmds = append(cmds, []string{"LLEN", "list"}, []string{"NOSUCHCOMMAND"}, []string{"LRANGE", "list", "-2", "-1"})
+	replies, err := c.Pipeline(cmds...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 1000 {
+		if n, err := client.Int64(replies[i], nil); err != nil || n != int64(i+1) {
+			t.Fatalf("reply %d: %d, %v", i, n, err)
+		}
+	}
+	if n, err := client.Int64(replies[1000], nil); err != nil || n != 1000 {
+		t.Errorf("LLEN: %d, %v", n, err)
+	}
+	if _, ok := replies[1001].(*protocol.Error); !ok {
+		t.Errorf("unknown command: %#v, want an error reply", replies[1001])
+	}
+	if got, err := client.Strings(replies[1002], nil); err != nil || !slices.Equal(got, []string{"998", "999"}) {
+		t.Errorf("LRANGE: %q, %v", got, err)
+	}
+}
+
+func TestMultiExec(t *testing.T) {
+	addr := startServer(t)
+	c := dial(t, addr, nil)
+
+	replies, err := c.Pipeline(
+		[]string{"MULTI"},
+		[]string{"SET", "a", "1"},
+		[]string{"SET", "a", "2"},
+		[]string{"GET", "a"},
+		[]string{"EXEC"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"OK", "QUEUED", "QUEUED", "QUEUED"} {
+		if got, err := client.String(replies[i], nil); err != nil || got != want {
+			t.Errorf("reply %d: %q, %v, want %q", i, got, err, want)
+		}
+	}
+	exec, ok := replies[4].(*protocol.Array)
+	if !ok || len(exec.Elements) != 3 {
+		t.Fatalf("EXEC: %#v", replies[4])
+	}
+	if got, err := client.String(exec.Elements[2], nil); err != nil || got != "2" {
+		t.Errorf("GET in EXEC: %q, %v", got, err)
+	}
+
+	// A write by another client to a watched key aborts the transaction.
+	other := dial(t, addr, nil)
+	if _, err := c.Do("WATCH", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Do("SET", "a", "3"); err != nil {
+		t.Fatal(err)
+	}
+	replies, err = c.Pipeline([]string{"MULTI"}, []string{"SET", "a", "4"}, []string{"EXEC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exec, ok := replies[2].(*protocol.Array); !ok || exec.Elements != nil {
+		t.Errorf("EXEC after a watched key changed: %#v, want a null array", replies[2])
+	}
+	if got, err := client.String(c.Do("GET", "a")); err != nil || got != "3" {
+		t.Errorf("GET: %q, %v", got, err)
+	}
+}
+
+func testPubSub(t *testing.T, proto int) {
+	addr := startServer(t)
+	ps := client.NewPubSub(dial(t, addr, &client.Options{Protocol: proto}))
+	publisher := dial(t, addr, nil)
+
+	if err := ps.Subscribe("news"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.PSubscribe("new?"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []client.Subscription{{Kind: "subscribe", Channel: "news", Count: 1}, {Kind: "psubscribe", Channel: "new?", Count: 2}} {
+		got, err := ps.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sub, ok := got.(*client.Subscription); !ok || *sub != want {
+			t.Fatalf("got %#v, want %#v", got, want)
+		}
+	}
+
+	if n, err := client.Int64(publisher.Do("PUBLISH", "news", "hello")); err != nil || n != 2 {
+		t.Fatalf("PUBLISH: %d, %v", n, err)
+	}
+	for _, want := range []client.Message{{Channel: "news", Payload: "hello"}, {Pattern: "new?", Channel: "news", Payload: "hello"}} {
+		got, err := ps.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg, ok := got.(*client.Message); !ok || *msg != want {
+			t.Fatalf("got %#v, want %#v", got, want)
+		}
+	}
+
+	if err := ps.Ping("hi"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ps.Receive(); err != nil || got.(*client.Pong).Data != "hi" {
+		t.Errorf("Ping: %#v, %v", got, err)
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	for _, proto := range []int{2, 3} {
+		t.Run(fmt.Sprintf("RESP%d", proto), func(t *testing.T) { testPubSub(t, proto) })
+	}
+}
+
+func TestPoolReuse(t *testing.T) {
+	pool := client.NewPool("tcp", startServer(t), &client.Options{PoolSize: 4})
+	defer pool.Close()
+	ctx := context.Background()
+
+	// Sequential commands reuse one connection.
+	first, err := client.Int64(pool.Do(ctx, "CLIENT", "ID"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 10 {
+		if id, err := client.Int64(pool.Do(ctx, "CLIENT", "ID")); err != nil || id != first {
+			t.Fatalf("CLIENT ID: %d, %v, want %d", id, err, first)
+		}
+	}
+
+	// Concurrent commands open no more than PoolSize connections.
+	var mu sync.Mutex
+	ids := make(map[int64]bool)
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key := strconv.Itoa(i)
+			if _, err := pool.Do(ctx, "SET", key, key); err != nil {
+				t.Error(err)
+				return
+			}
+			id, err := client.Int64(pool.Do(ctx, "CLIENT", "ID"))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			ids[id] = true
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if len(ids) > 4 {
+		t.Errorf("%d connections used, want at most 4", len(ids))
+	}
+	for i := range 50 {
+		key := strconv.Itoa(i)
+		if got, err := client.String(pool.Do(ctx, "GET", key)); err != nil || got != key {
+			t.Errorf("GET %s: %q, %v", key, got, err)
+		}
+	}
+}
+
+// countingConn counts the writes to a connection, each of which is a
+// flush of the replies buffered for it.
+type countingConn struct {
+	net.Conn
+	writes atomic.Int64
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	c.writes.Add(1)
+	return c.Conn.Write(p)
+}
+
+// BenchmarkPipeline sends batches of commands over an in-memory connection,
+// either all at once or each after the reply to the previous one. A batch
+// sent at once must be answered with a single write.
+func BenchmarkPipeline(b *testing.B) {
+	const batch = 100
+	for _, pipelined := range []bool{false, true} {
+		name := "unpipelined"
+		if pipelined {
+			name = "pipelined"
+		}
+		b.Run(name, func(b *testing.B) {
+			s := NewServer("", newStore())
+			conn, peer := net.Pipe()
+			defer peer.Close()
+			counted := &countingConn{Conn: conn}
+			go s.handleConnection(newClient(protocol.NewRespProtocol(counted)))
+
+			request := protocol.EncodeCommand([]string{"SET", "key", "value"})
+			requests := bytes.Repeat(request, batch)
+			replies := bufio.NewReader(peer)
+			readReply := func() {
+				if line, err := replies.ReadString('\n'); err != nil || line != "+OK\r\n" {
+					b.Fatalf("reply %q, %v", line, err)
+				}
+			}
+
+			for b.Loop() {
+				if pipelined {
+					if _, err := peer.Write(requests); err != nil {
+						b.Fatal(err)
+					}
+					for range batch {
+						readReply()
+					}
+					continue
+				}
+				for range batch {
+					if _, err := peer.Write(request); err != nil {
+						b.Fatal(err)
+					}
+					readReply()
+				}
+			}
+
+			flushes := float64(counted.writes.Load()) / float64(b.N)
+			if pipelined && flushes != 1 {
+				b.Errorf("%.2f flushes per batch, want 1", flushes)
+			}
+			b.ReportMetric(flushes, "flushes/op")
+			b.ReportMetric(float64(b.N*batch)/b.Elapsed().Seconds(), "cmds/s")
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+)
+
+// ErrServerClosed is returned by ListenAndServe once the server has been
+// shut down.
+var ErrServerClosed = errors.New("redis: server closed")
+
+type shutdownOptions struct {
+	save   bool
+	noSave bool
+	// now skips waiting for replicas to catch up.
+	now bool
+	// force shuts down even if the snapshot cannot be saved.
+	force bool
+}
+
+// Shutdown stops the server gracefully: it waits for in-flight commands to
+// finish, gives replicas up to shutdown-timeout seconds to acknowledge the
+// latest writes, saves a snapshot if persistence is enabled, and then closes
+// the listener and every connection, waking clients blocked in BLPOP or
+// WAIT. If ctx expires first, Shutdown returns its error and the server
+// keeps running.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.shutdown(ctx, shutdownOptions{})
+}
+
+func (s *Server) shutdown(ctx context.Context, opts shutdownOptions) error {
+	s.shutdownMu.Lock()
+	defer s.shutdownMu.Unlock()
+	if s.isClosing() {
+		return nil
+	}
+
+	if err := s.lockContext(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	if !opts.now {
+		s.waitForReplicas(ctx, time.Duration(s.Config.Int("shutdown-timeout"))*time.Second)
+	}
+
+	save := (s.persistenceEnabled() || opts.save) && !opts.noSave
+	if save {
+		if err := s.saveRDB(); err != nil {
+			if !opts.force {
+				fmt.Println("Error trying to save the DB, can't exit:", err)
+				return fmt.Errorf("saving snapshot: %w", err)
+			}
+			fmt.Println("Error trying to save the DB, exiting anyway:", err)
+		}
+	}
+
+	close(s.closing)
+	s.lnMu.Lock()
+	for _, ln := range s.listeners {
+		_ = ln.Close()
+	}
+	s.lnMu.Unlock()
+
+	s.repl.mu.Lock()
+	if s.repl.stop != nil {
+		s.repl.stop()
+		s.repl.stop = nil
+	}
+	s.repl.mu.Unlock()
+
+	s.Store.Lists.Close()
+	s.clientsMu.Lock()
+	for c := range s.clients {
+		_ = c.Close()
+	}
+	s.clientsMu.Unlock()
+
+	close(s.done)
+	return nil
+}
+
+func (s *Server) isClosing() bool {
+	select {
+	case <-s.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// lockContext takes s.mu exclusively, giving up when ctx expires.
+func (s *Server) lockContext(ctx context.Context) error {
+	locked := make(chan struct{})
+	go func() {
+		s.mu.Lock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		return nil
+	case <-ctx.Done():
+		go func() {
+			<-locked
+			s.mu.Unlock()
+		}()
+		return ctx.Err()
+	}
+}
+
+// waitForReplicas gives the replicas up to timeout to acknowledge the
+// current offset.
+func (s *Server) waitForReplicas(ctx context.Context, timeout time.Duration) {
+	s.repl.mu.Lock()
+	if len(s.repl.replicas) == 0 {
+		s.repl.mu.Unlock()
+		return
+	}
+	// Replicas acknowledge the offset preceding GETACK itself.
+	target := s.repl.offset
+	s.feedReplicasLocked(protocol.EncodeCommand([]string{"REPLCONF", "GETACK", "*"}))
+	s.repl.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		s.repl.mu.Lock()
+		done := s.ackedReplicasLocked(target) == len(s.repl.replicas)
+		wakeup := s.repl.acked
+		s.repl.mu.Unlock()
+		if done {
+			return
+		}
+		select {
+		case <-wakeup:
+		case <-timer.C:
+			fmt.Println("Shutting down without all replicas in sync")
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func shutdownCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	var opts shutdownOptions
+	for _, arg := range args {
+		switch strings.ToUpper(string(arg)) {
+		case "SAVE":
+			opts.save = true
+		case "NOSAVE":
+			opts.noSave = true
+		case "NOW":
+			opts.now = true
+		case "FORCE":
+			opts.force = true
+		default:
+			return nil, &protocol.Error{Message: "ERR syntax error"}
+		}
+	}
+	if opts.save && opts.noSave {
+		return nil, &protocol.Error{Message: "ERR syntax error"}
+	}
+	if err := s.shutdown(context.Background(), opts); err != nil {
+		return nil, &protocol.Error{Message: "ERR Errors trying to SHUTDOWN. Check logs."}
+	}
+	// The connection is already closed, so there is nothing to reply.
+	return nil, nil
+}
@@ -0,0 +1,140 @@
+package pkg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+)
+
+// Like Redis, the slow log keeps at most slowlogMaxArgs arguments of a
+// command and slowlogMaxArgLen bytes of each.
+const (
+	slowlogMaxArgs    = 32
+	slowlogMaxArgLen  = 128
+	slowlogGetDefault = 10
+)
+
+type slowlogEntry struct {
+	id       int64
+	time     time.Time
+	duration time.Duration
+	args     []string
+	addr     string
+	name     string
+}
+
+// slowlog holds the most recent slow commands, oldest first.
+type slowlog struct {
+	mu      sync.Mutex
+	entries []slowlogEntry
+	nextID  int64
+}
+
+// recordSlow logs argv if it ran for longer than slowlog-log-slower-than
+// microseconds. A negative threshold disables the slow log.
+func (s *Server) recordSlow(c *Client, cmd *Command, argv [][]byte, d time.Duration) {
+	threshold := s.Config.Int("slowlog-log-slower-than")
+	if threshold < 0 || d.Microseconds() < threshold {
+		return
+	}
+	e := slowlogEntry{
+		time:     time.Now(),
+		duration: d,
+		args:     slowlogArgs(redactArgs(cmd, argv)),
+		addr:     c.addr(),
+		name:     c.Name(),
+	}
+	maxLen := int(s.Config.Int("slowlog-max-len"))
+
+	sl := s.slowlog
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	e.id = sl.nextID
+	sl.nextID++
+	sl.entries = append(sl.entries, e)
+	if len(sl.entries) > maxLen {
+		sl.entries = append(sl.entries[:0:0], sl.entries[len(sl.entries)-maxLen:]...)
+	}
+}
+
+// slowlogArgs truncates argv the way Redis does.
+func slowlogArgs(argv [][]byte) []string {
+	n := len(argv)
+	if n > slowlogMaxArgs {
+		n = slowlogMaxArgs
+	}
+	args := make([]string, n)
+	for i := range args {
+		switch {
+		case i == slowlogMaxArgs-1 && len(argv) > slowlogMaxArgs:
+			args[i] = fmt.Sprintf("... (%d more arguments)", len(argv)-slowlogMaxArgs+1)
+		case len(argv[i]) > slowlogMaxArgLen:
+			args[i] = fmt.Sprintf("%s... (%d more bytes)", argv[i][:slowlogMaxArgLen], len(argv[i])-slowlogMaxArgLen)
+		default:
+			args[i] = string(argv[i])
+		}
+	}
+	return args
+}
+
+func slowlogCommand(s *Server, c *Client, args [][]byte) (protocol.RespValue, *protocol.Error) {
+	sl := s.slowlog
+	sub := strings.ToUpper(string(args[0]))
+	switch sub {
+	case "GET":
+		if len(args) > 2 {
+			return nil, subcommandArityError("slowlog", sub)
+		}
+		count := slowlogGetDefault
+		if len(args) == 2 {
+			n, err := strconv.Atoi(string(args[1]))
+			if err != nil || n < -1 {
+				return nil, &protocol.Error{Message: "ERR count should be greater than or equal to -1"}
+			}
+			count = n
+		}
+
+		sl.mu.Lock()
+		defer sl.mu.Unlock()
+		if count == -1 || count > len(sl.entries) {
+			count = len(sl.entries)
+		}
+		elements := make([]protocol.RespValue, count)
+		for i := range elements {
+			e := sl.entries[len(sl.entries)-1-i]
+			elements[i] = &protocol.Array{Elements: []protocol.RespValue{
+				&protocol.IntegerBulkString{Data: e.id},
+				&protocol.IntegerBulkString{Data: e.time.Unix()},
+				&protocol.IntegerBulkString{Data: e.duration.Microseconds()},
+				bulkStrings(e.args),
+				&protocol.BulkString{Data: e.addr},
+				&protocol.BulkString{Data: e.name},
+			}}
+		}
+		return &protocol.Array{Elements: elements}, nil
+
+	case "LEN":
+		if len(args) != 1 {
+			return nil, subcommandArityError("slowlog", sub)
+		}
+		sl.mu.Lock()
+		defer sl.mu.Unlock()
+		return &protocol.IntegerBulkString{Data: int64(len(sl.entries))}, nil
+
+	case "RESET":
+		if len(args) != 1 {
+			return nil, subcommandArityError("slowlog", sub)
+		}
+		sl.mu.Lock()
+		defer sl.mu.Unlock()
+		sl.entries = nil
+		return &protocol.SimpleString{Data: "OK"}, nil
+
+	default:
+		return nil, &protocol.Error{Message: fmt.Sprintf("ERR unknown subcommand '%s'. Try SLOWLOG HELP.", args[0])}
+	}
+}
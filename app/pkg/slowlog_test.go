@@ -0,0 +1,144 @@
+package pkg
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/protocol"
+)
+
+type loggedCommand struct {
+	id   int64
+	args []string
+	addr string
+	name string
+}
+
+// slowlogGet runs SLOWLOG GET with args and returns its entries, newest
+// first.
+func slowlogGet(t *testing.T, c *client.Conn, args ...string) []loggedCommand {
+	t.Helper()
+	reply, err := c.Do(append([]string{"SLOWLOG", "GET"}, args...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []loggedCommand
+	for _, element := range reply.(*protocol.Array).Elements {
+		fields := element.(*protocol.Array).Elements
+		if len(fields) != 6 {
+			t.Fatalf("slow log entry of %d fields", len(fields))
+		}
+		var e loggedCommand
+		var err error
+		if e.id, err = client.Int64(fields[0], nil); err != nil {
+			t.Fatal(err)
+		}
+		if e.args, err = client.Strings(fields[3], nil); err != nil {
+			t.Fatal(err)
+		}
+		e.addr, _ = client.String(fields[4], nil)
+		e.name, _ = client.String(fields[5], nil)
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestSlowlog(t *testing.T) {
+	c := dial(t, startServer(t), &client.Options{ClientName: "worker"})
+	addr := clientInfo(t, c)["addr"]
+	if _, err := c.Do("CONFIG", "SET", "slowlog-log-slower-than", "0", "slowlog-max-len", "3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Do("SLOWLOG", "RESET"); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 5 {
+		if _, err := c.Do("SET", fmt.Sprint("k", i), "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The log keeps the newest slowlog-max-len commands.
+	if n, err := client.Int64(c.Do("SLOWLOG", "LEN")); err != nil || n != 3 {
+		t.Errorf("SLOWLOG LEN: %d, %v, want 3", n, err)
+	}
+	entries := slowlogGet(t, c)
+	if len(entries) != 3 {
+		t.Fatalf("SLOWLOG GET: %d entries, want 3", len(entries))
+	}
+	for i, want := range [][]string{{"SLOWLOG", "LEN"}, {"SET", "k4", "v"}, {"SET", "k3", "v"}} {
+		e := entries[i]
+		if !slices.Equal(e.args, want) || e.addr != addr || e.name != "worker" {
+			t.Errorf("entry %d: %q from %s %q, want %q from %s", i, e.args, e.addr, e.name, want, addr)
+		}
+		if i > 0 && e.id != entries[i-1].id-1 {
+			t.Errorf("entry %d: id %d after %d", i, e.id, entries[i-1].id)
+		}
+	}
+	if got := slowlogGet(t, c, "1"); len(got) != 1 || !slices.Equal(got[0].args, []string{"SLOWLOG", "GET"}) {
+		t.Errorf("SLOWLOG GET 1: %+v", got)
+	}
+	if got := slowlogGet(t, c, "-1"); len(got) != 3 {
+		t.Errorf("SLOWLOG GET -1: %d entries, want 3", len(got))
+	}
+	if _, err := c.Do("SLOWLOG", "GET", "-2"); replyError(err) == "" {
+		t.Errorf("SLOWLOG GET -2: %v, want an error", err)
+	}
+
+	// Long commands and arguments are cut short, and credentials hidden.
+	args := []string{"RPUSH", "list"}
+	for i := range 40 {
+		args = append(args, fmt.Sprint(i))
+	}
+	if _, err := c.Do(args...); err != nil {
+		t.Fatal(err)
+	}
+	want := append(args[:31:31], "... (11 more arguments)")
+	if got := slowlogGet(t, c, "1")[0].args; !slices.Equal(got, want) {
+		t.Errorf("command of %d arguments logged as %q, want %q", len(args), got, want)
+	}
+	long := strings.Repeat("x", 200)
+	if _, err := c.Do("SET", "k", long); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"SET", "k", strings.Repeat("x", 128) + "... (72 more bytes)"}
+	if got := slowlogGet(t, c, "1")[0].args; !slices.Equal(got, want) {
+		t.Errorf("argument of 200 bytes logged as %q, want %q", got, want)
+	}
+	if _, err := c.Do("AUTH", "default", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"AUTH", "(redacted)", "(redacted)"}
+	if got := slowlogGet(t, c, "1")[0].args; !slices.Equal(got, want) {
+		t.Errorf("AUTH logged as %q, want %q", got, want)
+	}
+
+	// Lowering slowlog-max-len drops the oldest entries on the next command
+	// logged, and a negative threshold logs nothing.
+	if _, err := c.Do("CONFIG", "SET", "slowlog-max-len", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := client.Int64(c.Do("SLOWLOG", "LEN")); err != nil || n != 1 {
+		t.Errorf("SLOWLOG LEN after lowering slowlog-max-len: %d, %v, want 1", n, err)
+	}
+	if _, err := c.Do("CONFIG", "SET", "slowlog-log-slower-than", "-1"); err != nil {
+		t.Fatal(err)
+	}
+	before := slowlogGet(t, c)
+	if _, err := c.Do("SET", "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if after := slowlogGet(t, c); len(after) != 1 || after[0].id != before[0].id {
+		t.Errorf("slow log with a negative threshold: %+v, was %+v", after, before)
+	}
+
+	if _, err := c.Do("SLOWLOG", "RESET"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := client.Int64(c.Do("SLOWLOG", "LEN")); err != nil || n != 0 {
+		t.Errorf("SLOWLOG LEN after RESET: %d, %v, want 0", n, err)
+	}
+}
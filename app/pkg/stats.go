@@ -0,0 +1,123 @@
+package pkg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// stats holds the counters INFO reports and CONFIG RESETSTAT clears.
+type stats struct {
+	connections         atomic.Int64
+	rejectedConnections atomic.Int64
+	commands            atomic.Int64
+
+	authFailures   atomic.Int64
+	deniedCommands atomic.Int64
+	deniedKeys     atomic.Int64
+	deniedChannels atomic.Int64
+
+	cmdMu      sync.Mutex
+	perCommand map[string]*commandStats
+}
+
+// commandStats are the INFO commandstats counters of one command or
+// subcommand.
+type commandStats struct {
+	calls    int64
+	usec     int64
+	rejected int64
+	failed   int64
+}
+
+func newStats() *stats {
+	return &stats{perCommand: make(map[string]*commandStats)}
+}
+
+func (st *stats) reset() {
+	st.connections.Store(0)
+	st.rejectedConnections.Store(0)
+	st.commands.Store(0)
+	st.authFailures.Store(0)
+	st.deniedCommands.Store(0)
+	st.deniedKeys.Store(0)
+	st.deniedChannels.Store(0)
+	st.cmdMu.Lock()
+	st.perCommand = make(map[string]*commandStats)
+	st.cmdMu.Unlock()
+}
+
+// commandStatsLocked returns the counters of name; st.cmdMu must be held.
+func (st *stats) commandStatsLocked(name string) *commandStats {
+	cs, ok := st.perCommand[name]
+	if !ok {
+		cs = &commandStats{}
+		st.perCommand[name] = cs
+	}
+	return cs
+}
+
+// called records an executed command, and whether it replied with an error.
+func (st *stats) called(name string, d time.Duration, failed bool) {
+	st.commands.Add(1)
+	st.cmdMu.Lock()
+	defer st.cmdMu.Unlock()
+	cs := st.commandStatsLocked(name)
+	cs.calls++
+	cs.usec += d.Microseconds()
+	if failed {
+		cs.failed++
+	}
+}
+
+// rejected records a command refused before it ran.
+func (st *stats) rejected(name string) {
+	st.cmdMu.Lock()
+	defer st.cmdMu.Unlock()
+	st.commandStatsLocked(name).rejected++
+}
+
+func (s *Server) statsInfo() string {
+	keyspace := s.Store.Stats()
+	var sb strings.Builder
+	sb.WriteString("# Stats\r\n")
+	fmt.Fprintf(&sb, "total_connections_received:%d\r\n", s.stats.connections.Load())
+	fmt.Fprintf(&sb, "total_commands_processed:%d\r\n", s.stats.commands.Load())
+	fmt.Fprintf(&sb, "rejected_connections:%d\r\n", s.stats.rejectedConnections.Load())
+	fmt.Fprintf(&sb, "expired_keys:%d\r\n", keyspace.Expired)
+	fmt.Fprintf(&sb, "keyspace_hits:%d\r\n", keyspace.Hits)
+	fmt.Fprintf(&sb, "keyspace_misses:%d\r\n", keyspace.Misses)
+	fmt.Fprintf(&sb, "pubsub_channels:%d\r\n", len(s.PubSub.Channels("")))
+	fmt.Fprintf(&sb, "pubsub_patterns:%d\r\n", s.PubSub.NumPat())
+	fmt.Fprintf(&sb, "acl_access_denied_auth:%d\r\n", s.stats.authFailures.Load())
+	fmt.Fprintf(&sb, "acl_access_denied_cmd:%d\r\n", s.stats.deniedCommands.Load())
+	fmt.Fprintf(&sb, "acl_access_denied_key:%d\r\n", s.stats.deniedKeys.Load())
+	fmt.Fprintf(&sb, "acl_access_denied_channel:%d\r\n", s.stats.deniedChannels.Load())
+	return sb.String()
+}
+
+func (s *Server) commandStatsInfo() string {
+	s.stats.cmdMu.Lock()
+	names := make([]string, 0, len(s.stats.perCommand))
+	for name := range s.stats.perCommand {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString("# Commandstats\r\n")
+	for _, name := range names {
+		cs := s.stats.perCommand[name]
+		perCall := 0.0
+		if cs.calls > 0 {
+			perCall = float64(cs.usec) / float64(cs.calls)
+		}
+		fmt.Fprintf(&sb, "cmdstat_%s:calls=%d,usec=%d,usec_per_call=%.2f,rejected_calls=%d,failed_calls=%d\r\n",
+			name, cs.calls, cs.usec, perCall, cs.rejected, cs.failed)
+	}
+	s.stats.cmdMu.Unlock()
+	return sb.String()
+}
@@ -1,5 +1,7 @@
 package store
 
+import "sync"
+
 type KeyType int
 
 const (
@@ -17,6 +19,7 @@ var KeyTypeName = map[KeyType]string{
 }
 
 type KeyTypeStore struct {
+	mu       sync.RWMutex
 	KeyTypes map[string]KeyType
 }
 
@@ -27,9 +30,19 @@ func NewKeyTypeStore() *KeyTypeStore {
 }
 
 func (s *KeyTypeStore) Register(key string, keyType KeyType) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.KeyTypes[key] = keyType
 }
 
 func (s *KeyTypeStore) Get(key string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return KeyTypeName[s.KeyTypes[key]]
 }
+
+func (s *KeyTypeStore) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.KeyTypes = make(map[string]KeyType)
+}
@@ -12,8 +12,9 @@ type Entry struct {
 }
 
 type KVStore struct {
-	mu   sync.RWMutex
-	data map[string]Entry
+	mu    sync.RWMutex
+	data  map[string]Entry
+	stats lookupStats
 }
 
 func NewKVStore() *KVStore {
@@ -22,6 +23,8 @@ func NewKVStore() *KVStore {
 	}
 }
 
+// Set stores value at key, expiring after expiration if it is positive.
+// The store keeps value, so it must not be modified afterwards.
 func (s *KVStore) Set(key string, value []byte, expiration time.Duration) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -43,6 +46,7 @@ func (s *KVStore) Get(key string) ([]byte, bool) {
 	entry, exists := s.data[key]
 	s.mu.RUnlock()
 	if !exists {
+		s.stats.lookup(false)
 		return nil, false
 	}
 
@@ -53,10 +57,59 @@ func (s *KVStore) Get(key string) ([]byte, bool) {
 		// TODO: Is this ok ?
 		if exists && !entry.ExpiresAt.IsZero() && time.Now().After(entry.ExpiresAt) {
 			delete(s.data, key)
+			s.stats.expired.Add(1)
 		}
 		s.mu.Unlock()
+		s.stats.lookup(false)
 		return nil, false
 	}
 
+	s.stats.lookup(true)
 	return entry.Data, true
 }
+
+// SetWithDeadline stores a value that expires at expiresAt, or never when
+// expiresAt is zero.
+func (s *KVStore) SetWithDeadline(key string, value []byte, expiresAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = Entry{Data: value, CreatedAt: time.Now(), ExpiresAt: expiresAt}
+}
+
+// Snapshot returns a copy of every entry that has not expired.
+func (s *KVStore) Snapshot() map[string]Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := time.Now()
+	snapshot := make(map[string]Entry, len(s.data))
+	for key, entry := range s.data {
+		if !entry.ExpiresAt.IsZero() && now.After(entry.ExpiresAt) {
+			continue
+		}
+		snapshot[key] = entry
+	}
+	return snapshot
+}
+
+// Counts returns the number of keys that have not expired and how many of
+// them have an expiry.
+func (s *KVStore) Counts() (keys, expires int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := time.Now()
+	for _, entry := range s.data {
+		if entry.ExpiresAt.IsZero() {
+			keys++
+		} else if !now.After(entry.ExpiresAt) {
+			keys++
+			expires++
+		}
+	}
+	return keys, expires
+}
+
+func (s *KVStore) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = make(map[string]Entry)
+}
@@ -1,50 +1,49 @@
 package store
 
-import (
-	"sync"
-	"time"
-)
+import "sync"
 
+// Waiter is a client blocked until an element is pushed to one of keys.
 type Waiter struct {
-	key       string
-	ch        chan string
-	expire    time.Time
-	createdAt time.Time
+	keys []string
+	// C receives true once one of the lists may have an element to pop, or
+	// false when the store is closed.
+	C chan bool
 }
 
 type ListsStore struct {
 	mutex   sync.RWMutex
-	data    map[string][]string
+	data    map[string][][]byte
 	waiters map[string][]*Waiter
+	closed  bool
+	stats   lookupStats
 }
 
 func NewListsStore() *ListsStore {
 	return &ListsStore{
-		data: make(map[string][]string),
+		data: make(map[string][][]byte),
 	}
 }
 
-func (ls *ListsStore) RPush(key string, values ...string) int {
+// RPush appends values to the list at key. The list keeps them, so they
+// must not be modified afterwards.
+func (ls *ListsStore) RPush(key string, values ...[]byte) int {
 	ls.mutex.Lock()
 	defer ls.mutex.Unlock()
 	ls.data[key] = append(ls.data[key], values...)
 	length := len(ls.data[key])
-	ls.wakeOldestWaiter(key)
+	ls.wakeWaiters(key)
 	return length
 }
 
-func (ls *ListsStore) LRange(key string, start, end int) []string {
+func (ls *ListsStore) LRange(key string, start, end int) [][]byte {
 	ls.mutex.Lock()
 	defer ls.mutex.Unlock()
 
-	list, exists := ls.data[key]
-	if !exists {
-		return []string{}
-	}
-
+	list := ls.data[key]
 	length := len(list)
+	ls.stats.lookup(length > 0)
 	if length == 0 {
-		return []string{}
+		return [][]byte{}
 	}
 
 	if start < 0 {
@@ -62,26 +61,27 @@ func (ls *ListsStore) LRange(key string, start, end int) []string {
 	}
 
 	if start > end || start >= length {
-		return []string{}
+		return [][]byte{}
 	}
 
-	result := make([]string, end-start+1)
+	result := make([][]byte, end-start+1)
 	copy(result, list[start:end+1])
 
 	return result
 }
 
-func (ls *ListsStore) LPush(key string, values ...string) int {
+// LPush prepends values to the list at key, keeping them like RPush.
+func (ls *ListsStore) LPush(key string, values ...[]byte) int {
 	ls.mutex.Lock()
 	defer ls.mutex.Unlock()
-	newArr := make([]string, len(ls.data[key])+len(values))
+	newArr := make([][]byte, len(ls.data[key])+len(values))
 	for i, value := range values {
 		newArr[len(values)-i-1] = value
 	}
 	copy(newArr[len(values):], ls.data[key])
 	ls.data[key] = newArr
 	length := len(ls.data[key])
-	ls.wakeOldestWaiter(key)
+	ls.wakeWaiters(key)
 	return length
 }
 
@@ -89,17 +89,19 @@ func (ls *ListsStore) GetLength(key string) int {
 	ls.mutex.Lock()
 	defer ls.mutex.Unlock()
 	length := len(ls.data[key])
+	ls.stats.lookup(length > 0)
 	return length
 }
 
-func (ls *ListsStore) LPop(key string, numberOfPops int) []string {
+func (ls *ListsStore) LPop(key string, numberOfPops int) [][]byte {
 	ls.mutex.Lock()
 	defer ls.mutex.Unlock()
+	ls.stats.lookup(len(ls.data[key]) > 0)
 	if len(ls.data[key]) == 0 {
-		return []string{}
+		return [][]byte{}
 	}
 	if numberOfPops <= 0 {
-		return []string{}
+		return [][]byte{}
 	}
 	if numberOfPops > len(ls.data[key]) {
 		numberOfPops = len(ls.data[key])
@@ -109,44 +111,43 @@ func (ls *ListsStore) LPop(key string, numberOfPops int) []string {
 	return removedValue
 }
 
-func (ls *ListsStore) BLPop(key string, timeout time.Duration) string {
+// Wait registers a waiter for keys. Pushes wake waiters oldest first, one
+// for each element pushed, without popping for them: a woken waiter pops
+// as any other writer would, and waits again if it finds the lists empty.
+// Wait returns nil once the store is closed.
+func (ls *ListsStore) Wait(keys ...string) *Waiter {
 	ls.mutex.Lock()
-
-	// If list already has elements, pop immediately
-	if len(ls.data[key]) > 0 {
-		value := ls.data[key][0]
-		ls.data[key] = ls.data[key][1:]
-		ls.mutex.Unlock()
-		return value
-	}
-
-	// List is empty, create a waiter
-	waiter := &Waiter{
-		key:       key,
-		ch:        make(chan string, 1),
-		createdAt: time.Now(),
-		expire:    time.Now().Add(timeout),
+	defer ls.mutex.Unlock()
+	if ls.closed {
+		return nil
 	}
-
+	waiter := &Waiter{keys: keys, C: make(chan bool, 1)}
 	if ls.waiters == nil {
 		ls.waiters = make(map[string][]*Waiter)
 	}
-	ls.waiters[key] = append(ls.waiters[key], waiter)
-	ls.mutex.Unlock()
+	for _, key := range keys {
+		ls.waiters[key] = append(ls.waiters[key], waiter)
+	}
+	return waiter
+}
 
-	if timeout == 0 {
-		select {
-		case value := <-waiter.ch:
-			return value
+// StopWaiting unregisters a waiter that gave up. If a push woke it
+// meanwhile, the wake-up passes to the next waiter.
+func (ls *ListsStore) StopWaiting(waiter *Waiter) {
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+	select {
+	case <-waiter.C:
+		for _, key := range waiter.keys {
+			ls.wakeWaiters(key)
 		}
+	default:
+		ls.removeWaiter(waiter)
 	}
+}
 
-	// Wait for either a push or timeout
-	select {
-	case value := <-waiter.ch:
-		return value
-	case <-time.After(timeout):
-		ls.mutex.Lock()
+func (ls *ListsStore) removeWaiter(waiter *Waiter) {
+	for _, key := range waiter.keys {
 		queue := ls.waiters[key]
 		newQueue := make([]*Waiter, 0, len(queue))
 		for _, w := range queue {
@@ -159,33 +160,65 @@ func (ls *ListsStore) BLPop(key string, timeout time.Duration) string {
 		} else {
 			ls.waiters[key] = newQueue
 		}
-		ls.mutex.Unlock()
-		return ""
 	}
 }
 
-func (ls *ListsStore) wakeOldestWaiter(key string) {
-	waiters := ls.waiters[key]
-	if len(waiters) == 0 {
-		return
-	}
-
-	list := ls.data[key]
-	if len(list) == 0 {
-		return
+// wakeWaiters wakes as many of key's oldest waiters as its list has
+// elements.
+func (ls *ListsStore) wakeWaiters(key string) {
+	for n := len(ls.data[key]); n > 0 && len(ls.waiters[key]) > 0; n-- {
+		waiter := ls.waiters[key][0]
+		ls.removeWaiter(waiter)
+		waiter.C <- true
 	}
+}
 
-	waiter := waiters[0]
-	ls.waiters[key] = waiters[1:]
-	if len(ls.waiters[key]) == 0 {
+// Close wakes every waiter with false, and makes later calls to Wait
+// return nil.
+func (ls *ListsStore) Close() {
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+	ls.closed = true
+	for key, waiters := range ls.waiters {
+		for _, waiter := range waiters {
+			select {
+			case waiter.C <- false:
+			default:
+			}
+		}
 		delete(ls.waiters, key)
 	}
+}
 
-	value := list[0]
-	ls.data[key] = list[1:]
+// Snapshot returns a copy of every non-empty list.
+func (ls *ListsStore) Snapshot() map[string][][]byte {
+	ls.mutex.RLock()
+	defer ls.mutex.RUnlock()
+	snapshot := make(map[string][][]byte, len(ls.data))
+	for key, list := range ls.data {
+		if len(list) == 0 {
+			continue
+		}
+		snapshot[key] = append([][]byte(nil), list...)
+	}
+	return snapshot
+}
 
-	select {
-	case waiter.ch <- value:
-	default:
+// Len returns the number of non-empty lists.
+func (ls *ListsStore) Len() int {
+	ls.mutex.RLock()
+	defer ls.mutex.RUnlock()
+	n := 0
+	for _, list := range ls.data {
+		if len(list) > 0 {
+			n++
+		}
 	}
+	return n
+}
+
+func (ls *ListsStore) Flush() {
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+	ls.data = make(map[string][][]byte)
 }
@@ -1,8 +1,67 @@
 package store
 
+import "sync/atomic"
+
 type Store struct {
 	KV           *KVStore
 	Lists        *ListsStore
 	StreamStore  *StreamStore
 	KeyTypeStore *KeyTypeStore
 }
+
+// Flush removes every key from every store.
+func (s *Store) Flush() {
+	s.KV.Flush()
+	s.Lists.Flush()
+	s.StreamStore.Flush()
+	s.KeyTypeStore.Flush()
+}
+
+// Stats are the keyspace counters INFO reports.
+type Stats struct {
+	Hits    int64
+	Misses  int64
+	Expired int64
+}
+
+// lookupStats counts reads that found a key, reads that did not, and keys
+// removed because they expired.
+type lookupStats struct {
+	hits, misses, expired atomic.Int64
+}
+
+func (st *lookupStats) lookup(found bool) {
+	if found {
+		st.hits.Add(1)
+	} else {
+		st.misses.Add(1)
+	}
+}
+
+func (st *lookupStats) reset() {
+	st.hits.Store(0)
+	st.misses.Store(0)
+	st.expired.Store(0)
+}
+
+func (s *Store) Stats() Stats {
+	return Stats{
+		Hits:    s.KV.stats.hits.Load() + s.Lists.stats.hits.Load() + s.StreamStore.stats.hits.Load(),
+		Misses:  s.KV.stats.misses.Load() + s.Lists.stats.misses.Load() + s.StreamStore.stats.misses.Load(),
+		Expired: s.KV.stats.expired.Load(),
+	}
+}
+
+func (s *Store) ResetStats() {
+	s.KV.stats.reset()
+	s.Lists.stats.reset()
+	s.StreamStore.stats.reset()
+}
+
+// Counts returns the number of keys and how many of them have an expiry.
+// Only strings can expire, as SET with PX is the only way to set a TTL, so
+// expiries are counted in the KV store alone.
+func (s *Store) Counts() (keys, expires int) {
+	keys, expires = s.KV.Counts()
+	return keys + s.Lists.Len() + s.StreamStore.Len(), expires
+}
@@ -9,13 +9,14 @@ import (
 
 type StreamEntry struct {
 	Id     string
-	Keys   []string
-	Values []string
+	Keys   [][]byte
+	Values [][]byte
 }
 
 type StreamStore struct {
-	Data map[string][]*StreamEntry
-	rwm  sync.RWMutex
+	Data  map[string][]*StreamEntry
+	rwm   sync.RWMutex
+	stats lookupStats
 }
 
 func NewStreamStore() *StreamStore {
@@ -41,6 +42,7 @@ func (s *StreamStore) XRange(streamKey, start, end string) ([]*StreamEntry, bool
 	s.rwm.RLock()
 	defer s.rwm.RUnlock()
 	arr := s.Data[streamKey]
+	s.stats.lookup(len(arr) > 0)
 	if len(arr) == 0 {
 		return nil, false
 	}
@@ -62,6 +64,31 @@ func (s *StreamStore) XRange(streamKey, start, end string) ([]*StreamEntry, bool
 	return res, true
 }
 
+// Snapshot returns the entries of every stream. The entries themselves are
+// shared, which is safe because they are never modified after Add.
+func (s *StreamStore) Snapshot() map[string][]*StreamEntry {
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+	snapshot := make(map[string][]*StreamEntry, len(s.Data))
+	for key, entries := range s.Data {
+		snapshot[key] = append([]*StreamEntry(nil), entries...)
+	}
+	return snapshot
+}
+
+// Len returns the number of streams.
+func (s *StreamStore) Len() int {
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+	return len(s.Data)
+}
+
+func (s *StreamStore) Flush() {
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	s.Data = make(map[string][]*StreamEntry)
+}
+
 func compareIds(a, b string) int {
 	aParts := strings.Split(a, "-")
 	bParts := strings.Split(b, "-")
@@ -96,6 +123,7 @@ func (s *StreamStore) XReadStreams(streamKeys, ids []string) [][]*StreamEntry {
 	for i := 0; i < n; i++ {
 		streamKey := streamKeys[i]
 		id := ids[i]
+		s.stats.lookup(len(s.Data[streamKey]) > 0)
 		wg.Add(1)
 		go s.XReadStream(streamKey, id, index, results, &wg)
 		index++
@@ -105,6 +133,7 @@ func (s *StreamStore) XReadStreams(streamKeys, ids []string) [][]*StreamEntry {
 }
 
 func (s *StreamStore) XReadStream(streamKey, id string, index int, results [][]*StreamEntry, wg *sync.WaitGroup) {
+	defer wg.Done()
 	arr := s.Data[streamKey]
 	if len(arr) == 0 {
 		results[index] = nil
@@ -114,5 +143,4 @@ func (s *StreamStore) XReadStream(streamKey, id string, index int, results [][]*
 		return compareIds(arr[i].Id, id) > 0
 	})
 	results[index] = arr[idx:]
-	wg.Done()
 }
@@ -0,0 +1,78 @@
+package pkg
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+// tlsEnabled reports whether a TLS port is configured.
+func (s *Server) tlsEnabled() bool {
+	return s.Config.Int("tls-port") != 0
+}
+
+// loadTLS builds the TLS configuration from the certificate settings and
+// makes new handshakes use it. Connections already established keep their
+// session.
+func (s *Server) loadTLS() error {
+	certFile, keyFile := s.Config.Get("tls-cert-file"), s.Config.Get("tls-key-file")
+	if certFile == "" || keyFile == "" {
+		return errors.New("tls-cert-file and tls-key-file must be set")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+
+	// Like Redis, refuse to authenticate clients without a CA to verify
+	// their certificates against.
+	caFile, authClients := s.Config.Get("tls-ca-cert-file"), s.Config.Get("tls-auth-clients")
+	if caFile == "" {
+		if authClients != "no" {
+			return errors.New("tls-ca-cert-file must be set when tls-auth-clients is enabled")
+		}
+	} else {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return err
+		}
+		cfg.ClientCAs = x509.NewCertPool()
+		if !cfg.ClientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", caFile)
+		}
+		switch authClients {
+		case "yes":
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		case "optional":
+			cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	s.tlsConfig.Store(cfg)
+	return nil
+}
+
+// listenTLS opens the TLS port on every bind address. Each handshake picks
+// up the configuration current at the time, so reloading certificates
+// needs no new listener.
+func (s *Server) listenTLS() ([]net.Listener, error) {
+	if err := s.loadTLS(); err != nil {
+		return nil, fmt.Errorf("loading TLS configuration: %w", err)
+	}
+	listeners, err := s.listenBind(s.Config.Get("tls-port"))
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return s.tlsConfig.Load(), nil
+		},
+	}
+	for i, ln := range listeners {
+		listeners[i] = tls.NewListener(ln, cfg)
+	}
+	return listeners, nil
+}
@@ -0,0 +1,228 @@
+package pkg
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+)
+
+// testCA is a certificate authority that issues certificates for tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+	// file holds the CA certificate in PEM.
+	file string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	ca := &testCA{}
+	der := ca.issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, &ca.key)
+	var err error
+	if ca.cert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	ca.pool = x509.NewCertPool()
+	ca.pool.AddCert(ca.cert)
+	ca.file = writePEM(t, "ca.crt", "CERTIFICATE", der)
+	return ca
+}
+
+// issue signs template with the CA, or self-signs it when the CA has no
+// certificate yet, and stores the new key in key.
+func (ca *testCA) issue(t *testing.T, template *x509.Certificate, key **ecdsa.PrivateKey) []byte {
+	t.Helper()
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	*key = k
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	parent, signer := template, k
+	if ca.cert != nil {
+		parent, signer = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &k.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// leaf issues a certificate for usage and returns it along with the paths
+// of its certificate and key files.
+func (ca *testCA) leaf(t *testing.T, name string, usage x509.ExtKeyUsage) (tls.Certificate, string, string) {
+	t.Helper()
+	var key *ecdsa.PrivateKey
+	der := ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{usage},
+	}, &key)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := writePEM(t, name+".crt", "CERTIFICATE", der)
+	keyFile := writePEM(t, name+".key", "EC PRIVATE KEY", keyDER)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, certFile, keyFile
+}
+
+func writePEM(t *testing.T, name, typ string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// freePort returns a loopback port that nothing listens on, for the
+// settings that do not accept port 0.
+func freePort(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+}
+
+// pingTLS connects to addr, a loopback address, with cfg and runs PING.
+// Servers that refuse the client certificate only report it once the
+// client reads, after the TLS 1.3 handshake.
+func pingTLS(t *testing.T, addr string, cfg *tls.Config) error {
+	cfg.ServerName = "127.0.0.1"
+	c, err := client.Dial(t.Context(), "tcp", addr, &client.Options{TLSConfig: cfg})
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	_, err = c.Do("PING")
+	return err
+}
+
+func TestTLS(t *testing.T) {
+	ca := newTestCA(t)
+	_, serverCert, serverKey := ca.leaf(t, "server", x509.ExtKeyUsageServerAuth)
+	clientCert, _, _ := ca.leaf(t, "client", x509.ExtKeyUsageClientAuth)
+	otherCert, _, _ := newTestCA(t).leaf(t, "other", x509.ExtKeyUsageClientAuth)
+
+	tests := []struct {
+		authClients string
+		// Whether connecting with the certificate the CA issued, with one
+		// from another CA, and without any certificate succeeds.
+		withCert, otherCert, noCert bool
+	}{
+		{"yes", true, false, false},
+		{"optional", true, false, true},
+		{"no", true, true, true},
+	}
+	for _, tt := range tests {
+		t.Run("tls-auth-clients "+tt.authClients, func(t *testing.T) {
+			_, addrs := startServerArgs(t, "--bind", "127.0.0.1", "--tls-port", freePort(t),
+				"--tls-cert-file", serverCert, "--tls-key-file", serverKey,
+				"--tls-ca-cert-file", ca.file, "--tls-auth-clients", tt.authClients)
+			plain, tlsAddr := addrs[0], addrs[1]
+
+			for _, c := range []struct {
+				name string
+				cert []tls.Certificate
+				want bool
+			}{
+				{"certificate from the CA", []tls.Certificate{clientCert}, tt.withCert},
+				{"certificate from another CA", []tls.Certificate{otherCert}, tt.otherCert},
+				{"no certificate", nil, tt.noCert},
+			} {
+				err := pingTLS(t, tlsAddr, &tls.Config{RootCAs: ca.pool, Certificates: c.cert})
+				if (err == nil) != c.want {
+					t.Errorf("%s: %v, want success %v", c.name, err, c.want)
+				}
+			}
+
+			// The server presents the configured certificate, which clients
+			// that don't trust the CA refuse.
+			if err := pingTLS(t, tlsAddr, &tls.Config{Certificates: []tls.Certificate{clientCert}}); err == nil {
+				t.Error("connected without trusting the server's CA")
+			}
+			// The plain port keeps working, and the TLS port speaks only TLS.
+			if _, err := dial(t, plain, nil).Do("PING"); err != nil {
+				t.Errorf("PING on the plain port: %v", err)
+			}
+			conn, err := client.Dial(t.Context(), "tcp", tlsAddr, &client.Options{ReadTimeout: time.Second})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if _, err := conn.Do("PING"); err == nil {
+				t.Error("PING in plain text on the TLS port succeeded")
+			}
+		})
+	}
+}
+
+func TestTLSReload(t *testing.T) {
+	ca := newTestCA(t)
+	_, serverCert, serverKey := ca.leaf(t, "server", x509.ExtKeyUsageServerAuth)
+	_, addrs := startServerArgs(t, "--bind", "127.0.0.1", "--tls-port", freePort(t),
+		"--tls-cert-file", serverCert, "--tls-key-file", serverKey, "--tls-ca-cert-file", ca.file)
+	admin := dial(t, addrs[0], nil)
+	tlsAddr := addrs[1]
+
+	if err := pingTLS(t, tlsAddr, &tls.Config{RootCAs: ca.pool}); err == nil {
+		t.Fatal("connected without a client certificate")
+	}
+	if _, err := admin.Do("CONFIG", "SET", "tls-auth-clients", "no"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pingTLS(t, tlsAddr, &tls.Config{RootCAs: ca.pool}); err != nil {
+		t.Errorf("without a client certificate after CONFIG SET tls-auth-clients no: %v", err)
+	}
+
+	// A certificate from another CA replaces the current one for new
+	// connections, and a bad one leaves the configuration as it was.
+	other := newTestCA(t)
+	_, otherCert, otherKey := other.leaf(t, "server", x509.ExtKeyUsageServerAuth)
+	if _, err := admin.Do("CONFIG", "SET", "tls-cert-file", otherCert, "tls-key-file", otherKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := pingTLS(t, tlsAddr, &tls.Config{RootCAs: other.pool}); err != nil {
+		t.Errorf("with the new server certificate: %v", err)
+	}
+	if _, err := admin.Do("CONFIG", "SET", "tls-cert-file", filepath.Join(t.TempDir(), "missing.crt")); replyError(err) == "" {
+		t.Errorf("CONFIG SET of a missing certificate: %v, want an error", err)
+	}
+	if got, err := client.StringMap(admin.Do("CONFIG", "GET", "tls-cert-file")); err != nil || got["tls-cert-file"] != otherCert {
+		t.Errorf("tls-cert-file after a failed CONFIG SET: %q, %v", got, err)
+	}
+	if err := pingTLS(t, tlsAddr, &tls.Config{RootCAs: other.pool}); err != nil {
+		t.Errorf("after a failed CONFIG SET: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package pkg
+
+import (
+	"context"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/config"
+)
+
+func TestUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redis.sock")
+	// A socket left behind by a server that did not shut down cleanly is
+	// replaced.
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	s, addrs := startServerArgs(t, "--unixsocket", path, "--unixsocketperm", "700")
+	if addrs[1] != path {
+		t.Fatalf("listening on %q, want %s", addrs, path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&fs.ModeSocket == 0 || info.Mode().Perm() != 0o700 {
+		t.Errorf("socket mode %v, want a socket with permissions 0700", info.Mode())
+	}
+
+	c, err := client.Dial(t.Context(), "unix", path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Do("SET", "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := client.String(dial(t, addrs[0], nil).Do("GET", "k")); err != nil || got != "v" {
+		t.Errorf("GET over TCP: %q, %v", got, err)
+	}
+	fields := clientInfo(t, c)
+	if !strings.Contains(fields["flags"], "U") || fields["addr"] != path+":0" || fields["laddr"] != path+":0" {
+		t.Errorf("CLIENT INFO over the socket: %q", fields)
+	}
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("socket after shutdown: %v, want it removed", err)
+	}
+}
+
+func TestUnixSocketNotASocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redis.sock")
+	if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Parse([]string{"--port", "0", "--unixsocket", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer("", newStore())
+	s.Config = cfg
+	if err := s.ListenAndServe(); err == nil || err == ErrServerClosed {
+		t.Fatalf("ListenAndServe over a regular file: %v, want an error", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "data" {
+		t.Errorf("file at the socket path: %q, %v, want it left alone", data, err)
+	}
+}